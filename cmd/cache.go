@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/ytka/textforge/internal/cache"
+)
+
+const (
+	defaultCacheTTL     = 7 * 24 * time.Hour
+	defaultCacheMaxSize = 100 << 20
+)
+
+var (
+	cacheCmd = &cobra.Command{
+		Use:   "cache",
+		Short: "Response cache commands",
+	}
+	cacheStatsCmd = &cobra.Command{
+		Use:   "stats",
+		Short: "Show the statistics of the response cache",
+		Args:  cobra.NoArgs,
+		RunE: func(_ *cobra.Command, _ []string) error {
+			return runCacheStats()
+		},
+	}
+	cacheClearCmd = &cobra.Command{
+		Use:   "clear",
+		Short: "Remove all the cached responses",
+		Args:  cobra.NoArgs,
+		RunE: func(_ *cobra.Command, _ []string) error {
+			return runCacheClear()
+		},
+	}
+)
+
+func init() {
+	cacheCmd.AddCommand(cacheStatsCmd, cacheClearCmd)
+	rootCmd.AddCommand(cacheCmd)
+}
+
+// openCacheStore opens the response cache with the default limits.
+func openCacheStore() (*cache.Store, error) {
+	dir, err := cache.DefaultDir()
+	if err != nil {
+		return nil, err
+	}
+	return cache.NewStore(dir, defaultCacheTTL, defaultCacheMaxSize), nil
+}
+
+func runCacheStats() error {
+	store, err := openCacheStore()
+	if err != nil {
+		return err
+	}
+	stats, err := store.Stats()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Directory: %s\n", stats.Dir)
+	fmt.Printf("Entries:   %d (%d expired)\n", stats.Entries, stats.Expired)
+	fmt.Printf("Size:      %d bytes\n", stats.Size)
+	if stats.Entries > 0 {
+		fmt.Printf("Oldest:    %s\n", stats.Oldest.Format(time.RFC3339))
+		fmt.Printf("Newest:    %s\n", stats.Newest.Format(time.RFC3339))
+	}
+	return nil
+}
+
+func runCacheClear() error {
+	store, err := openCacheStore()
+	if err != nil {
+		return err
+	}
+	n, err := store.Clear()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Removed %d cached responses\n", n)
+	return nil
+}
@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/ytka/textforge/internal/gitutil"
+	"github.com/ytka/textforge/internal/ledger"
+	"github.com/ytka/textforge/internal/openai"
+)
+
+var (
+	costReportOpts struct {
+		ledgerPath string
+		since      string
+		by         string
+		format     string
+	}
+
+	costCmd = &cobra.Command{
+		Use:   "cost",
+		Short: "Cost reporting commands",
+	}
+	costReportCmd = &cobra.Command{
+		Use:   "report",
+		Short: "Report the usage and cost recorded in the ledger",
+		Args:  cobra.NoArgs,
+		RunE: func(_ *cobra.Command, _ []string) error {
+			return runCostReport()
+		},
+	}
+)
+
+func init() {
+	costReportCmd.Flags().StringVar(&costReportOpts.ledgerPath, "ledger", "", "Ledger file path (default: usage.jsonl in the data directory)")
+	costReportCmd.Flags().StringVar(&costReportOpts.since, "since", "30d", "Report the usage since the period ago, e.g. 7d, 2w, 12h (empty: all)")
+	costReportCmd.Flags().StringVar(&costReportOpts.by, "by", "model", "Group by: model, prompt, project, day")
+	costReportCmd.Flags().StringVar(&costReportOpts.format, "format", "table", "Output format: table, csv")
+
+	costCmd.AddCommand(costReportCmd)
+	rootCmd.AddCommand(costCmd)
+}
+
+func runCostReport() error {
+	by, err := ledger.ParseGroupBy(costReportOpts.by)
+	if err != nil {
+		return err
+	}
+	since, err := ledger.ParseSince(costReportOpts.since, time.Now())
+	if err != nil {
+		return err
+	}
+	path := costReportOpts.ledgerPath
+	if path == "" {
+		if path, err = ledger.DefaultPath(); err != nil {
+			return fmt.Errorf("failed to get ledger path: %w", err)
+		}
+	}
+	entries, err := ledger.Read(path)
+	if err != nil {
+		return err
+	}
+
+	rows, total := ledger.Summarize(entries, since, by)
+	switch costReportOpts.format {
+	case "csv":
+		return ledger.WriteCSV(os.Stdout, by, rows)
+	case "table":
+		return ledger.WriteTable(os.Stdout, by, rows, total)
+	default:
+		return fmt.Errorf("%w: %s", ErrInvalidFormat, costReportOpts.format)
+	}
+}
+
+// promptName returns the name of the prompt recorded in the ledger.
+func promptName() string {
+	if c.PromptPath != "" && c.PromptPath != "-" {
+		return c.PromptPath
+	}
+	return "inline"
+}
+
+// projectName returns the name of the project, the git top-level directory or the current directory.
+func projectName() string {
+	if repo, err := gitutil.Open("."); err == nil {
+		return filepath.Base(repo.Root())
+	}
+	if wd, err := os.Getwd(); err == nil {
+		return filepath.Base(wd)
+	}
+	return ""
+}
+
+// recordUsage appends the usage of the requests to the ledger. Failures are only reported because the results are already written.
+func recordUsage(prompt string, inputPaths []string, usageCosts []*openai.UsageCost) {
+	if len(usageCosts) == 0 {
+		return
+	}
+	path, err := ledger.DefaultPath()
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "failed to get ledger path: %v\n", err)
+		return
+	}
+	project := projectName()
+	entries := make([]ledger.Entry, 0, len(usageCosts))
+	for i, uc := range usageCosts {
+		entries = append(entries, ledger.NewEntry(project, c.Profile, prompt, inputPaths[i], uc))
+	}
+	if err := ledger.Append(path, entries...); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "failed to record usage: %v\n", err)
+	}
+}
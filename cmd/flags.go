@@ -0,0 +1,28 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+// addModelFlags adds the flags of the model and the API shared by the commands which call the API.
+func addModelFlags(cmd *cobra.Command, modelUsage string) {
+	cmd.Flags().StringVarP(&c.Model, "model", "m", "gpt-4o", modelUsage)
+	cmd.Flags().StringVar(&c.BaseURL, "base-url", os.Getenv("OPENAI_BASE_URL"), "Base URL of the OpenAI compatible API, such as the mock server (env: OPENAI_BASE_URL)")
+	cmd.Flags().IntVarP(&c.MaxTokens, "max-tokens", "t", 0, "Max tokens to generate")
+	cmd.Flags().IntVar(&c.MaxCompletionRepeatCount, "max-completion-repeat-count", 1, "Max completion repeat count")
+}
+
+// addCacheFlags adds the flags of the response cache shared by the commands which call the API.
+func addCacheFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&c.NoCache, "no-cache", false, "Do not use the response cache")
+	cmd.Flags().DurationVar(&c.CacheTTL, "cache-ttl", defaultCacheTTL, "Ignore cached responses older than the duration (0: no expiry)")
+	cmd.Flags().Int64Var(&c.CacheMaxSize, "cache-max-size", defaultCacheMaxSize, "Evict the oldest cached responses over the size in bytes (0: unlimited)")
+}
+
+// addBudgetFlags adds the flags of the budget shared by the commands which shape several files.
+func addBudgetFlags(cmd *cobra.Command) {
+	cmd.Flags().Float64Var(&c.MaxCost, "max-cost", 0, "Stop before the total cost in dollars would exceed the amount (0: unlimited)")
+	cmd.Flags().IntVar(&c.MaxTokensTotal, "max-tokens-total", 0, "Stop before the total tokens would exceed the number (0: unlimited)")
+}
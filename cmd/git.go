@@ -0,0 +1,307 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/ytka/textforge/internal/gitutil"
+	"github.com/ytka/textforge/internal/inputs"
+	"github.com/ytka/textforge/internal/openai"
+	"github.com/ytka/textforge/internal/runner"
+	"github.com/ytka/textforge/internal/steps"
+	"github.com/ytka/textforge/internal/tokenizer"
+	"github.com/ytka/textforge/internal/tui"
+)
+
+const (
+	defaultCommitMsgPrompt = "Write a git commit message for the staged changes in the following diff. " +
+		"The first line is a summary of at most 50 characters, followed by a blank line and a body explaining what was changed and why."
+	defaultReviewPrompt = "Review the following file and point out only important problems. If there are none, reply with \"No issues found.\""
+
+	// hookMarker identifies the hooks installed by textforge.
+	hookMarker = "# Installed by textforge."
+)
+
+var (
+	ErrNoStagedChanges = errors.New("no staged changes")
+	ErrHookExists      = errors.New("hook already exists")
+
+	gitCommitMsgOpts struct {
+		maxDiffTokens int
+		yes           bool
+		commit        bool
+	}
+	gitInstallHookOpts struct {
+		command          string
+		preCommit        bool
+		reviewPromptPath string
+		force            bool
+	}
+
+	gitCmd = &cobra.Command{
+		Use:   "git",
+		Short: "Git integration commands",
+	}
+	gitCommitMsgCmd = &cobra.Command{
+		Use:   "commit-msg [message-file]",
+		Short: "Generate a commit message from the staged changes",
+		Long: "Generate a commit message from the staged changes and write it to .git/COMMIT_EDITMSG after confirmation.\n" +
+			"When message-file is given, as in the prepare-commit-msg hook, the message is prepended to the file without confirmation.",
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			if !checkAPIKeyFileExists() {
+				return fmt.Errorf("%w: %s", ErrorAPIKeyFileNotFound, getAPIKeyFilePath())
+			}
+			messageFile := ""
+			if len(args) == 1 {
+				messageFile = args[0]
+			}
+			return runGitCommitMsg(context.Background(), messageFile)
+		},
+	}
+	gitPreCommitCmd = &cobra.Command{
+		Use:   "pre-commit",
+		Short: "Review the staged files, as the pre-commit hook",
+		Long: "Review the staged files with the prompt, as the pre-commit hook installed by install-hook --pre-commit.\n" +
+			"It succeeds without a review when no files are staged or no API key is configured, so that commits are not blocked.",
+		Args: cobra.NoArgs,
+		RunE: func(_ *cobra.Command, _ []string) error {
+			return runGitPreCommit(context.Background())
+		},
+	}
+	gitInstallHookCmd = &cobra.Command{
+		Use:   "install-hook",
+		Short: "Install git hooks that call textforge",
+		Long: "Install the prepare-commit-msg hook which fills in the commit message generated by textforge.\n" +
+			"With --pre-commit, also install the pre-commit hook which reviews the staged files.",
+		Args: cobra.NoArgs,
+		RunE: func(_ *cobra.Command, _ []string) error {
+			return runGitInstallHook()
+		},
+	}
+)
+
+func init() {
+	gitCommitMsgCmd.Flags().StringVarP(&c.Prompt, "prompt", "p", "", "Prompt text (default: built-in commit message prompt)")
+	gitCommitMsgCmd.Flags().StringVarP(&c.PromptPath, "prompt-path", "P", "", "Prompt file path")
+	addModelFlags(gitCommitMsgCmd, "Model to use for text generation")
+	addCacheFlags(gitCommitMsgCmd)
+	gitCommitMsgCmd.Flags().StringVarP(&c.LogAPILevel, "log-api-level", "l", "", "API log level: info, debug")
+	gitCommitMsgCmd.Flags().IntVar(&gitCommitMsgOpts.maxDiffTokens, "max-diff-tokens", 6000, "Token budget of the diff sent to the model")
+	gitCommitMsgCmd.Flags().BoolVarP(&gitCommitMsgOpts.yes, "yes", "y", false, "Write the message without confirmation")
+	gitCommitMsgCmd.Flags().BoolVar(&gitCommitMsgOpts.commit, "commit", false, "Commit with the generated message after writing it")
+
+	gitPreCommitCmd.Flags().StringVarP(&c.Prompt, "prompt", "p", "", "Prompt text (default: built-in review prompt)")
+	gitPreCommitCmd.Flags().StringVarP(&c.PromptPath, "prompt-path", "P", "", "Prompt file path")
+	addModelFlags(gitPreCommitCmd, "Model to use for text generation")
+	addCacheFlags(gitPreCommitCmd)
+	gitPreCommitCmd.Flags().StringVarP(&c.LogAPILevel, "log-api-level", "l", "", "API log level: info, debug")
+
+	gitInstallHookCmd.Flags().StringVar(&gitInstallHookOpts.command, "command", "textforge", "Command used by the hooks to call textforge")
+	gitInstallHookCmd.Flags().BoolVar(&gitInstallHookOpts.preCommit, "pre-commit", false, "Also install the pre-commit review hook")
+	gitInstallHookCmd.Flags().StringVar(&gitInstallHookOpts.reviewPromptPath, "review-prompt-path", "", "Prompt file used by the pre-commit review hook")
+	gitInstallHookCmd.Flags().BoolVar(&gitInstallHookOpts.force, "force", false, "Overwrite existing hooks not installed by textforge")
+
+	gitCmd.AddCommand(gitCommitMsgCmd, gitPreCommitCmd, gitInstallHookCmd)
+	rootCmd.AddCommand(gitCmd)
+}
+
+func runGitCommitMsg(ctx context.Context, messageFile string) error {
+	repo, err := gitutil.Open(".")
+	if err != nil {
+		return fmt.Errorf("failed to open git repository: %w", err)
+	}
+	diff, err := repo.StagedDiff()
+	if err != nil {
+		return fmt.Errorf("failed to get staged diff: %w", err)
+	}
+	if strings.TrimSpace(diff) == "" {
+		return ErrNoStagedChanges
+	}
+	if diff, err = trimDiffToTokens(diff, gitCommitMsgOpts.maxDiffTokens); err != nil {
+		return err
+	}
+
+	message, err := generateCommitMessage(ctx, diff)
+	if err != nil {
+		return err
+	}
+
+	if messageFile != "" {
+		return prependToFile(messageFile, message)
+	}
+
+	editMsgPath, err := repo.GitPath("COMMIT_EDITMSG")
+	if err != nil {
+		return fmt.Errorf("failed to get commit message path: %w", err)
+	}
+	fmt.Print(message)
+	if !gitCommitMsgOpts.yes {
+		ok, err := tui.Confirm(fmt.Sprintf("Write to %s (y/n)?: ", editMsgPath))
+		if err != nil {
+			return fmt.Errorf("confirmation failed: %w", err)
+		}
+		if !ok {
+			return nil
+		}
+	}
+	if err := steps.WriteResult(message, editMsgPath); err != nil {
+		return fmt.Errorf("failed to write commit message: %w", err)
+	}
+	if gitCommitMsgOpts.commit {
+		if err := repo.CommitWithMessageFile(editMsgPath); err != nil {
+			return fmt.Errorf("failed to commit: %w", err)
+		}
+		return nil
+	}
+	fmt.Printf("Wrote %s. Commit with: git commit -F %s\n", editMsgPath, editMsgPath)
+	return nil
+}
+
+// trimDiffToTokens trims the diff to about maxTokens tokens of the model, converting the budget to bytes by the ratio of the diff.
+func trimDiffToTokens(diff string, maxTokens int) (string, error) {
+	tok, err := tokenizer.ForModel(c.Model)
+	if err != nil {
+		return "", fmt.Errorf("failed to get tokenizer: %w", err)
+	}
+	tokens := tok.Count(diff)
+	if maxTokens <= 0 || tokens <= maxTokens {
+		return diff, nil
+	}
+	return gitutil.TrimDiff(diff, len(diff)*maxTokens/tokens), nil
+}
+
+// generateCommitMessage asks the model for a commit message of the diff.
+func generateCommitMessage(ctx context.Context, diff string) (string, error) {
+	promptText := defaultCommitMsgPrompt
+	if c.Prompt != "" || c.PromptPath != "" {
+		text, err := steps.GetPromptText(c.Prompt, c.PromptPath)
+		if err != nil {
+			return "", fmt.Errorf("failed to get prompt text: %w", err)
+		}
+		promptText = text
+	}
+
+	// The message is used as returned, with the prompt optimized like the other commands.
+	config := c
+	config.UseFirstCodeBlock, config.PromptOptimize = false, true
+	shaper, err := runner.NewShaper(&config, makeGAIFunc)
+	if err != nil {
+		return "", err
+	}
+	result, err := shaper.Shape(ctx, shaper.MakeShapePrompt("", promptText, diff))
+	if err != nil {
+		return "", fmt.Errorf("failed to generate commit message: %w", err)
+	}
+	name := "git commit-msg"
+	if c.PromptPath != "" {
+		name = promptName()
+	}
+	recordUsage(name, []string{"-"}, []*openai.UsageCost{openai.NewUsageCost(result.ChatCompletion)})
+	return result.Result, nil
+}
+
+// prependToFile writes text before the existing content of path, keeping the comments git put there.
+func prependToFile(path, text string) error {
+	existing, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read message file: %w", err)
+	}
+	if len(existing) > 0 {
+		text += "\n" + string(existing)
+	}
+	if err := steps.WriteResult(text, path); err != nil {
+		return fmt.Errorf("failed to write message file: %w", err)
+	}
+	return nil
+}
+
+// runGitPreCommit reviews the staged files, succeeding when there is nothing to review or no API key to review with.
+func runGitPreCommit(ctx context.Context) error {
+	if !checkAPIKeyFileExists() {
+		_, _ = fmt.Fprintf(os.Stderr, "textforge: skip the review without the API key file %s\n", getAPIKeyFilePath())
+		return nil
+	}
+	if c.Prompt == "" && c.PromptPath == "" {
+		c.Prompt = defaultReviewPrompt
+	}
+	c.GitStaged = true
+	inputFiles, err := resolveInputFiles(nil)
+	if errors.Is(err, inputs.ErrNoInputsSelected) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return doRun(ctx, inputFiles, makeGAIFunc)
+}
+
+func runGitInstallHook() error {
+	repo, err := gitutil.Open(".")
+	if err != nil {
+		return fmt.Errorf("failed to open git repository: %w", err)
+	}
+	hooksDir, err := repo.GitPath("hooks")
+	if err != nil {
+		return fmt.Errorf("failed to get hooks directory: %w", err)
+	}
+	command := shellQuote(gitInstallHookOpts.command)
+
+	hooks := map[string]string{
+		"prepare-commit-msg": "case \"$2\" in\n" +
+			"message|merge|squash|commit) exit 0 ;;\n" +
+			"esac\n" +
+			command + " git commit-msg \"$1\" || echo \"textforge: failed to generate commit message\" >&2\n",
+	}
+	if gitInstallHookOpts.preCommit {
+		promptOption := ""
+		if gitInstallHookOpts.reviewPromptPath != "" {
+			abs, err := filepath.Abs(gitInstallHookOpts.reviewPromptPath)
+			if err != nil {
+				return fmt.Errorf("failed to get absolute path: %w", err)
+			}
+			promptOption = " --prompt-path " + shellQuote(abs)
+		}
+		hooks["pre-commit"] = "exec " + command + " git pre-commit" + promptOption + " </dev/null\n"
+	}
+
+	if err := os.MkdirAll(hooksDir, 0o755); err != nil {
+		return fmt.Errorf("failed to create hooks directory: %w", err)
+	}
+	for _, name := range []string{"prepare-commit-msg", "pre-commit"} {
+		body, ok := hooks[name]
+		if !ok {
+			continue
+		}
+		path := filepath.Join(hooksDir, name)
+		if err := writeHook(path, body); err != nil {
+			return err
+		}
+		fmt.Printf("Installed %s\n", path)
+	}
+	return nil
+}
+
+// writeHook writes an executable hook script, refusing to overwrite hooks not installed by textforge unless forced.
+func writeHook(path, body string) error {
+	if existing, err := os.ReadFile(path); err == nil {
+		if !strings.Contains(string(existing), hookMarker) && !gitInstallHookOpts.force {
+			return fmt.Errorf("%w: %s (use --force to overwrite)", ErrHookExists, path)
+		}
+	}
+	script := "#!/bin/sh\n" + hookMarker + "\n" + body
+	if err := os.WriteFile(path, []byte(script), 0o755); err != nil { //nolint:gosec // hooks must be executable
+		return fmt.Errorf("failed to write hook: %w", err)
+	}
+	return nil
+}
+
+// shellQuote quotes s for a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
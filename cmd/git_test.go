@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"io"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ytka/textforge/internal/mockserver"
+)
+
+func TestGitCommitMsgBaseURL(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	tmp := t.TempDir()
+	for _, name := range []string{"HOME", "XDG_CONFIG_HOME", "XDG_DATA_HOME", "XDG_CACHE_HOME"} {
+		t.Setenv(name, filepath.Join(tmp, name))
+	}
+	if err := os.MkdirAll(filepath.Dir(getAPIKeyFilePath()), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(getAPIKeyFilePath(), []byte("sk-mock\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	repo := filepath.Join(tmp, "repo")
+	if err := os.MkdirAll(repo, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(repo, "hello.txt"), []byte("hello\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, args := range [][]string{{"init", "--quiet"}, {"add", "hello.txt"}} {
+		if out, err := exec.Command("git", append([]string{"-C", repo}, args...)...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(repo); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.Chdir(wd) })
+
+	srv := httptest.NewServer(mockserver.New(nil, mockserver.TransformUpper, false))
+	defer srv.Close()
+	rootCmd.SetOut(io.Discard)
+	rootCmd.SetErr(io.Discard)
+	rootCmd.SetArgs([]string{"git", "commit-msg", "--yes", "--no-cache", "--base-url", srv.URL + "/v1", "-p", "Write a commit message"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(repo, ".git", "COMMIT_EDITMSG"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "HELLO") {
+		t.Errorf("commit message = %q, want the upper-cased diff from the mock server", data)
+	}
+}
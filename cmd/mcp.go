@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/spf13/cobra"
+	"github.com/ytka/textforge/internal/ledger"
+	"github.com/ytka/textforge/internal/mcp"
+	"github.com/ytka/textforge/internal/openai"
+	"github.com/ytka/textforge/internal/prompts"
+)
+
+var (
+	mcpOpts struct {
+		promptsDir string
+		root       string
+	}
+
+	mcpCmd = &cobra.Command{
+		Use:   "mcp",
+		Short: "Serve the prompt library as Model Context Protocol tools over stdio",
+		Long: "Speak the Model Context Protocol over stdio, so that agents and IDE assistants can use the prompts.\n" +
+			"Each prompt file in the prompts directory is a tool taking the input text or file path, the prompt variables ({{name}}) and diff.\n" +
+			"The cost ledger is exposed as the resources textforge://ledger and textforge://ledger/summary.",
+		Args: cobra.NoArgs,
+		RunE: func(_ *cobra.Command, _ []string) error {
+			return runMCP()
+		},
+	}
+)
+
+func init() {
+	mcpCmd.Flags().StringVar(&mcpOpts.promptsDir, "prompts-dir", "prompts", "Directory of the prompt files exposed as the tools")
+	mcpCmd.Flags().StringVar(&mcpOpts.root, "root", ".", "Directory the file_path of the tool calls is read from, rejecting paths outside it and hidden files (empty: file_path is not allowed)")
+
+	// Defaults of the tool calls
+	addModelFlags(mcpCmd, "Model to use for text generation")
+	mcpCmd.Flags().BoolVarP(&c.PromptOptimize, "prompt-optimize", "O", true, "Optimize prompt text")
+	mcpCmd.Flags().BoolVarP(&c.UseFirstCodeBlock, "use-first-code-block", "f", false, "Use the first code block in the output text")
+	mcpCmd.Flags().IntVar(&c.DiffContext, "diff-context", 3, "Number of context lines in the diff")
+	addCacheFlags(mcpCmd)
+	mcpCmd.Flags().StringVar(&c.Profile, "profile", os.Getenv("TEXTFORGE_PROFILE"), "Profile name recorded in the usage ledger (env: TEXTFORGE_PROFILE)")
+	rootCmd.AddCommand(mcpCmd)
+}
+
+func runMCP() error {
+	if _, err := getAPIKey(); err != nil {
+		return fmt.Errorf("failed to get API key: %w", err)
+	}
+	ledgerPath, err := ledger.DefaultPath()
+	if err != nil {
+		return fmt.Errorf("failed to get ledger path: %w", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	server := mcp.New(mcp.Options{
+		Version:    appVersion,
+		Defaults:   c,
+		Root:       mcpOpts.root,
+		Library:    prompts.NewLibrary(mcpOpts.promptsDir),
+		GAIFactory: makeGAIFunc,
+		OnUsage: func(prompt, inputPath string, uc *openai.UsageCost) {
+			recordUsage(prompt, []string{inputPath}, []*openai.UsageCost{uc})
+		},
+		LedgerPath: ledgerPath,
+	})
+	// stdout carries the protocol messages, so the logs go to stderr.
+	return server.Serve(ctx, os.Stdin, os.Stdout)
+}
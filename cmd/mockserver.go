@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/ytka/textforge/internal/mockserver"
+)
+
+var (
+	mockServerOpts struct {
+		host      string
+		port      int
+		fixtures  string
+		transform string
+		verbose   bool
+	}
+
+	mockServerCmd = &cobra.Command{
+		Use:   "mock-server",
+		Short: "Run a mock OpenAI API server for local development",
+		Long: "Run a mock of the OpenAI chat completions API which costs no tokens.\n" +
+			"Replies are scripted by the rules in the fixture files, or generated by transforming the input.\n" +
+			"Point textforge to it with --base-url http://127.0.0.1:8080/v1 or OPENAI_BASE_URL.",
+		Args: cobra.NoArgs,
+		RunE: func(_ *cobra.Command, _ []string) error {
+			return runMockServer()
+		},
+	}
+)
+
+func init() {
+	mockServerCmd.Flags().StringVar(&mockServerOpts.host, "host", "127.0.0.1", "Host to listen on")
+	mockServerCmd.Flags().IntVar(&mockServerOpts.port, "port", 8080, "Port to listen on")
+	mockServerCmd.Flags().StringVar(&mockServerOpts.fixtures, "fixtures", "", "Directory of the fixture files (*.yaml, *.yml, *.json) with the reply rules")
+	mockServerCmd.Flags().StringVar(&mockServerOpts.transform, "transform", string(mockserver.TransformEcho), "Reply to prompts matching no rule by transforming the input: echo, upper, lower, reverse")
+	mockServerCmd.Flags().BoolVarP(&mockServerOpts.verbose, "verbose", "v", false, "Log each request")
+	rootCmd.AddCommand(mockServerCmd)
+}
+
+func runMockServer() error {
+	transform, err := mockserver.ParseTransform(mockServerOpts.transform)
+	if err != nil {
+		return err
+	}
+	var rules []*mockserver.Rule
+	if mockServerOpts.fixtures != "" {
+		if rules, err = mockserver.LoadRules(mockServerOpts.fixtures); err != nil {
+			return err
+		}
+	}
+
+	addr := net.JoinHostPort(mockServerOpts.host, strconv.Itoa(mockServerOpts.port))
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           mockserver.New(rules, transform, mockServerOpts.verbose),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	fmt.Printf("Mock OpenAI server listening on http://%s/v1 (%d rules)\n", addr, len(rules))
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("failed to serve: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/ytka/textforge/internal/openai"
+)
+
+// pricingFileNames are the names of the pricing override files, looked up in this order.
+var pricingFileNames = []string{"pricing.yaml", "pricing.yml", "pricing.json"}
+
+// pricingOverridePaths returns the pricing files in the user config directory and the project, in the order of priority.
+func pricingOverridePaths() []string {
+	var dirs []string
+	if configDir, err := os.UserConfigDir(); err == nil {
+		dirs = append(dirs, filepath.Join(configDir, "textforge"))
+	}
+	dirs = append(dirs, ".textforge")
+
+	var paths []string
+	for _, dir := range dirs {
+		for _, name := range pricingFileNames {
+			paths = append(paths, filepath.Join(dir, name))
+		}
+	}
+	if path := os.Getenv("TEXTFORGE_PRICING"); path != "" {
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+// loadPricing applies the user and project pricing overrides to the embedded pricing table.
+func loadPricing() error {
+	if err := openai.LoadPricingFiles(pricingOverridePaths()...); err != nil {
+		return fmt.Errorf("failed to load pricing: %w", err)
+	}
+	return nil
+}
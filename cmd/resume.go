@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/ytka/textforge/internal/runner"
+)
+
+var (
+	resumeOpts struct {
+		continueOnError bool
+	}
+
+	resumeCmd = &cobra.Command{
+		Use:   "resume [run-id]",
+		Short: "Resume an interrupted run",
+		Long: "Resume the run with the original configuration, processing only the pending and failed input files.\n" +
+			"Without run-id, list the runs that have unfinished files.",
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				return listRuns()
+			}
+			return runResume(context.Background(), args[0])
+		},
+	}
+)
+
+func init() {
+	resumeCmd.Flags().BoolVar(&resumeOpts.continueOnError, "continue-on-error", false, "Continue with the next file when processing a file fails")
+	rootCmd.AddCommand(resumeCmd)
+}
+
+func listRuns() error {
+	cps, err := runner.ListCheckpoints()
+	if err != nil {
+		return fmt.Errorf("failed to list runs: %w", err)
+	}
+	if len(cps) == 0 {
+		fmt.Println("No runs to resume")
+		return nil
+	}
+	for _, cp := range cps {
+		fmt.Printf("%s  %s  %d pending, %d failed of %d  %s\n", cp.ID, cp.UpdatedAt.Local().Format(time.DateTime),
+			cp.Count(runner.ItemPending), cp.Count(runner.ItemFailed), len(cp.Items), cp.WorkDir)
+	}
+	return nil
+}
+
+func runResume(ctx context.Context, runID string) error {
+	cp, err := runner.LoadCheckpoint(runID)
+	if err != nil {
+		return err
+	}
+	remaining := cp.Remaining()
+	if len(remaining) == 0 {
+		fmt.Printf("Run %s has no unfinished files\n", cp.ID)
+		return nil
+	}
+	// The input paths are relative to the working directory of the run.
+	if err := os.Chdir(cp.WorkDir); err != nil {
+		return fmt.Errorf("failed to change to the working directory of the run: %w", err)
+	}
+	if !checkAPIKeyFileExists() {
+		return fmt.Errorf("%w: %s", ErrorAPIKeyFileNotFound, getAPIKeyFilePath())
+	}
+	c = cp.Config
+	c.ResumeRunID = cp.ID
+	c.ContinueOnError = c.ContinueOnError || resumeOpts.continueOnError
+	return doRun(ctx, remaining, makeGAIFunc)
+}
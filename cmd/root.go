@@ -9,32 +9,44 @@ import (
 	"sync"
 
 	"github.com/spf13/cobra"
+	"github.com/ytka/textforge/internal/costreport"
+	"github.com/ytka/textforge/internal/httpreplay"
+	"github.com/ytka/textforge/internal/inputs"
 	"github.com/ytka/textforge/internal/ioutil"
 	"github.com/ytka/textforge/internal/openai"
 	"github.com/ytka/textforge/internal/runner"
+	"github.com/ytka/textforge/internal/state"
 	"github.com/ytka/textforge/internal/steps"
 	"github.com/ytka/textforge/internal/tui"
 )
 
 var (
 	ErrorAPIKeyFileNotFound = errors.New("API key file not found")
+	ErrInvalidFormat        = errors.New("invalid format")
 	c                       runner.Config
+	appVersion              string
 	rootCmd                 = &cobra.Command{
 		Use:   "textforge",
 		Short: "textforge is a tool designed to shape and transform text using OpenAI's GPT model.",
 		Long:  "textforge is a tool designed to shape and transform text using OpenAI's GPT model.",
+		Args:  cobra.ArbitraryArgs,
+		PersistentPreRunE: func(_ *cobra.Command, _ []string) error {
+			return loadPricing()
+		},
 		RunE: func(_ *cobra.Command, args []string) error {
-			if !checkAPIKeyFileExists() {
-				return fmt.Errorf("%w: %s", ErrorAPIKeyFileNotFound, getAPIKeyFilePath())
+			inputFiles, err := resolveInputFiles(args)
+			if err != nil {
+				return err
 			}
-
-			inputFiles := args
-			if c.InputFileList != "" {
-				files, err := readInputFiles(c.InputFileList)
-				if err != nil {
-					return err
+			if c.ListInputs {
+				for _, f := range inputFiles {
+					fmt.Println(f)
 				}
-				inputFiles = files
+				return nil
+			}
+
+			if !c.Estimate && !replayOnly() && !checkAPIKeyFileExists() {
+				return fmt.Errorf("%w: %s", ErrorAPIKeyFileNotFound, getAPIKeyFilePath())
 			}
 			ctx := context.Background()
 			return doRun(ctx, inputFiles, makeGAIFunc)
@@ -49,33 +61,75 @@ func init() {
 	rootCmd.Flags().StringVarP(&c.Prompt, "prompt", "p", "", "Prompt text")
 	rootCmd.Flags().StringVarP(&c.PromptPath, "prompt-path", "P", "", "Prompt file path")
 	rootCmd.Flags().BoolVarP(&c.PromptOptimize, "prompt-optimize", "O", true, "Optimize prompt text")
+	rootCmd.Flags().StringVar(&c.Reduce, "reduce", "", "Reduce prompt text: shape each input with the prompt, then combine all the outputs with the reduce prompt")
+	rootCmd.Flags().StringVar(&c.ReducePath, "reduce-path", "", "Reduce prompt file path")
+	rootCmd.Flags().IntVar(&c.MapParallel, "map-parallel", 4, "Number of input files shaped at a time before --reduce")
+	rootCmd.Flags().IntVar(&c.ReduceChunkTokens, "reduce-chunk-tokens", 0, "Max tokens of a reduce request, reducing in several levels when exceeded (0: from the context window)")
+	rootCmd.Flags().BoolVar(&c.Tools, "tools", false, "Let the model read files, list directories and grep in the project with read-only tools")
+	rootCmd.Flags().IntVar(&c.MaxToolCalls, "max-tool-calls", 10, "Max tool calls for each input file with --tools, answering with the information so far when exceeded")
+	rootCmd.Flags().StringArrayVar(&c.Context, "context", nil, "Read-only reference file, directory or glob attached to the prompt with its path, in priority order")
+	rootCmd.Flags().IntVar(&c.ContextMaxTokens, "context-max-tokens", 0, "Max tokens of the context files, truncating and dropping the lower priority ones (0: a quarter of the context window)")
 
 	// Model options
-	rootCmd.Flags().StringVarP(&c.Model, "model", "m", "gpt-4o", "model to use for text generation")
-	rootCmd.Flags().IntVarP(&c.MaxTokens, "max-tokens", "t", 0, "Max tokens to generate")
-	rootCmd.Flags().IntVar(&c.MaxCompletionRepeatCount, "max-completion-repeat-count", 1, "Max completion repeat count")
+	addModelFlags(rootCmd, "Model to use for text generation")
+	addBudgetFlags(rootCmd)
+
+	// Cache options
+	addCacheFlags(rootCmd)
+	rootCmd.Flags().BoolVar(&c.RefreshCache, "refresh-cache", false, "Request the API even when cached and replace the cached responses")
 
 	// Stdout messages options
 	rootCmd.Flags().BoolVarP(&c.DryRun, "dry-run", "D", false, "Dry run")
+	rootCmd.Flags().BoolVar(&c.Estimate, "estimate", false, "Estimate the tokens and cost of each input locally without calling the API")
 	rootCmd.Flags().BoolVarP(&c.Verbose, "verbose", "v", false, "Verbose output")
 	rootCmd.Flags().BoolVarP(&c.Silent, "silent", "s", false, "Suppress output")
 	rootCmd.Flags().BoolVarP(&c.ShowCost, "show-cost", "C", false, "Show cost of the text generation")
+	rootCmd.Flags().StringVar(&c.Report, "report", "", "Write a JSON report of the tokens, cost and duration of each input file to the path")
+	rootCmd.Flags().StringVar(&c.Profile, "profile", os.Getenv("TEXTFORGE_PROFILE"), "Profile name recorded in the usage ledger (env: TEXTFORGE_PROFILE)")
 	rootCmd.Flags().BoolVarP(&c.Diff, "diff", "d", false, "Show diff of the input and output text")
+	rootCmd.Flags().StringVar(&c.DiffFormat, "diff-format", "unified", "Diff format: unified, side-by-side, word, pretty")
+	rootCmd.Flags().IntVar(&c.DiffContext, "diff-context", 3, "Number of context lines in unified diff")
+	rootCmd.Flags().StringVar(&c.PatchOut, "patch-out", "", "Write a combined patch of all processed files to the path")
 
 	// Input file options
 	rootCmd.Flags().StringVarP(&c.InputFileList, "input-file-list", "i", "", "Input file list")
+	rootCmd.Flags().StringVar(&c.GitChanged, "git-changed", "", "Use files changed from the git ref as input (default ref: HEAD)")
+	rootCmd.Flags().Lookup("git-changed").NoOptDefVal = "HEAD"
+	rootCmd.Flags().BoolVar(&c.GitStaged, "git-staged", false, "Use files staged in git as input")
+	rootCmd.Flags().BoolVar(&c.GitUntracked, "git-untracked", false, "Use untracked files not ignored by git as input")
+	rootCmd.Flags().StringArrayVar(&c.Include, "include", nil, "Glob pattern of files to include from directories and git selections")
+	rootCmd.Flags().StringArrayVar(&c.Exclude, "exclude", nil, "Glob pattern of files to exclude from directories and git selections")
+	rootCmd.Flags().Int64Var(&c.MaxFileSize, "max-file-size", 0, "Skip expanded files larger than the size in bytes (0: unlimited)")
+	rootCmd.Flags().IntVar(&c.MaxDepth, "max-depth", 0, "Max directory depth when expanding directories and globs (0: unlimited)")
+	rootCmd.Flags().BoolVar(&c.ListInputs, "list-inputs", false, "Print the resolved input files and exit without calling the API")
+	rootCmd.Flags().BoolVar(&c.Incremental, "incremental", false, "Skip the files unchanged since they were processed with the same prompt and model")
+	rootCmd.Flags().StringVar(&c.StateFile, "state-file", state.DefaultPath, "State file of --incremental")
+	rootCmd.Flags().BoolVar(&c.Force, "force", false, "Process the files even when --incremental would skip them")
+	rootCmd.Flags().BoolVar(&c.ContinueOnError, "continue-on-error", false, "Continue with the next file when processing a file fails, and list the failed files at the end")
 
 	// Debug options
 	rootCmd.Flags().StringVarP(&c.LogAPILevel, "log-api-level", "l", "", "API log level: info, debug")
+	rootCmd.Flags().StringVar(&c.ReplayDir, "replay-dir", "", "Record the API requests and responses as fixtures in the directory and replay them")
+	rootCmd.Flags().StringVar(&c.ReplayMode, "replay-mode", string(httpreplay.ModeAuto), "Replay mode of --replay-dir: auto, record, replay")
+	_ = rootCmd.Flags().MarkHidden("replay-dir")
+	_ = rootCmd.Flags().MarkHidden("replay-mode")
 
 	// Write file options
 	rootCmd.Flags().BoolVarP(&c.Rewrite, "rewrite", "r", false, "Rewrite the input file with the result")
 	rootCmd.Flags().StringVarP(&c.Outpath, "outpath", "o", "", "Output file path")
 	rootCmd.Flags().BoolVarP(&c.UseFirstCodeBlock, "use-first-code-block", "f", false, "Use the first code block in the output text")
+	rootCmd.Flags().StringVar(&c.JSONSchema, "json-schema", "", "Return JSON validated against the JSON schema file, using structured outputs and one repair turn on failure")
+	rootCmd.Flags().BoolVar(&c.JSONObject, "json-object", false, "Request json_object instead of json_schema with --json-schema, for providers without structured outputs")
+	rootCmd.Flags().BoolVar(&c.JSONRaw, "json-raw", false, "Write the JSON as returned instead of pretty-printed with --json-schema")
+	rootCmd.Flags().BoolVar(&c.MultiOutput, "multi-output", false, "Let one response create or modify several files, each returned in an output tag with its path")
 	rootCmd.Flags().BoolVarP(&c.Confirm, "confirm", "c", false, "Confirm before writing to file")
+	rootCmd.Flags().StringVar(&c.GitBranch, "git-branch", "", "Write the results to a new git branch instead of the working tree")
+	rootCmd.Flags().BoolVar(&c.GitStash, "git-stash", false, "Stash the changes in the working tree while using --git-branch")
+	rootCmd.Flags().BoolVar(&c.GitCommitPerFile, "git-commit-per-file", false, "Commit each file separately with --git-branch")
 }
 
 func Execute(version, commit, date, builtBy string) {
+	appVersion = version
 	var sb strings.Builder
 	sb.WriteString(version)
 	sb.WriteString(", commit ")
@@ -90,16 +144,34 @@ func Execute(version, commit, date, builtBy string) {
 	}
 }
 
-func makeGAIFunc(model string) (openai.GenerativeAIClient, error) {
-	apikey, err := getAPIKey()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get API key: %w", err)
+// makeGAIFunc makes the client of the model, generating up to maxTokens (0: the default of the model).
+func makeGAIFunc(model string, maxTokens int) (openai.GenerativeAIClient, error) {
+	var apikey openai.APIKey
+	if !replayOnly() {
+		var err error
+		if apikey, err = getAPIKey(); err != nil {
+			return nil, fmt.Errorf("failed to get API key: %w", err)
+		}
+	}
+	var maxTokensOpt *int
+	if maxTokens > 0 {
+		maxTokensOpt = &maxTokens
 	}
-	var maxTokens *int
-	if c.MaxTokens > 0 {
-		maxTokens = &c.MaxTokens
+	client := openai.New(apikey, model, c.LogAPILevel, maxTokensOpt)
+	client.SetBaseURL(c.BaseURL)
+	if c.ReplayDir != "" {
+		mode, err := httpreplay.ParseMode(c.ReplayMode)
+		if err != nil {
+			return nil, err
+		}
+		client.SetTransport(httpreplay.New(c.ReplayDir, mode, nil))
 	}
-	return openai.New(apikey, model, c.LogAPILevel, maxTokens), nil
+	return client, nil
+}
+
+// replayOnly reports whether the responses come only from the replay fixtures, which needs no API key.
+func replayOnly() bool {
+	return c.ReplayDir != "" && c.ReplayMode == string(httpreplay.ModeReplay)
 }
 
 func readInputFiles(fileName string) ([]string, error) {
@@ -120,12 +192,43 @@ func readInputFiles(fileName string) ([]string, error) {
 	return files, nil
 }
 
-func showCosts(usageCosts []*openai.UsageCost) {
-	totalUsageCost := openai.NewTotalUsageCost(usageCosts)
-	if ok, cost := totalUsageCost.TotalTotalTokensCost(); ok {
-		fmt.Printf("Total cost: $%f\n", cost)
-	} else {
-		fmt.Println("Total cost: unknown")
+// resolveInputFiles expands the arguments, the input file list and the git selectors into input files.
+func resolveInputFiles(args []string) ([]string, error) {
+	paths := args
+	if c.InputFileList != "" {
+		files, err := readInputFiles(c.InputFileList)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, files...)
+	}
+	files, err := inputs.Resolve(paths, &inputs.Options{
+		GitChanged:   c.GitChanged,
+		GitStaged:    c.GitStaged,
+		GitUntracked: c.GitUntracked,
+		Include:      c.Include,
+		Exclude:      c.Exclude,
+		MaxFileSize:  c.MaxFileSize,
+		MaxDepth:     c.MaxDepth,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve input files: %w", err)
+	}
+	return files, nil
+}
+
+// makeCostReport creates the breakdown of the tokens, cost and duration of each processed input file.
+func makeCostReport(inputPaths []string, results []*steps.ShapeResult) *costreport.Report {
+	report := costreport.New(c.Model, promptName(), c.Profile)
+	for i, sr := range results {
+		report.Add(inputPaths[i], openai.NewUsageCost(sr.ChatCompletion), sr.Duration)
+	}
+	return report
+}
+
+func showCosts(report *costreport.Report) {
+	if err := report.WriteTable(os.Stdout); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "failed to show cost: %v\n", err)
 	}
 }
 
@@ -161,7 +264,7 @@ func createProcessingCallbackFunc(enableTUI bool, rawOnAfterProcessing func(stri
 	return onBeforeProcessing, onAfterProcessing
 }
 
-func doRun(ctx context.Context, inputFiles []string, makeGAIFunc func(model string) (openai.GenerativeAIClient, error)) error {
+func doRun(ctx context.Context, inputFiles []string, makeGAIFunc runner.GenerativeAIHandlerFactoryFunc) error {
 	r := runner.New(&c, inputFiles, makeGAIFunc, tui.Confirm)
 	ropt, err := r.Setup()
 	if err != nil {
@@ -169,9 +272,13 @@ func doRun(ctx context.Context, inputFiles []string, makeGAIFunc func(model stri
 	}
 
 	var usageCosts = make([]*openai.UsageCost, 0, len(inputFiles))
-	rawOnAfterProcessing := func(_ string, sr *steps.ShapeResult) {
-		if sr != nil {
+	var usageInputPaths = make([]string, 0, len(inputFiles))
+	var shapeResults = make([]*steps.ShapeResult, 0, len(inputFiles))
+	rawOnAfterProcessing := func(inpath string, sr *steps.ShapeResult) {
+		if sr != nil && sr.ChatCompletion != nil {
 			usageCosts = append(usageCosts, openai.NewUsageCost(sr.ChatCompletion))
+			usageInputPaths = append(usageInputPaths, inpath)
+			shapeResults = append(shapeResults, sr)
 		}
 	}
 
@@ -184,14 +291,24 @@ func doRun(ctx context.Context, inputFiles []string, makeGAIFunc func(model stri
 		return fmt.Errorf("failed to check if stdout is pipe: %w", err)
 	}
 
-	enableTUI := !c.Silent && !stdinPipeAvailable && !stdoutPipeAvailable
+	// The map of --reduce runs in parallel, so the status of one file cannot be shown.
+	enableTUI := !c.Silent && !stdinPipeAvailable && !stdoutPipeAvailable && !c.ReduceEnabled()
 	onBeforeProcessing, onAfterProcessing := createProcessingCallbackFunc(enableTUI, rawOnAfterProcessing)
-	if err := r.Run(ctx, ropt, onBeforeProcessing, onAfterProcessing); err != nil {
+	err = r.Run(ctx, ropt, onBeforeProcessing, onAfterProcessing)
+	recordUsage(promptName(), usageInputPaths, usageCosts)
+	report := makeCostReport(usageInputPaths, shapeResults)
+	if c.Report != "" {
+		// The report is written even when the run failed, so that the spend of the processed files is kept.
+		if rerr := report.WriteJSONFile(c.Report); rerr != nil {
+			err = errors.Join(err, rerr)
+		}
+	}
+	if err != nil {
 		return fmt.Errorf("failed to run: %w", err)
 	}
 
 	if c.ShowCost {
-		showCosts(usageCosts)
+		showCosts(report)
 	}
 
 	return nil
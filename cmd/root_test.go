@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"errors"
+	"flag"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ytka/textforge/internal/httpreplay"
+	"github.com/ytka/textforge/internal/mockserver"
+)
+
+var update = flag.Bool("update", false, "record the replay fixtures with the mock server")
+
+// executeReplay runs the root command with the replay fixtures in testdata/replay and no API key.
+// With -update, the fixtures are recorded with the upper-casing mock server.
+func executeReplay(t *testing.T, args ...string) error {
+	t.Helper()
+	tmp := t.TempDir()
+	for _, name := range []string{"HOME", "XDG_CONFIG_HOME", "XDG_DATA_HOME", "XDG_CACHE_HOME"} {
+		t.Setenv(name, filepath.Join(tmp, name))
+	}
+	mode := httpreplay.ModeReplay
+	if *update {
+		mode = httpreplay.ModeRecord
+		if err := os.MkdirAll(filepath.Dir(getAPIKeyFilePath()), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(getAPIKeyFilePath(), []byte("sk-mock\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		orig := http.DefaultTransport
+		http.DefaultTransport = mockserver.NewTransport(mockserver.New(nil, mockserver.TransformUpper, false))
+		t.Cleanup(func() { http.DefaultTransport = orig })
+	}
+	rootCmd.SetOut(io.Discard)
+	rootCmd.SetErr(io.Discard)
+	rootCmd.SetArgs(append([]string{
+		"--silent", "--replay-dir", "testdata/replay", "--replay-mode", string(mode), "--base-url", "http://textforge.test/v1",
+	}, args...))
+	return rootCmd.Execute()
+}
+
+func TestRootReplay(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out.txt")
+	if err := executeReplay(t, "-p", "Convert to upper case", "-o", out, "testdata/input.txt"); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "HELLO, WORLD\n"; string(data) != want {
+		t.Errorf("output = %q, want %q", data, want)
+	}
+	if entries, err := os.ReadDir(filepath.Join(os.Getenv("XDG_CACHE_HOME"), "textforge")); err == nil && len(entries) > 0 {
+		t.Errorf("response cache has %d entries, want none with --replay-dir", len(entries))
+	}
+}
+
+func TestRootReplayFixtureNotFound(t *testing.T) {
+	if *update {
+		t.Skip("no fixture is recorded for the missing request")
+	}
+	out := filepath.Join(t.TempDir(), "out.txt")
+	err := executeReplay(t, "-p", "A prompt without a fixture", "-o", out, "testdata/input.txt")
+	if !errors.Is(err, httpreplay.ErrFixtureNotFound) {
+		t.Errorf("Execute() error = %v, want %v", err, httpreplay.ErrFixtureNotFound)
+	}
+	if _, err := os.Stat(out); !os.IsNotExist(err) {
+		t.Errorf("output written without a fixture: %v", err)
+	}
+}
@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/ytka/textforge/internal/openai"
+	"github.com/ytka/textforge/internal/pipeline"
+)
+
+var runCmd = &cobra.Command{
+	Use:   "run <pipeline.yaml> [flags] [input files...]",
+	Short: "Run a pipeline of prompts on the input files",
+	Long: "Run the steps of the pipeline file on each input file in order. Each step shapes the text with its prompt and model,\n" +
+		"and feeds the output to the next step as the input or as a variable. Steps can be skipped by check commands.",
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(_ *cobra.Command, args []string) error {
+		return runPipeline(context.Background(), args[0], args[1:])
+	},
+}
+
+func init() {
+	addModelFlags(runCmd, "Model of the steps without a model")
+	runCmd.Flags().BoolVarP(&c.PromptOptimize, "prompt-optimize", "O", true, "Optimize prompt text")
+	addBudgetFlags(runCmd)
+	addCacheFlags(runCmd)
+	runCmd.Flags().BoolVar(&c.RefreshCache, "refresh-cache", false, "Request the API even when cached and replace the cached responses")
+	runCmd.Flags().BoolVarP(&c.DryRun, "dry-run", "D", false, "Print the steps for each input file without calling the API")
+	runCmd.Flags().BoolVarP(&c.ShowCost, "show-cost", "C", false, "Show the cost of each step")
+	runCmd.Flags().StringVar(&c.Report, "report", "", "Write a JSON report of the cost of each step to the path")
+	runCmd.Flags().StringVar(&c.Profile, "profile", os.Getenv("TEXTFORGE_PROFILE"), "Profile name recorded in the usage ledger (env: TEXTFORGE_PROFILE)")
+	runCmd.Flags().BoolVarP(&c.Silent, "silent", "s", false, "Suppress output")
+	runCmd.Flags().BoolVarP(&c.Verbose, "verbose", "v", false, "Verbose output")
+	runCmd.Flags().StringVarP(&c.LogAPILevel, "log-api-level", "l", "", "API log level: info, debug")
+	rootCmd.AddCommand(runCmd)
+}
+
+func runPipeline(ctx context.Context, pipelinePath string, args []string) error {
+	p, err := pipeline.Load(pipelinePath)
+	if err != nil {
+		return err
+	}
+	inputFiles, err := resolveInputFiles(args)
+	if err != nil {
+		return err
+	}
+	if !c.DryRun && !checkAPIKeyFileExists() {
+		return fmt.Errorf("%w: %s", ErrorAPIKeyFileNotFound, getAPIKeyFilePath())
+	}
+
+	executor := pipeline.NewExecutor(p, &c, makeGAIFunc, func(s *pipeline.Step, inputPath string, uc *openai.UsageCost) {
+		recordUsage(p.Name+"/"+s.Name, []string{inputPath}, []*openai.UsageCost{uc})
+	})
+	report, runErr := executor.Run(ctx, inputFiles)
+	if c.DryRun {
+		return runErr
+	}
+	if c.ShowCost {
+		if err := report.WriteTable(os.Stdout); err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "failed to show cost: %v\n", err)
+		}
+	}
+	if c.Report != "" {
+		if err := report.WriteJSONFile(c.Report); err != nil {
+			return errors.Join(runErr, err)
+		}
+	}
+	return runErr
+}
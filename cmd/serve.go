@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/ytka/textforge/internal/openai"
+	"github.com/ytka/textforge/internal/prompts"
+	"github.com/ytka/textforge/internal/server"
+)
+
+var (
+	serveOpts struct {
+		host          string
+		port          int
+		token         string
+		maxConcurrent int
+		promptsDir    string
+		root          string
+	}
+
+	serveCmd = &cobra.Command{
+		Use:   "serve",
+		Short: "Serve a local REST API for shaping text",
+		Long: "Serve POST /shape, which shapes the input text with the prompt or the prompt name in the prompts directory,\n" +
+			"and responds with the result, the diff stats and the cost. GET /prompts lists the prompt names.\n" +
+			"Set --token or TEXTFORGE_SERVE_TOKEN to require it as the bearer token.",
+		Args: cobra.NoArgs,
+		RunE: func(_ *cobra.Command, _ []string) error {
+			return runServe()
+		},
+	}
+)
+
+func init() {
+	serveCmd.Flags().StringVar(&serveOpts.host, "host", "127.0.0.1", "Host to listen on")
+	serveCmd.Flags().IntVar(&serveOpts.port, "port", 8787, "Port to listen on")
+	serveCmd.Flags().StringVar(&serveOpts.token, "token", os.Getenv("TEXTFORGE_SERVE_TOKEN"), "Bearer token required by the requests (env: TEXTFORGE_SERVE_TOKEN)")
+	serveCmd.Flags().IntVar(&serveOpts.maxConcurrent, "max-concurrent", 2, "Max number of requests to the API at a time")
+	serveCmd.Flags().StringVar(&serveOpts.promptsDir, "prompts-dir", "prompts", "Directory of the prompt files for prompt_name")
+	serveCmd.Flags().StringVar(&serveOpts.root, "root", ".", "Directory the file_path of the requests is read from, rejecting paths outside it (empty: file_path is not allowed)")
+
+	// Defaults of the requests
+	addModelFlags(serveCmd, "Default model to use for text generation")
+	serveCmd.Flags().BoolVarP(&c.PromptOptimize, "prompt-optimize", "O", true, "Optimize prompt text by default")
+	serveCmd.Flags().BoolVarP(&c.UseFirstCodeBlock, "use-first-code-block", "f", false, "Use the first code block in the output text by default")
+	serveCmd.Flags().StringVar(&c.DiffFormat, "diff-format", "unified", "Default diff format: unified, side-by-side, word, pretty")
+	serveCmd.Flags().IntVar(&c.DiffContext, "diff-context", 3, "Default number of context lines in unified diff")
+	addCacheFlags(serveCmd)
+	serveCmd.Flags().StringVar(&c.Profile, "profile", os.Getenv("TEXTFORGE_PROFILE"), "Profile name recorded in the usage ledger (env: TEXTFORGE_PROFILE)")
+	serveCmd.Flags().StringVarP(&c.LogAPILevel, "log-api-level", "l", "", "API log level: info, debug")
+	rootCmd.AddCommand(serveCmd)
+}
+
+func runServe() error {
+	if _, err := getAPIKey(); err != nil {
+		return fmt.Errorf("failed to get API key: %w", err)
+	}
+
+	addr := net.JoinHostPort(serveOpts.host, strconv.Itoa(serveOpts.port))
+	srv := &http.Server{
+		Addr: addr,
+		Handler: server.New(server.Options{
+			Token:         serveOpts.token,
+			MaxConcurrent: serveOpts.maxConcurrent,
+			Defaults:      c,
+			Root:          serveOpts.root,
+			Library:       prompts.NewLibrary(serveOpts.promptsDir),
+			GAIFactory:    makeGAIFunc,
+			OnUsage: func(prompt, inputPath string, uc *openai.UsageCost) {
+				recordUsage(prompt, []string{inputPath}, []*openai.UsageCost{uc})
+			},
+		}),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	if serveOpts.token == "" && !isLoopback(serveOpts.host) {
+		_, _ = fmt.Fprintln(os.Stderr, "warning: serving without --token on a non-loopback address")
+	}
+	fmt.Printf("textforge API listening on http://%s\n", addr)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("failed to serve: %w", err)
+	}
+	return nil
+}
+
+// isLoopback reports whether the host is only reachable from the local machine.
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
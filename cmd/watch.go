@@ -0,0 +1,199 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/ytka/textforge/internal/ioutil"
+	"github.com/ytka/textforge/internal/openai"
+	"github.com/ytka/textforge/internal/steps"
+	"github.com/ytka/textforge/internal/tui"
+	"github.com/ytka/textforge/internal/watch"
+)
+
+// ErrOutpathRequired is an error when watch has no outpath.
+var ErrOutpathRequired = errors.New("outpath is required")
+
+var (
+	watchOpts struct {
+		debounce time.Duration
+	}
+
+	watchCmd = &cobra.Command{
+		Use:   "watch [flags] <file|dir>...",
+		Short: "Re-shape files on save",
+		Long: "Watch the input files and directories, and re-run the prompt on each change, writing the result to the outpath.\n" +
+			"The outpath is a Go template of the input path: {{.Path}}, {{.Dir}}, {{.Base}}, {{.Stem}} and {{.Ext}},\n" +
+			"with the functions trimSuffix and replace, e.g. '{{.Dir}}/{{trimSuffix \".ja\" .Stem}}{{.Ext}}'.\n" +
+			"The outputs of the files in the watched directories are not taken as inputs. Press q to quit.",
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			return runWatch(args)
+		},
+	}
+)
+
+func init() {
+	watchCmd.Flags().DurationVar(&watchOpts.debounce, "debounce", 500*time.Millisecond, "Wait for the duration without changes before running")
+	watchCmd.Flags().StringVarP(&c.Outpath, "outpath", "o", "", "Output file path template")
+
+	watchCmd.Flags().StringVarP(&c.Prompt, "prompt", "p", "", "Prompt text")
+	watchCmd.Flags().StringVarP(&c.PromptPath, "prompt-path", "P", "", "Prompt file path")
+	watchCmd.Flags().BoolVarP(&c.PromptOptimize, "prompt-optimize", "O", true, "Optimize prompt text")
+	addModelFlags(watchCmd, "Model to use for text generation")
+	watchCmd.Flags().BoolVarP(&c.UseFirstCodeBlock, "use-first-code-block", "f", false, "Use the first code block in the output text")
+	addCacheFlags(watchCmd)
+	watchCmd.Flags().StringVar(&c.Profile, "profile", os.Getenv("TEXTFORGE_PROFILE"), "Profile name recorded in the usage ledger (env: TEXTFORGE_PROFILE)")
+	watchCmd.Flags().BoolVarP(&c.Silent, "silent", "s", false, "Suppress output")
+	watchCmd.Flags().BoolVarP(&c.Verbose, "verbose", "v", false, "Verbose output")
+	rootCmd.AddCommand(watchCmd)
+}
+
+func runWatch(paths []string) error {
+	if err := c.Validate(nil); err != nil {
+		return err
+	}
+	if c.Outpath == "" {
+		return ErrOutpathRequired
+	}
+	outpath, err := steps.ParseOutpathTemplate(c.Outpath)
+	if err != nil {
+		return err
+	}
+	if outpath.Static() && (len(paths) > 1 || isDir(paths[0])) {
+		return steps.ErrOutpathNotTemplated
+	}
+	if _, err := getAPIKey(); err != nil {
+		return fmt.Errorf("failed to get API key: %w", err)
+	}
+	promptText, err := steps.GetPromptText(c.Prompt, c.PromptPath)
+	if err != nil {
+		return err
+	}
+	session, err := watch.NewSession(&c, promptText, outpath, makeGAIFunc)
+	if err != nil {
+		return err
+	}
+	if err := session.ScanOutputs(paths); err != nil {
+		return err
+	}
+	watcher, err := watch.NewWatcher(paths, watchOpts.debounce)
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	ui := newWatchUI(ctx, stop, fmt.Sprintf("Watching %d paths", len(paths)))
+	defer ui.close()
+
+	err = watcher.Watch(ctx, func(path string) {
+		ui.status(fmt.Sprintf("Processing... [%s] %s", path, sessionSummary(session)))
+		res, err := session.Process(ctx, path)
+		switch {
+		case err != nil:
+			ui.println(fmt.Sprintf("error: %s: %v", path, err))
+		case res.Skipped:
+			if c.Verbose {
+				ui.println(fmt.Sprintf("skipped: %s is an output", path))
+			}
+		default:
+			recordUsage(promptName(), []string{path}, []*openai.UsageCost{res.UsageCost})
+			ui.println(fmt.Sprintf("%s %s -> %s (%s, %s)", time.Now().Format(time.TimeOnly), path, res.Outpath,
+				res.Duration.Round(time.Millisecond), formatCost(res.UsageCost.TotalTokensCost())))
+		}
+		ui.status(fmt.Sprintf("Watching %d paths %s", len(paths), sessionSummary(session)))
+	})
+	ui.close()
+	if !c.Silent {
+		fmt.Printf("Session: %s\n", sessionSummary(session))
+	}
+	return err
+}
+
+// sessionSummary returns the number of the runs and the cumulative cost of the session.
+func sessionSummary(s *watch.Session) string {
+	runs, cost, unknown := s.Summary()
+	summary := fmt.Sprintf("[%d runs, $%.6f", runs, cost)
+	if unknown > 0 {
+		summary += fmt.Sprintf(" + %d unknown", unknown)
+	}
+	return summary + "]"
+}
+
+func formatCost(ok bool, cost float64) string {
+	if !ok {
+		return "cost unknown"
+	}
+	return fmt.Sprintf("$%.6f", cost)
+}
+
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// watchUI shows the live status line on a terminal, or prints the messages to stderr otherwise.
+type watchUI struct {
+	statusUI *tui.StatusUI
+	wg       sync.WaitGroup
+	once     sync.Once
+}
+
+// newWatchUI starts the status line. Quitting it calls stop.
+func newWatchUI(ctx context.Context, stop func(), initialMessage string) *watchUI {
+	ui := &watchUI{}
+	if c.Silent {
+		return ui
+	}
+	if terminal, _ := ioutil.IsTerminal(os.Stdout); !terminal {
+		_, _ = fmt.Fprintln(os.Stderr, initialMessage)
+		return ui
+	}
+	ui.statusUI = tui.NewStatusUI(initialMessage)
+	ui.wg.Add(1)
+	go func() {
+		defer ui.wg.Done()
+		if err := ui.statusUI.Run(); err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "failed to run status UI: %v\n", err)
+		}
+		stop()
+	}()
+	go func() {
+		<-ctx.Done()
+		ui.close()
+	}()
+	return ui
+}
+
+func (ui *watchUI) status(text string) {
+	if ui.statusUI != nil {
+		ui.statusUI.UpdateStatusText(text)
+	}
+}
+
+func (ui *watchUI) println(text string) {
+	switch {
+	case ui.statusUI != nil:
+		ui.statusUI.Println(text)
+	case !c.Silent:
+		_, _ = fmt.Fprintln(os.Stderr, text)
+	}
+}
+
+func (ui *watchUI) close() {
+	if ui.statusUI == nil {
+		return
+	}
+	ui.once.Do(func() {
+		ui.statusUI.Quit()
+		ui.wg.Wait()
+	})
+}
@@ -0,0 +1,86 @@
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ytka/textforge/internal/openai"
+)
+
+// Client is a GenerativeAIClient that serves the completions of identical requests from the store.
+type Client struct {
+	gai     openai.GenerativeAIClient
+	store   *Store
+	refresh bool
+	baseURL string
+}
+
+var _ openai.GenerativeAIClient = (*Client)(nil)
+
+// NewClient wraps gai with the store. With refresh, the cached completions are not read but replaced.
+// The base URL of the API is part of the keys so that the completions of a mock server or another provider are kept apart.
+func NewClient(gai openai.GenerativeAIClient, store *Store, refresh bool, baseURL string) *Client {
+	return &Client{gai: gai, store: store, refresh: refresh, baseURL: baseURL}
+}
+
+// MakeCreateChatCompletion creates a new CreateChatCompletion with the wrapped client.
+func (c *Client) MakeCreateChatCompletion(prompt string) *openai.CreateChatCompletion {
+	return c.gai.MakeCreateChatCompletion(prompt)
+}
+
+// RequestCreateChatCompletion returns the cached completion of the request, or requests it and caches the result.
+func (c *Client) RequestCreateChatCompletion(ctx context.Context, ccc *openai.CreateChatCompletion) (*openai.ChatCompletion, error) {
+	key, err := Key(c.baseURL, ccc)
+	if err != nil {
+		return nil, err
+	}
+	if !c.refresh {
+		data, ok, err := c.store.Get(key)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			var comp openai.ChatCompletion
+			if err := json.Unmarshal(data, &comp); err == nil {
+				comp.FromCache = true
+				return &comp, nil
+			}
+			// A broken entry is treated as a miss and replaced below.
+		}
+	}
+
+	comp, err := c.gai.RequestCreateChatCompletion(ctx, ccc)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(comp)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal completion: %w", err)
+	}
+	// The completion is already paid for, so a failure to cache it is only reported.
+	if err := c.store.Put(key, data); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "warning: failed to cache completion: %v\n", err)
+	}
+	return comp, nil
+}
+
+// Key returns the cache key of the request to the API at the base URL, the hash of the URL and the serialized request including the model and the parameters.
+// Empty baseURL is the OpenAI API.
+func Key(baseURL string, ccc *openai.CreateChatCompletion) (string, error) {
+	data, err := json.Marshal(ccc)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal request: %w", err)
+	}
+	if baseURL == "" {
+		baseURL = openai.DefaultBaseURL
+	}
+	h := sha256.New()
+	h.Write([]byte(strings.TrimSuffix(baseURL, "/") + "\n"))
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,86 @@
+package cache
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ytka/textforge/internal/openai"
+)
+
+// countingClient answers every request with the same completion and counts the requests.
+type countingClient struct {
+	requests int
+}
+
+func (c *countingClient) MakeCreateChatCompletion(prompt string) *openai.CreateChatCompletion {
+	return &openai.CreateChatCompletion{Model: "gpt-4o", Messages: []openai.ChatMessage{{Role: "user", Content: prompt}}}
+}
+
+func (c *countingClient) RequestCreateChatCompletion(context.Context, *openai.CreateChatCompletion) (*openai.ChatCompletion, error) {
+	c.requests++
+	comp := &openai.ChatCompletion{Model: "gpt-4o"}
+	comp.Usage.PromptTokens, comp.Usage.CompletionTokens, comp.Usage.TotalTokens = 1000, 100, 1100
+	return comp, nil
+}
+
+func TestClientRequestCreateChatCompletion(t *testing.T) {
+	store := NewStore(t.TempDir(), 0, 0)
+	gai := &countingClient{}
+	ctx := context.Background()
+	request := func(c *Client, prompt string) *openai.ChatCompletion {
+		t.Helper()
+		comp, err := c.RequestCreateChatCompletion(ctx, c.MakeCreateChatCompletion(prompt))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return comp
+	}
+
+	c := NewClient(gai, store, false, "")
+	if comp := request(c, "hello"); comp.FromCache {
+		t.Error("first request was served from the cache")
+	}
+	comp := request(c, "hello")
+	if !comp.FromCache || gai.requests != 1 {
+		t.Errorf("second request: FromCache = %v, requests = %d, want a cache hit", comp.FromCache, gai.requests)
+	}
+	uc := openai.NewUsageCost(comp)
+	if ok, cost := uc.TotalTokensCost(); !ok || cost != 0 {
+		t.Errorf("TotalTokensCost() of a cache hit = %v, %f, want 0", ok, cost)
+	}
+	if uc.PromptTokens() != 1000 {
+		t.Errorf("PromptTokens() of a cache hit = %d, want the cached usage", uc.PromptTokens())
+	}
+
+	request(c, "other")
+	if gai.requests != 2 {
+		t.Errorf("requests = %d, want another prompt to miss", gai.requests)
+	}
+	request(NewClient(gai, store, false, "http://localhost:8080/v1"), "hello")
+	if gai.requests != 3 {
+		t.Errorf("requests = %d, want another base URL to miss", gai.requests)
+	}
+	if comp := request(NewClient(gai, store, true, ""), "hello"); comp.FromCache || gai.requests != 4 {
+		t.Errorf("refresh: FromCache = %v, requests = %d, want a request", comp.FromCache, gai.requests)
+	}
+}
+
+func TestKey(t *testing.T) {
+	ccc := &openai.CreateChatCompletion{Model: "gpt-4o", Messages: []openai.ChatMessage{{Role: "user", Content: "hello"}}}
+	key := func(baseURL string, ccc *openai.CreateChatCompletion) string {
+		t.Helper()
+		k, err := Key(baseURL, ccc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return k
+	}
+	if key("", ccc) != key(openai.DefaultBaseURL+"/", ccc) {
+		t.Error("empty base URL and the default base URL have different keys")
+	}
+	other := *ccc
+	other.Model = "gpt-4o-mini"
+	if key("", ccc) == key("", &other) {
+		t.Error("different models have the same key")
+	}
+}
@@ -0,0 +1,201 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ytka/textforge/internal/ioutil"
+)
+
+// entryExt is the extension of the cache entry files.
+const entryExt = ".json"
+
+// Store is an on-disk key-value cache. Each entry is a file named by its key.
+// Entries older than the TTL are ignored, and the oldest entries are evicted when the total size exceeds the max size.
+type Store struct {
+	dir     string
+	ttl     time.Duration
+	maxSize int64
+}
+
+// Stats holds the statistics of the cache.
+type Stats struct {
+	Dir     string
+	Entries int
+	Expired int
+	Size    int64
+	Oldest  time.Time
+	Newest  time.Time
+}
+
+type entryFile struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// DefaultDir returns the directory of the response cache in the cache directory.
+func DefaultDir() (string, error) {
+	dir, err := ioutil.CacheDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get cache directory: %w", err)
+	}
+	return filepath.Join(dir, "responses"), nil
+}
+
+// NewStore creates a store in dir. A ttl or maxSize of zero is unlimited.
+func NewStore(dir string, ttl time.Duration, maxSize int64) *Store {
+	return &Store{dir: dir, ttl: ttl, maxSize: maxSize}
+}
+
+func (s *Store) path(key string) string {
+	return filepath.Join(s.dir, key[:2], key+entryExt)
+}
+
+// expired reports whether an entry written at modTime is older than the TTL.
+func (s *Store) expired(modTime time.Time) bool {
+	return s.ttl > 0 && time.Since(modTime) > s.ttl
+}
+
+// Get returns the data of the key. Missing and expired entries are reported as false.
+func (s *Store) Get(key string) ([]byte, bool, error) {
+	path := s.path(key)
+	info, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to stat cache entry: %w", err)
+	}
+	if s.expired(info.ModTime()) {
+		return nil, false, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read cache entry: %w", err)
+	}
+	return data, true, nil
+}
+
+// Put writes the data of the key and evicts entries over the limits.
+func (s *Store) Put(key string, data []byte) error {
+	path := s.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	// Write to a temporary file first so that a concurrent reader never sees a partial entry.
+	tmp, err := os.CreateTemp(filepath.Dir(path), "tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create cache entry: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	return s.prune()
+}
+
+// entries lists the entry files in the store.
+func (s *Store) entries() ([]entryFile, error) {
+	var files []entryFile
+	err := filepath.WalkDir(s.dir, func(path string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(d.Name(), entryExt) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil //nolint:nilerr // the entry was removed concurrently
+		}
+		files = append(files, entryFile{path: path, size: info.Size(), modTime: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list cache entries: %w", err)
+	}
+	return files, nil
+}
+
+// prune removes the expired entries, then the oldest entries until the total size fits in the max size.
+func (s *Store) prune() error {
+	if s.ttl <= 0 && s.maxSize <= 0 {
+		return nil
+	}
+	files, err := s.entries()
+	if err != nil {
+		return err
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].modTime.Before(files[j].modTime)
+	})
+	var total int64
+	for _, f := range files {
+		total += f.size
+	}
+	for _, f := range files {
+		if !s.expired(f.modTime) && (s.maxSize <= 0 || total <= s.maxSize) {
+			break
+		}
+		if err := os.Remove(f.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to remove cache entry: %w", err)
+		}
+		total -= f.size
+	}
+	return nil
+}
+
+// Stats returns the statistics of the cache.
+func (s *Store) Stats() (*Stats, error) {
+	files, err := s.entries()
+	if err != nil {
+		return nil, err
+	}
+	stats := &Stats{Dir: s.dir}
+	for _, f := range files {
+		stats.Entries++
+		stats.Size += f.size
+		if s.expired(f.modTime) {
+			stats.Expired++
+		}
+		if stats.Oldest.IsZero() || f.modTime.Before(stats.Oldest) {
+			stats.Oldest = f.modTime
+		}
+		if f.modTime.After(stats.Newest) {
+			stats.Newest = f.modTime
+		}
+	}
+	return stats, nil
+}
+
+// Clear removes all the entries and returns the number removed.
+func (s *Store) Clear() (int, error) {
+	files, err := s.entries()
+	if err != nil {
+		return 0, err
+	}
+	for _, f := range files {
+		if err := os.Remove(f.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return 0, fmt.Errorf("failed to remove cache entry: %w", err)
+		}
+	}
+	return len(files), nil
+}
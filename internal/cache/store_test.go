@@ -0,0 +1,104 @@
+package cache
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// age makes the entry of the key look written d ago.
+func age(t *testing.T, s *Store, key string, d time.Duration) {
+	t.Helper()
+	at := time.Now().Add(-d)
+	if err := os.Chtimes(s.path(key), at, at); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStoreGetPut(t *testing.T) {
+	s := NewStore(t.TempDir(), 0, 0)
+	if _, ok, err := s.Get("aa01"); ok || err != nil {
+		t.Fatalf("Get() of a missing key = %v, %v, want a miss", ok, err)
+	}
+	if err := s.Put("aa01", []byte("data")); err != nil {
+		t.Fatal(err)
+	}
+	data, ok, err := s.Get("aa01")
+	if err != nil || !ok || string(data) != "data" {
+		t.Errorf("Get() = %q, %v, %v, want data", data, ok, err)
+	}
+}
+
+func TestStoreTTL(t *testing.T) {
+	s := NewStore(t.TempDir(), time.Hour, 0)
+	for _, key := range []string{"aa01", "bb02"} {
+		if err := s.Put(key, []byte(key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	age(t, s, "aa01", 2*time.Hour)
+
+	if _, ok, _ := s.Get("aa01"); ok {
+		t.Error("Get() returned an expired entry")
+	}
+	if _, ok, _ := s.Get("bb02"); !ok {
+		t.Error("Get() missed a fresh entry")
+	}
+	stats, err := s.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Entries != 2 || stats.Expired != 1 {
+		t.Errorf("Stats() = %+v, want 2 entries with 1 expired", stats)
+	}
+
+	// The next write prunes the expired entry.
+	if err := s.Put("cc03", []byte("cc03")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(s.path("aa01")); !os.IsNotExist(err) {
+		t.Errorf("expired entry was not pruned: %v", err)
+	}
+}
+
+func TestStoreMaxSize(t *testing.T) {
+	s := NewStore(t.TempDir(), 0, 25)
+	keys := []string{"aa01", "bb02", "cc03"}
+	for i, key := range keys {
+		if err := s.Put(key, []byte(strings.Repeat("x", 10))); err != nil {
+			t.Fatal(err)
+		}
+		age(t, s, key, time.Duration(len(keys)-i)*time.Minute)
+	}
+	// The third entry exceeds 25 bytes, so the oldest one was evicted.
+	want := map[string]bool{"aa01": false, "bb02": true, "cc03": true}
+	for key, wantOK := range want {
+		if _, ok, _ := s.Get(key); ok != wantOK {
+			t.Errorf("Get(%q) ok = %v, want %v", key, ok, wantOK)
+		}
+	}
+	stats, err := s.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Entries != 2 || stats.Size != 20 {
+		t.Errorf("Stats() = %+v, want 2 entries of 20 bytes", stats)
+	}
+}
+
+func TestStoreClear(t *testing.T) {
+	s := NewStore(t.TempDir(), 0, 0)
+	for _, key := range []string{"aa01", "bb02"} {
+		if err := s.Put(key, []byte(key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	n, err := s.Clear()
+	if err != nil || n != 2 {
+		t.Fatalf("Clear() = %d, %v, want 2", n, err)
+	}
+	if _, ok, _ := s.Get("aa01"); ok {
+		t.Error("Get() returned a cleared entry")
+	}
+}
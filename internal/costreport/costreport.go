@@ -0,0 +1,153 @@
+package costreport
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/ytka/textforge/internal/ioutil"
+	"github.com/ytka/textforge/internal/openai"
+)
+
+// FileCost is the usage and the cost of the request for one input file.
+// The costs are nil when the pricing of the model is unknown.
+type FileCost struct {
+	InputPath        string        `json:"input_path"`
+	Model            string        `json:"model,omitempty"`
+	PromptTokens     int           `json:"prompt_tokens"`
+	CompletionTokens int           `json:"completion_tokens"`
+	CachedTokens     int           `json:"cached_tokens"`
+	ReasoningTokens  int           `json:"reasoning_tokens"`
+	TotalTokens      int           `json:"total_tokens"`
+	FromCache        bool          `json:"from_cache,omitempty"`
+	PromptCost       *float64      `json:"prompt_cost_usd"`
+	CompletionCost   *float64      `json:"completion_cost_usd"`
+	TotalCost        *float64      `json:"total_cost_usd"`
+	Duration         time.Duration `json:"-"`
+	DurationMS       int64         `json:"duration_ms"`
+}
+
+// Report is the breakdown of the usage and the cost of a run.
+type Report struct {
+	Model   string     `json:"model"`
+	Prompt  string     `json:"prompt,omitempty"`
+	Profile string     `json:"profile,omitempty"`
+	Files   []FileCost `json:"files"`
+	Total   FileCost   `json:"total"`
+}
+
+// New creates a report for the requested model.
+func New(model, prompt, profile string) *Report {
+	return &Report{Model: model, Prompt: prompt, Profile: profile, Files: []FileCost{}, Total: FileCost{InputPath: "TOTAL"}}
+}
+
+// Add adds the usage of the request for the input file.
+func (r *Report) Add(inputPath string, uc *openai.UsageCost, duration time.Duration) {
+	f := FileCost{
+		InputPath:        inputPath,
+		Model:            uc.ModelName(),
+		PromptTokens:     uc.PromptTokens(),
+		CompletionTokens: uc.CompletionTokens(),
+		CachedTokens:     uc.CachedTokens(),
+		ReasoningTokens:  uc.ReasoningTokens(),
+		TotalTokens:      uc.TotalTokens(),
+		FromCache:        uc.FromCache(),
+		Duration:         duration,
+		DurationMS:       duration.Milliseconds(),
+	}
+	okPrompt, promptCost := uc.PromptTokensCost()
+	okCompletion, completionCost := uc.CompletionTokensCost()
+	if okPrompt && okCompletion {
+		f.PromptCost, f.CompletionCost = &promptCost, &completionCost
+		totalCost := promptCost + completionCost
+		f.TotalCost = &totalCost
+	}
+	r.Files = append(r.Files, f)
+	r.Total.add(f, len(r.Files) == 1)
+}
+
+// add accumulates f. The total cost becomes unknown once any file has an unknown cost.
+func (t *FileCost) add(f FileCost, first bool) {
+	t.PromptTokens += f.PromptTokens
+	t.CompletionTokens += f.CompletionTokens
+	t.CachedTokens += f.CachedTokens
+	t.ReasoningTokens += f.ReasoningTokens
+	t.TotalTokens += f.TotalTokens
+	t.Duration += f.Duration
+	t.DurationMS = t.Duration.Milliseconds()
+	if f.TotalCost == nil {
+		t.PromptCost, t.CompletionCost, t.TotalCost = nil, nil, nil
+		return
+	}
+	if first {
+		t.PromptCost, t.CompletionCost, t.TotalCost = new(float64), new(float64), new(float64)
+	}
+	if t.TotalCost != nil {
+		*t.PromptCost += *f.PromptCost
+		*t.CompletionCost += *f.CompletionCost
+		*t.TotalCost += *f.TotalCost
+	}
+}
+
+var tableHeader = []string{"FILE", "PROMPT", "COMPLETION", "CACHED", "PROMPT COST", "COMPLETION COST", "COST", "DURATION"}
+
+func (f *FileCost) fields() []string {
+	name := f.InputPath
+	if f.FromCache {
+		name += " (cached)"
+	}
+	return []string{
+		name,
+		strconv.Itoa(f.PromptTokens),
+		strconv.Itoa(f.CompletionTokens),
+		strconv.Itoa(f.CachedTokens),
+		formatCost(f.PromptCost),
+		formatCost(f.CompletionCost),
+		formatCost(f.TotalCost),
+		f.Duration.Round(time.Millisecond).String(),
+	}
+}
+
+// formatCost formats the cost in dollars, or "unknown" without pricing.
+func formatCost(cost *float64) string {
+	if cost == nil {
+		return "unknown"
+	}
+	return fmt.Sprintf("$%f", *cost)
+}
+
+// WriteTable writes one row per input file and the total as an aligned table.
+func (r *Report) WriteTable(w io.Writer) error {
+	lines := [][]string{tableHeader}
+	for _, f := range r.Files {
+		lines = append(lines, f.fields())
+	}
+	lines = append(lines, r.Total.fields())
+	return ioutil.WriteTable(w, lines)
+}
+
+// WriteJSON writes the report as indented JSON.
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(r); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	return nil
+}
+
+// WriteJSONFile writes the report as JSON to path.
+func (r *Report) WriteJSONFile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create report file: %w", err)
+	}
+	if err := r.WriteJSON(f); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
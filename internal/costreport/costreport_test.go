@@ -0,0 +1,119 @@
+package costreport
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ytka/textforge/internal/openai"
+)
+
+func usageCost(model string, promptTokens, completionTokens int, fromCache bool) *openai.UsageCost {
+	cc := &openai.ChatCompletion{Model: model, FromCache: fromCache}
+	cc.Usage.PromptTokens = promptTokens
+	cc.Usage.CompletionTokens = completionTokens
+	cc.Usage.TotalTokens = promptTokens + completionTokens
+	return openai.NewUsageCost(cc)
+}
+
+func TestReportAdd(t *testing.T) {
+	tests := []struct {
+		name      string
+		usages    []*openai.UsageCost
+		wantFile  []string
+		wantTotal string
+		wantCache []bool
+	}{
+		{
+			name:      "known pricing",
+			usages:    []*openai.UsageCost{usageCost("gpt-4o", 1_000_000, 100_000, false), usageCost("gpt-4o", 400_000, 0, false)},
+			wantFile:  []string{"$3.500000", "$1.000000"},
+			wantTotal: "$4.500000",
+			wantCache: []bool{false, false},
+		},
+		{
+			name:      "response cache costs nothing",
+			usages:    []*openai.UsageCost{usageCost("gpt-4o", 1_000_000, 100_000, true), usageCost("gpt-4o", 400_000, 0, false)},
+			wantFile:  []string{"$0.000000", "$1.000000"},
+			wantTotal: "$1.000000",
+			wantCache: []bool{true, false},
+		},
+		{
+			name:      "unknown pricing makes the total unknown",
+			usages:    []*openai.UsageCost{usageCost("gpt-4o", 400_000, 0, false), usageCost("unknown-model", 100, 10, false)},
+			wantFile:  []string{"$1.000000", "unknown"},
+			wantTotal: "unknown",
+			wantCache: []bool{false, false},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := New("gpt-4o", "", "")
+			for i, uc := range tt.usages {
+				r.Add(string(rune('a'+i))+".txt", uc, time.Second)
+			}
+			for i, f := range r.Files {
+				if got := formatCost(f.TotalCost); got != tt.wantFile[i] {
+					t.Errorf("Files[%d].TotalCost = %s, want %s", i, got, tt.wantFile[i])
+				}
+				if f.FromCache != tt.wantCache[i] {
+					t.Errorf("Files[%d].FromCache = %v, want %v", i, f.FromCache, tt.wantCache[i])
+				}
+			}
+			if got := formatCost(r.Total.TotalCost); got != tt.wantTotal {
+				t.Errorf("Total.TotalCost = %s, want %s", got, tt.wantTotal)
+			}
+			if r.Total.PromptTokens != tt.usages[0].PromptTokens()+tt.usages[1].PromptTokens() {
+				t.Errorf("Total.PromptTokens = %d", r.Total.PromptTokens)
+			}
+			if r.Total.DurationMS != 2000 {
+				t.Errorf("Total.DurationMS = %d, want 2000", r.Total.DurationMS)
+			}
+		})
+	}
+}
+
+func TestReportWriteTable(t *testing.T) {
+	r := New("gpt-4o", "", "")
+	r.Add("a.txt", usageCost("gpt-4o", 400_000, 0, true), time.Second)
+	r.Add("b.txt", usageCost("unknown-model", 100, 10, false), time.Second)
+
+	var buf bytes.Buffer
+	if err := r.WriteTable(&buf); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("WriteTable() lines = %d, want 4:\n%s", len(lines), buf.String())
+	}
+	for i, want := range []string{"FILE", "a.txt (cached)", "b.txt", "TOTAL"} {
+		if !strings.HasPrefix(lines[i], want+" ") {
+			t.Errorf("line %d = %q, want prefix %q", i, lines[i], want)
+		}
+	}
+	if !strings.Contains(lines[2], "unknown") || !strings.Contains(lines[3], "unknown") {
+		t.Errorf("unknown cost is not shown:\n%s", buf.String())
+	}
+}
+
+func TestReportWriteJSON(t *testing.T) {
+	r := New("gpt-4o", "prompt.txt", "")
+	r.Add("a.txt", usageCost("gpt-4o", 400_000, 0, false), 1500*time.Millisecond)
+
+	var buf bytes.Buffer
+	if err := r.WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var got Report
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Prompt != "prompt.txt" || len(got.Files) != 1 || got.Files[0].DurationMS != 1500 {
+		t.Errorf("WriteJSON() = %s", buf.String())
+	}
+	if got.Total.TotalCost == nil || *got.Total.TotalCost != 1 {
+		t.Errorf("total_cost_usd = %v, want 1", got.Total.TotalCost)
+	}
+}
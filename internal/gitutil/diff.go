@@ -0,0 +1,70 @@
+package gitutil
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// reDiffFileHeader is a regular expression to find the file name in a "diff --git" header line.
+var reDiffFileHeader = regexp.MustCompile(`^diff --git a/(.*) b/`)
+
+// TrimDiff shortens a diff made of "diff --git" sections to at most maxBytes.
+// Whole file sections are kept in order while they fit; the first section that does not fit is cut,
+// and the names of the remaining files are listed so that the summary still mentions them.
+func TrimDiff(diff string, maxBytes int) string {
+	if maxBytes <= 0 || len(diff) <= maxBytes {
+		return diff
+	}
+
+	sections := splitDiffSections(diff)
+	var sb strings.Builder
+	i := 0
+	for ; i < len(sections); i++ {
+		if sb.Len()+len(sections[i]) > maxBytes {
+			break
+		}
+		sb.WriteString(sections[i])
+	}
+	if i < len(sections) {
+		if rest := maxBytes - sb.Len(); rest > 0 {
+			cut := sections[i][:rest]
+			if n := strings.LastIndex(cut, "\n"); n >= 0 {
+				cut = cut[:n+1]
+			}
+			sb.WriteString(cut)
+			sb.WriteString("[... diff truncated ...]\n")
+			i++
+		}
+		if i < len(sections) {
+			names := make([]string, 0, len(sections)-i)
+			for _, s := range sections[i:] {
+				names = append(names, diffSectionFile(s))
+			}
+			sb.WriteString(fmt.Sprintf("[... %d more files changed: %s ...]\n", len(names), strings.Join(names, ", ")))
+		}
+	}
+	return sb.String()
+}
+
+// splitDiffSections splits a diff into sections starting with "diff --git".
+func splitDiffSections(diff string) []string {
+	var sections []string
+	for {
+		next := strings.Index(diff, "\ndiff --git ")
+		if next < 0 {
+			return append(sections, diff)
+		}
+		sections = append(sections, diff[:next+1])
+		diff = diff[next+1:]
+	}
+}
+
+// diffSectionFile returns the file name of a diff section.
+func diffSectionFile(section string) string {
+	line, _, _ := strings.Cut(section, "\n")
+	if m := reDiffFileHeader.FindStringSubmatch(line); m != nil {
+		return m[1]
+	}
+	return line
+}
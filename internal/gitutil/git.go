@@ -0,0 +1,185 @@
+package gitutil
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// ErrNotRepository is an error when the directory is not in a git working tree.
+var ErrNotRepository = errors.New("not a git repository")
+
+// Repository represents a git working tree.
+type Repository struct {
+	root string
+}
+
+// Open finds the git working tree containing dir.
+func Open(dir string) (*Repository, error) {
+	out, err := runGit(dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", ErrNotRepository, dir, err)
+	}
+	return &Repository{root: strings.TrimSpace(out)}, nil
+}
+
+// Root returns the top-level directory of the working tree.
+func (r *Repository) Root() string {
+	return r.root
+}
+
+// run runs a git command in the top-level directory and returns its stdout.
+func (r *Repository) run(args ...string) (string, error) {
+	return runGit(r.root, args...)
+}
+
+// runGit runs a git command in dir and returns its stdout.
+func runGit(dir string, args ...string) (string, error) {
+	return runGitWithInput(dir, "", args...)
+}
+
+// runGitWithInput runs a git command in dir with input as stdin and returns its stdout.
+func runGitWithInput(dir, input string, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("git", append([]string{"-c", "core.quotepath=off"}, args...)...)
+	cmd.Dir = dir
+	cmd.Stdin = strings.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s failed: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+// listPaths runs a git command printing NUL separated paths relative to the root and returns them as absolute paths.
+func (r *Repository) listPaths(args ...string) ([]string, error) {
+	out, err := r.run(args...)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, p := range strings.Split(out, "\x00") {
+		if p != "" {
+			paths = append(paths, filepath.Join(r.root, filepath.FromSlash(p)))
+		}
+	}
+	return paths, nil
+}
+
+// ChangedFiles returns the files changed in the working tree compared to ref. Deleted files are excluded.
+func (r *Repository) ChangedFiles(ref string) ([]string, error) {
+	return r.listPaths("diff", "--name-only", "-z", "--diff-filter=d", ref, "--")
+}
+
+// StagedFiles returns the files staged in the index. Deleted files are excluded.
+func (r *Repository) StagedFiles() ([]string, error) {
+	return r.listPaths("diff", "--cached", "--name-only", "-z", "--diff-filter=d", "--")
+}
+
+// UntrackedFiles returns the untracked files that are not ignored.
+func (r *Repository) UntrackedFiles() ([]string, error) {
+	return r.listPaths("ls-files", "--others", "--exclude-standard", "-z", "--")
+}
+
+// ListFiles returns the tracked and untracked files under dir that are not ignored.
+func (r *Repository) ListFiles(dir string) ([]string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get absolute path: %w", err)
+	}
+	return r.listPaths("ls-files", "--cached", "--others", "--exclude-standard", "-z", "--", abs)
+}
+
+// StagedDiff returns the diff of the changes staged in the index.
+func (r *Repository) StagedDiff() (string, error) {
+	return r.run("diff", "--cached", "--no-color", "--no-ext-diff")
+}
+
+// GitPath resolves a path inside the git directory, such as "COMMIT_EDITMSG" or "hooks", honoring core.hooksPath.
+func (r *Repository) GitPath(name string) (string, error) {
+	out, err := r.run("rev-parse", "--git-path", name)
+	if err != nil {
+		return "", err
+	}
+	p := strings.TrimSpace(out)
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(r.root, p)
+	}
+	return p, nil
+}
+
+// CommitWithMessageFile commits the staged changes with the message in path.
+func (r *Repository) CommitWithMessageFile(path string) error {
+	if _, err := r.run("commit", "--file", path); err != nil {
+		return err
+	}
+	return nil
+}
+
+// IsClean reports whether the working tree has no changes, including untracked files.
+func (r *Repository) IsClean() (bool, error) {
+	out, err := r.run("status", "--porcelain")
+	if err != nil {
+		return false, err
+	}
+	return strings.TrimSpace(out) == "", nil
+}
+
+// Stash stashes the changes in the working tree, including untracked files.
+func (r *Repository) Stash(message string) error {
+	_, err := r.run("stash", "push", "--include-untracked", "--message", message)
+	return err
+}
+
+// StashPop restores the most recently stashed changes.
+func (r *Repository) StashPop() error {
+	_, err := r.run("stash", "pop")
+	return err
+}
+
+// BranchExists reports whether the local branch exists.
+func (r *Repository) BranchExists(branch string) bool {
+	_, err := r.run("rev-parse", "--verify", "--quiet", "refs/heads/"+branch)
+	return err == nil
+}
+
+// AddWorktree creates a new branch from HEAD checked out in a new worktree at path.
+func (r *Repository) AddWorktree(path, branch string) (*Repository, error) {
+	if _, err := r.run("worktree", "add", "-b", branch, path, "HEAD"); err != nil {
+		return nil, err
+	}
+	return Open(path)
+}
+
+// CheckoutWorktree checks out the existing branch in a new worktree at path.
+func (r *Repository) CheckoutWorktree(path, branch string) (*Repository, error) {
+	if _, err := r.run("worktree", "add", path, branch); err != nil {
+		return nil, err
+	}
+	return Open(path)
+}
+
+// RemoveWorktree removes the worktree at path. The branch checked out there is kept.
+func (r *Repository) RemoveWorktree(path string) error {
+	_, err := r.run("worktree", "remove", "--force", path)
+	return err
+}
+
+// CommitFiles stages the files and commits them with the message.
+// It reports false without committing when the files have no changes.
+func (r *Repository) CommitFiles(message string, paths ...string) (bool, error) {
+	if _, err := r.run(append([]string{"add", "--"}, paths...)...); err != nil {
+		return false, err
+	}
+	if _, err := r.run("diff", "--cached", "--quiet"); err == nil {
+		return false, nil
+	}
+	if _, err := runGitWithInput(r.root, message, "commit", "--quiet", "--file", "-"); err != nil {
+		return false, err
+	}
+	return true, nil
+}
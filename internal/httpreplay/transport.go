@@ -0,0 +1,202 @@
+package httpreplay
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// Mode is the mode of the replay transport.
+type Mode string
+
+const (
+	// ModeAuto replays the recorded fixtures and records the missing ones.
+	ModeAuto Mode = "auto"
+	// ModeRecord always sends the requests and records the fixtures.
+	ModeRecord Mode = "record"
+	// ModeReplay only replays the recorded fixtures and never sends requests.
+	ModeReplay Mode = "replay"
+)
+
+var (
+	// ErrInvalidMode is an error when the replay mode is unknown.
+	ErrInvalidMode = errors.New("invalid replay mode")
+	// ErrFixtureNotFound is an error when no fixture is recorded for the request in replay mode.
+	ErrFixtureNotFound = errors.New("replay fixture not found")
+)
+
+// recordedHeaders are the headers kept in the fixtures. Others, such as Authorization, are stripped.
+var recordedHeaders = []string{"Content-Type"}
+
+// ParseMode parses the replay mode.
+func ParseMode(s string) (Mode, error) {
+	switch m := Mode(s); m {
+	case ModeAuto, ModeRecord, ModeReplay:
+		return m, nil
+	}
+	return "", fmt.Errorf("%w: %s", ErrInvalidMode, s)
+}
+
+// Fixture is a recorded pair of a request and its response.
+type Fixture struct {
+	Request  Message `json:"request"`
+	Response Message `json:"response"`
+}
+
+// Message is a recorded request or response.
+type Message struct {
+	Method     string            `json:"method,omitempty"`
+	URL        string            `json:"url,omitempty"`
+	StatusCode int               `json:"status_code,omitempty"`
+	Header     map[string]string `json:"header,omitempty"`
+	Body       json.RawMessage   `json:"body,omitempty"`
+	BodyText   string            `json:"body_text,omitempty"`
+}
+
+// Transport is an http.RoundTripper which records the requests and responses as fixtures in a directory and replays them.
+// Fixtures are keyed by the method, the URL and the body of the request.
+type Transport struct {
+	dir  string
+	mode Mode
+	next http.RoundTripper
+}
+
+var _ http.RoundTripper = (*Transport)(nil)
+
+// New creates a transport storing the fixtures in dir. Requests are sent with next, or http.DefaultTransport if nil.
+func New(dir string, mode Mode, next http.RoundTripper) *Transport {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &Transport{dir: dir, mode: mode, next: next}
+}
+
+// RoundTrip replays the fixture of the request, or sends the request and records it, according to the mode.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, fmt.Errorf("failed to read request body: %w", err)
+		}
+		_ = req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	path := filepath.Join(t.dir, fixtureKey(req.Method, req.URL.String(), body)+".json")
+
+	if t.mode != ModeRecord {
+		fixture, err := readFixture(path)
+		if err == nil {
+			return fixture.Response.toResponse(req), nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		if t.mode == ModeReplay {
+			return nil, fmt.Errorf("%w: %s %s (%s)", ErrFixtureNotFound, req.Method, req.URL, path)
+		}
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	fixture := &Fixture{
+		Request:  newMessage(req.Header, body),
+		Response: newMessage(resp.Header, respBody),
+	}
+	fixture.Request.Method, fixture.Request.URL = req.Method, req.URL.String()
+	fixture.Response.StatusCode = resp.StatusCode
+	if err := writeFixture(path, fixture); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// fixtureKey returns the hash identifying a request.
+func fixtureKey(method, url string, body []byte) string {
+	h := sha256.New()
+	_, _ = fmt.Fprintf(h, "%s %s\n", method, url)
+	_, _ = h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))[:32]
+}
+
+// newMessage creates a message with the recorded headers. JSON bodies are kept as JSON so that the fixtures are readable.
+func newMessage(header http.Header, body []byte) Message {
+	m := Message{Header: map[string]string{}}
+	for _, name := range recordedHeaders {
+		if v := header.Get(name); v != "" {
+			m.Header[name] = v
+		}
+	}
+	if json.Valid(body) {
+		m.Body = body
+	} else {
+		m.BodyText = string(body)
+	}
+	return m
+}
+
+// toResponse converts the recorded response to an http.Response of the request.
+func (m *Message) toResponse(req *http.Request) *http.Response {
+	body := []byte(m.BodyText)
+	if len(m.Body) > 0 {
+		body = m.Body
+	}
+	header := http.Header{}
+	for k, v := range m.Header {
+		header.Set(k, v)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", m.StatusCode, http.StatusText(m.StatusCode)),
+		StatusCode:    m.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+func readFixture(path string) (*Fixture, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f Fixture
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("failed to parse fixture %s: %w", path, err)
+	}
+	return &f, nil
+}
+
+func writeFixture(path string, f *Fixture) error {
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal fixture: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create fixture directory: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil { //nolint:gosec // fixtures are meant to be committed
+		return fmt.Errorf("failed to write fixture: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package httpreplay
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ytka/textforge/internal/mockserver"
+)
+
+const testURL = "http://textforge.test/v1/chat/completions"
+
+// countingTransport counts the requests sent to the next transport.
+type countingTransport struct {
+	next  http.RoundTripper
+	count int
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.count++
+	return t.next.RoundTrip(req)
+}
+
+func newMockTransport() *countingTransport {
+	return &countingTransport{next: mockserver.NewTransport(mockserver.New(nil, mockserver.TransformUpper, false))}
+}
+
+func post(t *testing.T, rt http.RoundTripper, body string) string {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, testURL, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer sk-secret")
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip() error = %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func compact(t *testing.T, s string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, []byte(s)); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func chatBody(text string) string {
+	return `{"model":"gpt-4o","messages":[{"role":"user","content":"<textforge-input>\n` + text + `\n</textforge-input>"}]}`
+}
+
+func TestTransportAutoRecordsThenReplays(t *testing.T) {
+	dir := t.TempDir()
+	next := newMockTransport()
+	rt := New(dir, ModeAuto, next)
+
+	first := post(t, rt, chatBody("hello"))
+	second := post(t, rt, chatBody("hello"))
+	if next.count != 1 {
+		t.Errorf("requests sent = %d, want 1", next.count)
+	}
+	if compact(t, first) != compact(t, second) {
+		t.Errorf("replayed body = %s, want %s", second, first)
+	}
+	if !strings.Contains(first, "HELLO") {
+		t.Errorf("body = %s, want the upper-cased input", first)
+	}
+
+	post(t, rt, chatBody("world"))
+	if next.count != 2 {
+		t.Errorf("requests sent = %d, want 2 for a different body", next.count)
+	}
+}
+
+func TestTransportRecordStripsAuthorization(t *testing.T) {
+	dir := t.TempDir()
+	post(t, New(dir, ModeRecord, newMockTransport()), chatBody("hello"))
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("fixtures = %v, %v, want one", files, err)
+	}
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "sk-secret") {
+		t.Errorf("fixture contains the API key: %s", data)
+	}
+	fixture, err := readFixture(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fixture.Request.URL != testURL || fixture.Response.StatusCode != http.StatusOK {
+		t.Errorf("fixture = %+v", fixture)
+	}
+}
+
+func TestTransportRecordAlwaysSends(t *testing.T) {
+	next := newMockTransport()
+	rt := New(t.TempDir(), ModeRecord, next)
+	post(t, rt, chatBody("hello"))
+	post(t, rt, chatBody("hello"))
+	if next.count != 2 {
+		t.Errorf("requests sent = %d, want 2", next.count)
+	}
+}
+
+func TestTransportReplayNeverSends(t *testing.T) {
+	dir := t.TempDir()
+	post(t, New(dir, ModeRecord, newMockTransport()), chatBody("hello"))
+
+	next := newMockTransport()
+	rt := New(dir, ModeReplay, next)
+	post(t, rt, chatBody("hello"))
+
+	req, err := http.NewRequest(http.MethodPost, testURL, strings.NewReader(chatBody("missing")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rt.RoundTrip(req); !errors.Is(err, ErrFixtureNotFound) {
+		t.Errorf("RoundTrip() error = %v, want %v", err, ErrFixtureNotFound)
+	}
+	if next.count != 0 {
+		t.Errorf("requests sent = %d, want 0", next.count)
+	}
+}
+
+func TestParseMode(t *testing.T) {
+	for _, s := range []string{"auto", "record", "replay"} {
+		if m, err := ParseMode(s); err != nil || string(m) != s {
+			t.Errorf("ParseMode(%q) = %q, %v", s, m, err)
+		}
+	}
+	if _, err := ParseMode("other"); !errors.Is(err, ErrInvalidMode) {
+		t.Errorf("ParseMode(other) error = %v, want %v", err, ErrInvalidMode)
+	}
+}
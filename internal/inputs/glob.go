@@ -0,0 +1,108 @@
+package inputs
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+var (
+	globCache   = map[string]*regexp.Regexp{}
+	globCacheMu sync.Mutex
+)
+
+// Match reports whether path matches the glob pattern.
+// "*" and "?" do not match "/", "**" matches any number of directories, and "[...]" is a character class.
+// A pattern without "/" is matched against the base name of path, like .gitignore.
+func Match(pattern, path string) bool {
+	if !strings.Contains(filepath.ToSlash(pattern), "/") {
+		path = filepath.Base(path)
+	}
+	return matchPath(pattern, path)
+}
+
+// matchPath reports whether the whole path matches the glob pattern.
+func matchPath(pattern, path string) bool {
+	path = filepath.ToSlash(filepath.Clean(path))
+	pattern = filepath.ToSlash(filepath.Clean(pattern))
+	return globRegexp(pattern).MatchString(path)
+}
+
+// MatchAny reports whether path matches any of the glob patterns.
+func MatchAny(patterns []string, path string) bool {
+	for _, p := range patterns {
+		if Match(p, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasMeta reports whether path contains any glob meta characters.
+func hasMeta(path string) bool {
+	return strings.ContainsAny(path, "*?[")
+}
+
+// globBase returns the leading directory of pattern that contains no meta characters.
+func globBase(pattern string) string {
+	dir := filepath.Dir(pattern)
+	for hasMeta(dir) {
+		dir = filepath.Dir(dir)
+	}
+	return dir
+}
+
+// globRegexp compiles a glob pattern into a regular expression.
+func globRegexp(pattern string) *regexp.Regexp {
+	globCacheMu.Lock()
+	defer globCacheMu.Unlock()
+	if re, ok := globCache[pattern]; ok {
+		return re
+	}
+
+	var sb strings.Builder
+	sb.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		ch := pattern[i]
+		switch ch {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				i++
+				if i+1 < len(pattern) && pattern[i+1] == '/' {
+					// "**/" matches zero or more directories.
+					i++
+					sb.WriteString("(?:.*/)?")
+				} else {
+					sb.WriteString(".*")
+				}
+			} else {
+				sb.WriteString("[^/]*")
+			}
+		case '?':
+			sb.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(pattern[i:], ']')
+			if end < 0 {
+				sb.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+				continue
+			}
+			class := pattern[i+1 : i+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			sb.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end
+		default:
+			sb.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+	sb.WriteString("$")
+
+	re, err := regexp.Compile(sb.String())
+	if err != nil {
+		re = regexp.MustCompile("^" + regexp.QuoteMeta(pattern) + "$")
+	}
+	globCache[pattern] = re
+	return re
+}
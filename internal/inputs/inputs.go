@@ -0,0 +1,311 @@
+package inputs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ytka/textforge/internal/gitutil"
+)
+
+// binaryCheckSize is the number of leading bytes inspected to detect binary files, the same as git.
+const binaryCheckSize = 8000
+
+// ErrNoInputsSelected is an error when the selectors match no files.
+var ErrNoInputsSelected = errors.New("no input files selected")
+
+// Options holds the options for resolving input files.
+type Options struct {
+	GitChanged   string
+	GitStaged    bool
+	GitUntracked bool
+	Include      []string
+	Exclude      []string
+	MaxFileSize  int64
+	MaxDepth     int
+}
+
+// hasGitSelector reports whether any git selector is set.
+func (o *Options) hasGitSelector() bool {
+	return o.GitChanged != "" || o.GitStaged || o.GitUntracked
+}
+
+// Resolve expands the given paths and git selectors into a deduplicated list of text files.
+// Directories and glob patterns are expanded recursively, honoring .gitignore inside a git working tree.
+// "-" (stdin) is passed through as is.
+func Resolve(paths []string, opts *Options) ([]string, error) {
+	r := &resolver{opts: opts, seen: map[string]bool{}}
+	if err := r.addGitSelections(); err != nil {
+		return nil, err
+	}
+	for _, p := range paths {
+		if err := r.addPath(p); err != nil {
+			return nil, err
+		}
+	}
+	if len(r.files) == 0 && (opts.hasGitSelector() || len(paths) > 0) {
+		return nil, ErrNoInputsSelected
+	}
+	return r.files, nil
+}
+
+type resolver struct {
+	opts    *Options
+	repo    *gitutil.Repository
+	repoErr error
+	files   []string
+	seen    map[string]bool
+}
+
+// repository opens the git working tree of the current directory once, remembering the failure outside of one.
+func (r *resolver) repository() (*gitutil.Repository, error) {
+	if r.repo == nil && r.repoErr == nil {
+		repo, err := gitutil.Open(".")
+		if err != nil {
+			r.repoErr = fmt.Errorf("failed to open git repository: %w", err)
+		}
+		r.repo = repo
+	}
+	return r.repo, r.repoErr
+}
+
+// repositoryOf returns the git working tree containing dir, which is the one of the current directory
+// unless dir is outside of it, and false when dir is not in any working tree.
+func (r *resolver) repositoryOf(dir string) (*gitutil.Repository, bool) {
+	real, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return nil, false
+	}
+	if abs, err := filepath.Abs(real); err == nil {
+		if repo, err := r.repository(); err == nil {
+			if rel, err := filepath.Rel(repo.Root(), abs); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				return repo, true
+			}
+		}
+	}
+	repo, err := gitutil.Open(dir)
+	return repo, err == nil
+}
+
+func (r *resolver) addGitSelections() error {
+	if !r.opts.hasGitSelector() {
+		return nil
+	}
+	repo, err := r.repository()
+	if err != nil {
+		return err
+	}
+
+	var selected []string
+	if r.opts.GitChanged != "" {
+		files, err := repo.ChangedFiles(r.opts.GitChanged)
+		if err != nil {
+			return fmt.Errorf("failed to get changed files: %w", err)
+		}
+		selected = append(selected, files...)
+	}
+	if r.opts.GitStaged {
+		files, err := repo.StagedFiles()
+		if err != nil {
+			return fmt.Errorf("failed to get staged files: %w", err)
+		}
+		selected = append(selected, files...)
+	}
+	if r.opts.GitUntracked {
+		files, err := repo.UntrackedFiles()
+		if err != nil {
+			return fmt.Errorf("failed to get untracked files: %w", err)
+		}
+		selected = append(selected, files...)
+	}
+	for _, f := range selected {
+		if err := r.addFile(f, "", true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *resolver) addPath(path string) error {
+	if path == "-" {
+		if !r.seen[path] {
+			r.seen[path] = true
+			r.files = append(r.files, path)
+		}
+		return nil
+	}
+	if hasMeta(path) {
+		return r.addGlob(path)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("failed to stat input: %w", err)
+	}
+	if !info.IsDir() {
+		return r.addFile(path, "", false)
+	}
+	files, err := r.listDir(path)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if err := r.addFile(f, path, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addGlob adds the files matching the glob pattern. The directory part before the first meta character is walked.
+func (r *resolver) addGlob(pattern string) error {
+	base := globBase(pattern)
+	if _, err := os.Stat(base); err != nil {
+		return nil //nolint:nilerr // a pattern whose base does not exist matches nothing
+	}
+	absBase, err := filepath.Abs(base)
+	if err != nil {
+		return fmt.Errorf("failed to get absolute path: %w", err)
+	}
+	files, err := r.listDir(base)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		absFile, err := filepath.Abs(f)
+		if err != nil {
+			return fmt.Errorf("failed to get absolute path: %w", err)
+		}
+		// Match in the same form as the pattern, e.g. "../dir/**/*.go" or an absolute pattern.
+		rel, err := filepath.Rel(absBase, absFile)
+		if err != nil {
+			continue
+		}
+		if matchPath(pattern, filepath.Join(base, rel)) {
+			if err := r.addFile(f, base, true); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// listDir lists the files under dir, using git to honor .gitignore when dir is inside a working tree.
+func (r *resolver) listDir(dir string) ([]string, error) {
+	if repo, ok := r.repositoryOf(dir); ok {
+		files, err := repo.ListFiles(dir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list files in %s: %w", dir, err)
+		}
+		return files, nil
+	}
+
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if d.Type().IsRegular() {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk %s: %w", dir, err)
+	}
+	return files, nil
+}
+
+// addFile adds a file after applying the filters. Expanded files that do not exist, are binary or are filtered out are skipped,
+// while an explicitly given file skips the filters and is only skipped when binary. base is the directory the file was expanded from, if any.
+func (r *resolver) addFile(path, base string, expanded bool) error {
+	rel := relativePath(path)
+	if r.seen[rel] {
+		return nil
+	}
+	if expanded {
+		if !r.matchFilters(rel, base) {
+			return nil
+		}
+		info, err := os.Stat(rel)
+		if err != nil || !info.Mode().IsRegular() {
+			return nil //nolint:nilerr // deleted or special files are skipped
+		}
+		if r.opts.MaxFileSize > 0 && info.Size() > r.opts.MaxFileSize {
+			return nil
+		}
+	}
+	binary, err := isBinaryFile(rel)
+	if err != nil {
+		return err
+	}
+	if binary {
+		return nil
+	}
+	r.seen[rel] = true
+	r.files = append(r.files, rel)
+	return nil
+}
+
+// matchFilters reports whether path passes the include and exclude patterns and the max depth below base.
+func (r *resolver) matchFilters(path, base string) bool {
+	if r.opts.MaxDepth > 0 && base != "" && depth(base, path) > r.opts.MaxDepth {
+		return false
+	}
+	if len(r.opts.Include) > 0 && !MatchAny(r.opts.Include, path) {
+		return false
+	}
+	return !MatchAny(r.opts.Exclude, path)
+}
+
+// depth returns the directory depth of path below base. A file directly in base has depth 1.
+func depth(base, path string) int {
+	rel, err := filepath.Rel(relativePath(base), path)
+	if err != nil {
+		return 0
+	}
+	return len(strings.Split(filepath.ToSlash(rel), "/"))
+}
+
+// relativePath converts path to a clean path relative to the current directory when possible.
+func relativePath(path string) string {
+	if !filepath.IsAbs(path) {
+		return filepath.Clean(path)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return path
+	}
+	rel, err := filepath.Rel(wd, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return path
+	}
+	return rel
+}
+
+// isBinaryFile reports whether the file contains a NUL byte in its leading bytes.
+func isBinaryFile(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, fmt.Errorf("failed to open input file: %w", err)
+	}
+	defer f.Close()
+
+	buf := make([]byte, binaryCheckSize)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return false, fmt.Errorf("failed to read input file: %w", err)
+	}
+	for _, b := range buf[:n] {
+		if b == 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
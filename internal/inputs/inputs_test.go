@@ -0,0 +1,113 @@
+package inputs
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// initRepo creates a git working tree at dir which ignores the files named ignored.txt.
+func initRepo(t *testing.T, dir string) {
+	t.Helper()
+	if out, err := exec.Command("git", "init", "--quiet", dir).CombinedOutput(); err != nil {
+		t.Fatalf("git init: %v: %s", err, out)
+	}
+	if err := os.WriteFile(filepath.Join(dir, ".gitignore"), []byte("ignored.txt\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestResolveDirectories(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	tmp, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cwdRepo := filepath.Join(tmp, "cwd")
+	otherRepo := filepath.Join(tmp, "other")
+	plain := filepath.Join(tmp, "plain")
+	for _, dir := range []string{cwdRepo, otherRepo} {
+		initRepo(t, dir)
+	}
+	for _, dir := range []string{cwdRepo, otherRepo, plain} {
+		for _, name := range []string{"a.txt", "ignored.txt"} {
+			if err := os.MkdirAll(filepath.Join(dir, "src"), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(dir, "src", name), []byte(name+"\n"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(cwdRepo); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.Chdir(wd) })
+
+	tests := []struct {
+		name string
+		dir  string
+		want []string
+	}{
+		{name: "current repository", dir: "src", want: []string{filepath.Join("src", "a.txt")}},
+		{name: "other repository", dir: filepath.Join(otherRepo, "src"), want: []string{filepath.Join(otherRepo, "src", "a.txt")}},
+		{name: "outside of repositories", dir: filepath.Join(plain, "src"), want: []string{filepath.Join(plain, "src", "a.txt"), filepath.Join(plain, "src", "ignored.txt")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Resolve([]string{tt.dir}, &Options{})
+			if err != nil {
+				t.Fatalf("Resolve() error = %v", err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Resolve(%q) = %q, want %q", tt.dir, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRelativePath(t *testing.T) {
+	tmp, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cwd := filepath.Join(tmp, "cwd")
+	if err := os.Mkdir(cwd, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(cwd); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.Chdir(wd) })
+
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		{name: "relative", path: "./src/../a.txt", want: "a.txt"},
+		{name: "inside", path: filepath.Join(cwd, "src", "a.txt"), want: filepath.Join("src", "a.txt")},
+		{name: "dot-dot name", path: filepath.Join(cwd, "..config", "a.txt"), want: filepath.Join("..config", "a.txt")},
+		{name: "parent", path: tmp, want: tmp},
+		{name: "outside", path: filepath.Join(tmp, "other", "a.txt"), want: filepath.Join(tmp, "other", "a.txt")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := relativePath(tt.path); got != tt.want {
+				t.Errorf("relativePath(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+}
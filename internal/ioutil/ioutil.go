@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 )
 
 // ErrFileIsNil is an error for a nil file.
@@ -26,3 +27,39 @@ func IsStdoutPipeOrRedirect() (bool, error) {
 	}
 	return fileInfo.Mode()&os.ModeCharDevice == 0, nil
 }
+
+// IsTerminal checks if the file is a terminal.
+func IsTerminal(f *os.File) (bool, error) {
+	if f == nil {
+		return false, ErrFileIsNil
+	}
+	fileInfo, err := f.Stat()
+	if err != nil {
+		return false, fmt.Errorf("failed to get file info: %w", err)
+	}
+	return fileInfo.Mode()&os.ModeCharDevice != 0, nil
+}
+
+// DataDir returns the directory for textforge's persistent data, following the XDG base directory specification.
+func DataDir() (string, error) {
+	if dir := os.Getenv("XDG_DATA_HOME"); dir != "" {
+		return filepath.Join(dir, "textforge"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(home, ".local", "share", "textforge"), nil
+}
+
+// CacheDir returns the directory for textforge's cache files, following the XDG base directory specification.
+func CacheDir() (string, error) {
+	if dir := os.Getenv("XDG_CACHE_HOME"); dir != "" {
+		return filepath.Join(dir, "textforge"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(home, ".cache", "textforge"), nil
+}
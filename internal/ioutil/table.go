@@ -0,0 +1,22 @@
+package ioutil
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// WriteTable writes the lines as a table whose columns are aligned with two spaces.
+func WriteTable(w io.Writer, lines [][]string) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, l := range lines {
+		if _, err := fmt.Fprintln(tw, strings.Join(l, "\t")); err != nil {
+			return fmt.Errorf("failed to write table: %w", err)
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return fmt.Errorf("failed to write table: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package ledger
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ytka/textforge/internal/ioutil"
+	"github.com/ytka/textforge/internal/openai"
+)
+
+// Entry is a record of the usage of one request.
+type Entry struct {
+	Timestamp        time.Time `json:"timestamp"`
+	Project          string    `json:"project"`
+	Profile          string    `json:"profile"`
+	Prompt           string    `json:"prompt"`
+	Model            string    `json:"model"`
+	InputPath        string    `json:"input_path"`
+	PromptTokens     int       `json:"prompt_tokens"`
+	CompletionTokens int       `json:"completion_tokens"`
+	TotalTokens      int       `json:"total_tokens"`
+	CachedTokens     int       `json:"cached_tokens,omitempty"`
+	ReasoningTokens  int       `json:"reasoning_tokens,omitempty"`
+	FromCache        bool      `json:"from_cache,omitempty"`
+	Cost             *float64  `json:"cost,omitempty"` // Cost is nil when the pricing of the model is unknown.
+}
+
+// NewEntry creates an Entry from a usage cost.
+func NewEntry(project, profile, prompt, inputPath string, uc *openai.UsageCost) Entry {
+	e := Entry{
+		Timestamp:        time.Now(),
+		Project:          project,
+		Profile:          profile,
+		Prompt:           prompt,
+		Model:            uc.ModelName(),
+		InputPath:        inputPath,
+		PromptTokens:     uc.PromptTokens(),
+		CompletionTokens: uc.CompletionTokens(),
+		TotalTokens:      uc.TotalTokens(),
+		CachedTokens:     uc.CachedTokens(),
+		ReasoningTokens:  uc.ReasoningTokens(),
+		FromCache:        uc.FromCache(),
+	}
+	if ok, cost := uc.TotalTokensCost(); ok {
+		e.Cost = &cost
+	}
+	return e
+}
+
+// DefaultPath returns the path of the ledger file in the data directory.
+func DefaultPath() (string, error) {
+	dir, err := ioutil.DataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "usage.jsonl"), nil
+}
+
+// Append appends the entries to the ledger file as JSON lines.
+func Append(path string, entries ...Entry) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("failed to create ledger directory: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open ledger: %w", err)
+	}
+	defer f.Close()
+
+	enc := json.NewEncoder(f)
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			return fmt.Errorf("failed to write ledger entry: %w", err)
+		}
+	}
+	return nil
+}
+
+// Read reads all entries of the ledger file. A missing file has no entries.
+func Read(path string) ([]Entry, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open ledger: %w", err)
+	}
+	defer f.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("failed to parse ledger line %d: %w", line, err)
+		}
+		entries = append(entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read ledger: %w", err)
+	}
+	return entries, nil
+}
@@ -0,0 +1,104 @@
+package ledger
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ytka/textforge/internal/openai"
+)
+
+func TestAppendRead(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data", "usage.jsonl")
+	entries, err := Read(path)
+	if err != nil || len(entries) != 0 {
+		t.Fatalf("Read() of a missing ledger = %v, %v, want no entries", entries, err)
+	}
+
+	cc := &openai.ChatCompletion{Model: "gpt-4o"}
+	cc.Usage.PromptTokens, cc.Usage.CompletionTokens, cc.Usage.TotalTokens = 400_000, 100_000, 500_000
+	known := NewEntry("project", "", "prompt.txt", "a.txt", openai.NewUsageCost(cc))
+	unknown := NewEntry("project", "", "prompt.txt", "b.txt", openai.NewUsageCost(&openai.ChatCompletion{Model: "unknown-model"}))
+	if err := Append(path, known); err != nil {
+		t.Fatal(err)
+	}
+	if err := Append(path, unknown); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err = Read(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("Read() entries = %d, want 2", len(entries))
+	}
+	if e := entries[0]; e.InputPath != "a.txt" || e.PromptTokens != 400_000 || e.Cost == nil || *e.Cost != 2 {
+		t.Errorf("entries[0] = %+v, want a.txt costing $2", e)
+	}
+	if e := entries[1]; e.InputPath != "b.txt" || e.Cost != nil {
+		t.Errorf("entries[1] = %+v, want b.txt with an unknown cost", e)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	now := time.Date(2024, 6, 10, 12, 0, 0, 0, time.Local)
+	cost := func(c float64) *float64 { return &c }
+	entries := []Entry{
+		{Timestamp: now.Add(-10 * 24 * time.Hour), Model: "gpt-4o", PromptTokens: 1000, Cost: cost(5)},
+		{Timestamp: now.Add(-2 * time.Hour), Model: "gpt-4o", PromptTokens: 100, CompletionTokens: 10, Cost: cost(1)},
+		{Timestamp: now.Add(-time.Hour), Model: "gpt-4o-mini", PromptTokens: 200, CompletionTokens: 20, Cost: cost(2)},
+		{Timestamp: now.Add(-time.Hour), Model: "gpt-4o", PromptTokens: 300, CompletionTokens: 30, Cost: cost(0.5)},
+		{Timestamp: now, Model: "", PromptTokens: 5},
+	}
+	since, err := ParseSince("7d", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows, total := Summarize(entries, since, GroupByModel)
+	want := []Row{
+		{Key: "gpt-4o-mini", Requests: 1, PromptTokens: 200, CompletionTokens: 20, Cost: 2},
+		{Key: "gpt-4o", Requests: 2, PromptTokens: 400, CompletionTokens: 40, Cost: 1.5},
+		{Key: "(none)", Requests: 1, PromptTokens: 5, UnknownCost: 1},
+	}
+	if len(rows) != len(want) {
+		t.Fatalf("Summarize() rows = %+v, want %+v", rows, want)
+	}
+	for i := range want {
+		if rows[i] != want[i] {
+			t.Errorf("rows[%d] = %+v, want %+v", i, rows[i], want[i])
+		}
+	}
+	wantTotal := Row{Key: "TOTAL", Requests: 4, PromptTokens: 605, CompletionTokens: 60, Cost: 3.5, UnknownCost: 1}
+	if total != wantTotal {
+		t.Errorf("total = %+v, want %+v", total, wantTotal)
+	}
+}
+
+func TestParseSince(t *testing.T) {
+	now := time.Date(2024, 6, 10, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		since   string
+		want    time.Time
+		wantErr bool
+	}{
+		{since: "", want: time.Time{}},
+		{since: "2d", want: now.Add(-48 * time.Hour)},
+		{since: "1w", want: now.Add(-7 * 24 * time.Hour)},
+		{since: "12h", want: now.Add(-12 * time.Hour)},
+		{since: "xd", wantErr: true},
+		{since: "soon", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.since, func(t *testing.T) {
+			got, err := ParseSince(tt.since, now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseSince(%q) error = %v, wantErr %v", tt.since, err, tt.wantErr)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("ParseSince(%q) = %v, want %v", tt.since, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,170 @@
+package ledger
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ytka/textforge/internal/ioutil"
+)
+
+// GroupBy is the key to group the entries of a report by.
+type GroupBy string
+
+const (
+	GroupByModel   GroupBy = "model"
+	GroupByPrompt  GroupBy = "prompt"
+	GroupByProject GroupBy = "project"
+	GroupByDay     GroupBy = "day"
+)
+
+var (
+	ErrInvalidGroupBy = errors.New("invalid group by")
+	ErrInvalidSince   = errors.New("invalid since")
+)
+
+// ParseGroupBy converts a string to a GroupBy.
+func ParseGroupBy(s string) (GroupBy, error) {
+	switch g := GroupBy(s); g {
+	case GroupByModel, GroupByPrompt, GroupByProject, GroupByDay:
+		return g, nil
+	default:
+		return "", fmt.Errorf("%w: %s (expected model, prompt, project or day)", ErrInvalidGroupBy, s)
+	}
+}
+
+// ParseSince converts a period such as "7d", "2w" or "12h" to the time that far before now.
+func ParseSince(s string, now time.Time) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	units := map[byte]time.Duration{'d': 24 * time.Hour, 'w': 7 * 24 * time.Hour}
+	if unit, ok := units[s[len(s)-1]]; ok {
+		n, err := strconv.Atoi(s[:len(s)-1])
+		if err != nil {
+			return time.Time{}, fmt.Errorf("%w: %s", ErrInvalidSince, s)
+		}
+		return now.Add(-time.Duration(n) * unit), nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: %s", ErrInvalidSince, s)
+	}
+	return now.Add(-d), nil
+}
+
+// Row is an aggregated row of a report.
+type Row struct {
+	Key              string
+	Requests         int
+	PromptTokens     int
+	CompletionTokens int
+	Cost             float64
+	UnknownCost      int // UnknownCost is the number of requests whose cost is unknown.
+}
+
+// Summarize aggregates the entries at or after since by the key.
+func Summarize(entries []Entry, since time.Time, by GroupBy) (rows []Row, total Row) {
+	byKey := map[string]*Row{}
+	total.Key = "TOTAL"
+	for _, e := range entries {
+		if e.Timestamp.Before(since) {
+			continue
+		}
+		key := groupKey(e, by)
+		r, ok := byKey[key]
+		if !ok {
+			r = &Row{Key: key}
+			byKey[key] = r
+		}
+		r.add(e)
+		total.add(e)
+	}
+
+	for _, r := range byKey {
+		rows = append(rows, *r)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if by != GroupByDay && rows[i].Cost != rows[j].Cost {
+			return rows[i].Cost > rows[j].Cost
+		}
+		return rows[i].Key < rows[j].Key
+	})
+	return rows, total
+}
+
+func (r *Row) add(e Entry) {
+	r.Requests++
+	r.PromptTokens += e.PromptTokens
+	r.CompletionTokens += e.CompletionTokens
+	if e.Cost != nil {
+		r.Cost += *e.Cost
+	} else {
+		r.UnknownCost++
+	}
+}
+
+func groupKey(e Entry, by GroupBy) string {
+	var key string
+	switch by {
+	case GroupByModel:
+		key = e.Model
+	case GroupByPrompt:
+		key = e.Prompt
+	case GroupByProject:
+		key = e.Project
+	case GroupByDay:
+		key = e.Timestamp.Local().Format(time.DateOnly)
+	}
+	if key == "" {
+		return "(none)"
+	}
+	return key
+}
+
+var reportHeader = []string{"requests", "prompt_tokens", "completion_tokens", "cost_usd", "unknown_cost"}
+
+func (r *Row) fields() []string {
+	return []string{
+		r.Key,
+		strconv.Itoa(r.Requests),
+		strconv.Itoa(r.PromptTokens),
+		strconv.Itoa(r.CompletionTokens),
+		strconv.FormatFloat(r.Cost, 'f', 6, 64),
+		strconv.Itoa(r.UnknownCost),
+	}
+}
+
+// WriteTable writes the rows and the total as an aligned table.
+func WriteTable(w io.Writer, by GroupBy, rows []Row, total Row) error {
+	header := append([]string{strings.ToUpper(string(by))}, reportHeader...)
+	lines := [][]string{header}
+	for _, r := range rows {
+		lines = append(lines, r.fields())
+	}
+	lines = append(lines, total.fields())
+	return ioutil.WriteTable(w, lines)
+}
+
+// WriteCSV writes the rows as CSV. The total is not included so that the output can be aggregated further.
+func WriteCSV(w io.Writer, by GroupBy, rows []Row) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(append([]string{string(by)}, reportHeader...)); err != nil {
+		return fmt.Errorf("failed to write csv: %w", err)
+	}
+	for _, r := range rows {
+		if err := cw.Write(r.fields()); err != nil {
+			return fmt.Errorf("failed to write csv: %w", err)
+		}
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return fmt.Errorf("failed to write csv: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package mcp
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"time"
+
+	"github.com/ytka/textforge/internal/ledger"
+)
+
+// Resource URIs of the cost ledger.
+const (
+	uriLedger        = "textforge://ledger"
+	uriLedgerSummary = "textforge://ledger/summary"
+)
+
+// summaryPeriod is the period of the ledger summary.
+const summaryPeriod = 30 * 24 * time.Hour
+
+func (s *Server) listResources() []Resource {
+	if s.opts.LedgerPath == "" {
+		return []Resource{}
+	}
+	return []Resource{
+		{URI: uriLedger, Name: "Cost ledger", Description: "Usage and cost of each request to the API, as JSON lines", MimeType: "application/x-ndjson"},
+		{URI: uriLedgerSummary, Name: "Cost summary", Description: "Usage and cost of the last 30 days by model, prompt and project", MimeType: "text/plain"},
+	}
+}
+
+func (s *Server) readResource(uri string) (any, error) {
+	if s.opts.LedgerPath == "" || (uri != uriLedger && uri != uriLedgerSummary) {
+		return nil, newRPCError(codeInvalidParams, "resource not found: "+uri)
+	}
+	if uri == uriLedger {
+		data, err := os.ReadFile(s.opts.LedgerPath)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		return &readResourceResult{Contents: []resourceContents{{URI: uri, MimeType: "application/x-ndjson", Text: string(data)}}}, nil
+	}
+
+	entries, err := ledger.Read(s.opts.LedgerPath)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	since := time.Now().Add(-summaryPeriod)
+	for i, by := range []ledger.GroupBy{ledger.GroupByModel, ledger.GroupByPrompt, ledger.GroupByProject} {
+		if i > 0 {
+			buf.WriteString("\n")
+		}
+		rows, total := ledger.Summarize(entries, since, by)
+		if err := ledger.WriteTable(&buf, by, rows, total); err != nil {
+			return nil, err
+		}
+	}
+	return &readResourceResult{Contents: []resourceContents{{URI: uri, MimeType: "text/plain", Text: buf.String()}}}, nil
+}
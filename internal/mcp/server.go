@@ -0,0 +1,203 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+
+	"github.com/ytka/textforge/internal/openai"
+	"github.com/ytka/textforge/internal/prompts"
+	"github.com/ytka/textforge/internal/runner"
+)
+
+// protocolVersions are the supported versions of the protocol, the latest first.
+var protocolVersions = []string{"2025-06-18", "2025-03-26", "2024-11-05"}
+
+// maxMessageSize is the max size of a message line.
+const maxMessageSize = 10 << 20
+
+// UsageFunc is called with the usage of each tool call, such as to record it in the ledger.
+type UsageFunc func(prompt, inputPath string, uc *openai.UsageCost)
+
+// Options holds the options of the server.
+type Options struct {
+	// Version is the version of textforge reported to the client.
+	Version string
+	// Defaults is the configuration of the tool calls.
+	Defaults runner.Config
+	// Root is the directory the file_path of the tool calls is read from. Paths escaping it and hidden files are rejected, and empty rejects every file_path.
+	Root string
+	// Library is the prompts exposed as the tools.
+	Library *prompts.Library
+	// GAIFactory makes the client of the model.
+	GAIFactory runner.GenerativeAIHandlerFactoryFunc
+	// OnUsage is called with the usage of each tool call, if set.
+	OnUsage UsageFunc
+	// LedgerPath is the ledger file exposed as the resources.
+	LedgerPath string
+}
+
+// Server is a Model Context Protocol server which exposes the prompt library as tools and the cost ledger as resources.
+type Server struct {
+	opts Options
+
+	mu      sync.Mutex
+	w       io.Writer
+	cancels map[string]context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+// New creates a server.
+func New(opts Options) *Server {
+	return &Server{opts: opts, cancels: map[string]context.CancelFunc{}}
+}
+
+// Serve reads the newline delimited JSON-RPC messages from r and writes the responses to w until r ends or ctx is done.
+// Tool calls run concurrently, so that a slow call does not block the others.
+func (s *Server) Serve(ctx context.Context, r io.Reader, w io.Writer) error {
+	s.w = w
+	defer s.wg.Wait()
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxMessageSize)
+	for scanner.Scan() {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var req request
+		if err := json.Unmarshal(line, &req); err != nil {
+			s.write(&response{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: newRPCError(codeParseError, err.Error())})
+			continue
+		}
+		s.dispatch(ctx, &req)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read message: %w", err)
+	}
+	return nil
+}
+
+func (s *Server) dispatch(ctx context.Context, req *request) {
+	if req.isNotification() {
+		if req.Method == "notifications/cancelled" {
+			var p cancelledParams
+			if err := json.Unmarshal(req.Params, &p); err == nil {
+				s.cancel(string(p.RequestID))
+			}
+		}
+		return
+	}
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		s.reply(req, nil, newRPCError(codeInvalidRequest, "invalid request"))
+		return
+	}
+	if req.Method != "tools/call" {
+		result, err := s.handle(req)
+		s.reply(req, result, err)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	s.mu.Lock()
+	s.cancels[string(req.ID)] = cancel
+	s.mu.Unlock()
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer s.cancel(string(req.ID))
+		result, err := s.callTool(ctx, req.Params)
+		if ctx.Err() != nil {
+			// The client does not expect a response to a cancelled request.
+			return
+		}
+		s.reply(req, result, err)
+	}()
+}
+
+// handle handles the requests other than tool calls.
+func (s *Server) handle(req *request) (any, error) {
+	switch req.Method {
+	case "initialize":
+		var p initializeParams
+		if err := unmarshalParams(req.Params, &p); err != nil {
+			return nil, err
+		}
+		version := protocolVersions[0]
+		if slices.Contains(protocolVersions, p.ProtocolVersion) {
+			version = p.ProtocolVersion
+		}
+		return &initializeResult{
+			ProtocolVersion: version,
+			Capabilities:    map[string]any{"tools": map[string]any{}, "resources": map[string]any{}},
+			ServerInfo:      serverInfo{Name: "textforge", Version: s.opts.Version},
+		}, nil
+	case "ping":
+		return struct{}{}, nil
+	case "tools/list":
+		tools, err := s.listTools()
+		if err != nil {
+			return nil, newRPCError(codeInternalError, err.Error())
+		}
+		return &listToolsResult{Tools: tools}, nil
+	case "resources/list":
+		return &listResourcesResult{Resources: s.listResources()}, nil
+	case "resources/read":
+		var p readResourceParams
+		if err := unmarshalParams(req.Params, &p); err != nil {
+			return nil, err
+		}
+		return s.readResource(p.URI)
+	}
+	return nil, newRPCError(codeMethodNotFound, "method not found: "+req.Method)
+}
+
+func (s *Server) cancel(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if cancel, ok := s.cancels[id]; ok {
+		cancel()
+		delete(s.cancels, id)
+	}
+}
+
+func (s *Server) reply(req *request, result any, err error) {
+	resp := &response{JSONRPC: "2.0", ID: req.ID, Result: result}
+	if err != nil {
+		var rpcErr *rpcError
+		if !errors.As(err, &rpcErr) {
+			rpcErr = newRPCError(codeInternalError, err.Error())
+		}
+		resp.Result, resp.Error = nil, rpcErr
+	}
+	s.write(resp)
+}
+
+// write writes the message as a line. Writes are serialized because the tool calls reply concurrently.
+func (s *Server) write(resp *response) {
+	data, err := json.Marshal(resp)
+	if err != nil {
+		data, _ = json.Marshal(&response{JSONRPC: "2.0", ID: resp.ID, Error: newRPCError(codeInternalError, err.Error())})
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, _ = s.w.Write(append(data, '\n'))
+}
+
+func unmarshalParams(params json.RawMessage, v any) error {
+	if len(params) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(params, v); err != nil {
+		return newRPCError(codeInvalidParams, "invalid params: "+err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ytka/textforge/internal/mockserver"
+	"github.com/ytka/textforge/internal/openai"
+	"github.com/ytka/textforge/internal/prompts"
+	"github.com/ytka/textforge/internal/runner"
+)
+
+// mockFactory makes the clients of the upper-casing mock server.
+func mockFactory(model string, _ int) (openai.GenerativeAIClient, error) {
+	client := openai.New("", model, "", nil)
+	client.SetBaseURL("http://textforge.test/v1")
+	client.SetTransport(mockserver.NewTransport(mockserver.New(nil, mockserver.TransformUpper, false)))
+	return client, nil
+}
+
+type testResponse struct {
+	ID     int             `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *rpcError       `json:"error"`
+}
+
+// serve sends the messages to a server over the stdio transport and returns the responses by ID.
+func serve(t *testing.T, s *Server, messages ...string) map[int]testResponse {
+	t.Helper()
+	var out bytes.Buffer
+	if err := s.Serve(context.Background(), strings.NewReader(strings.Join(messages, "\n")+"\n"), &out); err != nil {
+		t.Fatal(err)
+	}
+	responses := map[int]testResponse{}
+	for _, line := range strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n") {
+		var resp testResponse
+		if err := json.Unmarshal([]byte(line), &resp); err != nil {
+			t.Fatalf("invalid response %q: %v", line, err)
+		}
+		responses[resp.ID] = resp
+	}
+	return responses
+}
+
+func TestServerRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	promptsDir := filepath.Join(dir, "prompts")
+	root := filepath.Join(dir, "root")
+	for path, text := range map[string]string{
+		filepath.Join(promptsDir, "en", "translate.txt"): "Translate the text into {{language}}.\n",
+		filepath.Join(promptsDir, "upper.txt"):           "Make the text upper case.\n",
+		filepath.Join(root, "a.txt"):                     "file text",
+	} {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var mu sync.Mutex
+	var usages []string
+	s := New(Options{
+		Version:    "test",
+		Defaults:   runner.Config{Model: "gpt-4o", NoCache: true, MaxCompletionRepeatCount: 1},
+		Root:       root,
+		Library:    prompts.NewLibrary(promptsDir),
+		GAIFactory: mockFactory,
+		OnUsage: func(prompt, inputPath string, _ *openai.UsageCost) {
+			mu.Lock()
+			defer mu.Unlock()
+			usages = append(usages, prompt+" "+inputPath)
+		},
+	})
+
+	responses := serve(t, s,
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-03-26"}}`,
+		`{"jsonrpc":"2.0","method":"notifications/initialized"}`,
+		`{"jsonrpc":"2.0","id":2,"method":"tools/list"}`,
+		`{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"upper","arguments":{"input":"hello","diff":true}}}`,
+		`{"jsonrpc":"2.0","id":4,"method":"tools/call","params":{"name":"en_translate","arguments":{"file_path":"a.txt","language":"English"}}}`,
+		`{"jsonrpc":"2.0","id":5,"method":"tools/call","params":{"name":"upper","arguments":{"file_path":"../prompts/upper.txt"}}}`,
+		`{"jsonrpc":"2.0","id":6,"method":"tools/call","params":{"name":"missing","arguments":{"input":"hello"}}}`,
+		`{"jsonrpc":"2.0","id":7,"method":"unknown/method"}`,
+	)
+	if len(responses) != 7 {
+		t.Fatalf("responses = %d, want 7 without one for the notification", len(responses))
+	}
+
+	var initResult initializeResult
+	if err := json.Unmarshal(responses[1].Result, &initResult); err != nil {
+		t.Fatal(err)
+	}
+	if initResult.ProtocolVersion != "2025-03-26" || initResult.ServerInfo.Version != "test" {
+		t.Errorf("initialize = %+v", initResult)
+	}
+
+	var list listToolsResult
+	if err := json.Unmarshal(responses[2].Result, &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Tools) != 2 || list.Tools[0].Name != "en_translate" || list.Tools[1].Name != "upper" {
+		t.Fatalf("tools/list = %+v, want en_translate and upper", list.Tools)
+	}
+	if translate := list.Tools[0]; translate.Description != "Translate the text into {{language}}." ||
+		len(translate.InputSchema.Required) != 1 || translate.InputSchema.Required[0] != "language" {
+		t.Errorf("en_translate = %+v, want the language variable required", translate)
+	}
+
+	callResult := func(id int) callToolResult {
+		t.Helper()
+		if responses[id].Error != nil {
+			t.Fatalf("response %d error = %+v", id, responses[id].Error)
+		}
+		var r callToolResult
+		if err := json.Unmarshal(responses[id].Result, &r); err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+	if r := callResult(3); r.IsError || len(r.Content) != 2 || r.Content[0].Text != "HELLO\n" || !strings.Contains(r.Content[1].Text, "+HELLO") {
+		t.Errorf("tools/call with input = %+v, want HELLO and the diff", r)
+	}
+	if r := callResult(4); r.IsError || len(r.Content) != 1 || r.Content[0].Text != "FILE TEXT\n" {
+		t.Errorf("tools/call with file_path = %+v, want FILE TEXT", r)
+	}
+	if r := callResult(5); !r.IsError || !strings.Contains(r.Content[0].Text, ErrFilePathOutsideRoot.Error()) {
+		t.Errorf("tools/call outside the root = %+v, want an error result", r)
+	}
+	if e := responses[6].Error; e == nil || e.Code != codeInvalidParams {
+		t.Errorf("tools/call of a missing tool error = %+v, want invalid params", e)
+	}
+	if e := responses[7].Error; e == nil || e.Code != codeMethodNotFound {
+		t.Errorf("unknown method error = %+v, want method not found", e)
+	}
+	if len(usages) != 2 {
+		t.Errorf("usages = %q, want the 2 successful calls", usages)
+	}
+}
+
+func TestServerParseError(t *testing.T) {
+	s := New(Options{})
+	var out bytes.Buffer
+	if err := s.Serve(context.Background(), strings.NewReader("{broken\n"), &out); err != nil {
+		t.Fatal(err)
+	}
+	var resp response
+	var rpcErr rpcError
+	resp.Error = &rpcErr
+	if err := json.Unmarshal(out.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if string(resp.ID) != "null" || rpcErr.Code != codeParseError {
+		t.Errorf("response = %s, want a parse error with a null id", out.String())
+	}
+}
@@ -0,0 +1,205 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/ytka/textforge/internal/openai"
+	"github.com/ytka/textforge/internal/prompts"
+	"github.com/ytka/textforge/internal/runner"
+	"github.com/ytka/textforge/internal/steps"
+)
+
+// Reserved arguments of the tools. Prompt variables of the same names are not exposed.
+const (
+	argInput    = "input"
+	argFilePath = "file_path"
+	argDiff     = "diff"
+)
+
+var (
+	// ErrNoInput is an error when a tool call has neither the input nor the file path.
+	ErrNoInput = errors.New("either input or file_path must be provided")
+	// ErrFilePathOutsideRoot is an error when the file_path of a tool call is not inside the root directory, or no root directory is configured.
+	ErrFilePathOutsideRoot = errors.New("file_path is outside the root directory")
+	// ErrFilePathHidden is an error when the file_path of a tool call is or is in a hidden file or directory, such as .env or .git.
+	ErrFilePathHidden = errors.New("file_path is a hidden file or directory")
+)
+
+// toolName converts the prompt name to the tool name, which allows only letters, digits, '_' and '-'.
+func toolName(promptName string) string {
+	return strings.ReplaceAll(promptName, "/", "_")
+}
+
+// listTools returns the tool of each prompt in the library.
+func (s *Server) listTools() ([]Tool, error) {
+	list, err := s.opts.Library.List()
+	if err != nil {
+		return nil, err
+	}
+	tools := make([]Tool, 0, len(list))
+	for _, p := range list {
+		tools = append(tools, newTool(p))
+	}
+	return tools, nil
+}
+
+// newTool creates the tool of the prompt, with the input schema of the input text and the prompt variables.
+func newTool(p *prompts.Prompt) Tool {
+	schema := JSONSchema{
+		Type: "object",
+		Properties: map[string]JSONSchema{
+			argInput:    {Type: "string", Description: "Text to process. Either input or file_path is required."},
+			argFilePath: {Type: "string", Description: "Path of the file to process, read when input is empty. Also tells the prompt the file type."},
+			argDiff:     {Type: "boolean", Description: "Return the unified diff of the input and the result as well."},
+		},
+	}
+	for _, v := range p.Variables() {
+		if _, ok := schema.Properties[v]; ok {
+			continue
+		}
+		schema.Properties[v] = JSONSchema{Type: "string", Description: fmt.Sprintf("Value of {{%s}} in the prompt.", v)}
+		schema.Required = append(schema.Required, v)
+	}
+	return Tool{Name: toolName(p.Name), Description: p.Description(), InputSchema: schema}
+}
+
+// findPrompt returns the prompt of the tool name.
+func (s *Server) findPrompt(name string) (*prompts.Prompt, error) {
+	list, err := s.opts.Library.List()
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range list {
+		if toolName(p.Name) == name {
+			return p, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", prompts.ErrPromptNotFound, name)
+}
+
+// callTool shapes the input with the prompt of the tool. Failures of the call are reported in the result for the model to see.
+func (s *Server) callTool(ctx context.Context, params json.RawMessage) (any, error) {
+	var p callToolParams
+	if err := unmarshalParams(params, &p); err != nil {
+		return nil, err
+	}
+	prompt, err := s.findPrompt(p.Name)
+	if errors.Is(err, prompts.ErrPromptNotFound) {
+		return nil, newRPCError(codeInvalidParams, err.Error())
+	}
+	if err != nil {
+		return nil, err
+	}
+	var args map[string]any
+	if len(p.Arguments) > 0 {
+		if err := json.Unmarshal(p.Arguments, &args); err != nil {
+			return nil, newRPCError(codeInvalidParams, "invalid arguments: "+err.Error())
+		}
+	}
+
+	result, err := s.shape(ctx, prompt, args)
+	if err != nil {
+		return &callToolResult{Content: []content{{Type: "text", Text: err.Error()}}, IsError: true}, nil
+	}
+	return result, nil
+}
+
+// readInputFile reads the file at the path relative to the root directory. Paths escaping the root, also through symbolic links,
+// and hidden files and directories are rejected.
+func (s *Server) readInputFile(path string) (string, error) {
+	if s.opts.Root == "" {
+		return "", fmt.Errorf("%w: %s", ErrFilePathOutsideRoot, path)
+	}
+	clean := filepath.Clean(filepath.FromSlash(path))
+	if filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%w: %s", ErrFilePathOutsideRoot, path)
+	}
+	root, err := filepath.EvalSymlinks(s.opts.Root)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve root directory: %w", err)
+	}
+	resolved, err := filepath.EvalSymlinks(filepath.Join(root, clean))
+	if err != nil {
+		return "", fmt.Errorf("error reading input file: %w", err)
+	}
+	rel, err := filepath.Rel(root, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%w: %s", ErrFilePathOutsideRoot, path)
+	}
+	if hasHidden(clean) || hasHidden(rel) {
+		return "", fmt.Errorf("%w: %s", ErrFilePathHidden, path)
+	}
+	return steps.GetInputText(resolved)
+}
+
+// hasHidden reports whether any component of the relative path is hidden.
+func hasHidden(rel string) bool {
+	for _, name := range strings.Split(rel, string(filepath.Separator)) {
+		if strings.HasPrefix(name, ".") && name != "." && name != ".." {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) shape(ctx context.Context, prompt *prompts.Prompt, args map[string]any) (*callToolResult, error) {
+	values := map[string]string{}
+	for k, v := range args {
+		if str, ok := v.(string); ok {
+			values[k] = str
+		} else {
+			values[k] = fmt.Sprint(v)
+		}
+	}
+	promptText, err := prompt.Render(values)
+	if err != nil {
+		return nil, err
+	}
+	inputPath := values[argFilePath]
+	inputText := values[argInput]
+	if inputText == "" {
+		if inputPath == "" {
+			return nil, ErrNoInput
+		}
+		if inputText, err = s.readInputFile(inputPath); err != nil {
+			return nil, err
+		}
+	}
+
+	config := s.opts.Defaults
+	config.Prompt, config.PromptPath = promptText, ""
+	shaper, err := runner.NewShaper(&config, s.opts.GAIFactory)
+	if err != nil {
+		return nil, err
+	}
+	result, err := shaper.Shape(ctx, shaper.MakeShapePrompt(inputPath, promptText, inputText))
+	if err != nil {
+		return nil, fmt.Errorf("failed to shape text: %w", err)
+	}
+	if s.opts.OnUsage != nil {
+		name := inputPath
+		if name == "" {
+			name = "-"
+		}
+		s.opts.OnUsage(prompt.Name, name, openai.NewUsageCost(result.ChatCompletion))
+	}
+
+	res := &callToolResult{Content: []content{{Type: "text", Text: result.Result}}}
+	if args[argDiff] == true {
+		name := inputPath
+		if name == "" {
+			name = argInput
+		}
+		d := steps.Diff(name, inputText, result.Result, steps.DiffOption{Format: steps.DiffFormatUnified, ContextLines: config.DiffContext})
+		if d == "" {
+			d = "No changes"
+		}
+		res.Content = append(res.Content, content{Type: "text", Text: d})
+	}
+	return res, nil
+}
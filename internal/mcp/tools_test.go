@@ -0,0 +1,71 @@
+package mcp
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestServerReadInputFile(t *testing.T) {
+	tmp := t.TempDir()
+	root := filepath.Join(tmp, "root")
+	for _, dir := range []string{filepath.Join(root, "sub"), filepath.Join(root, ".git")} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for path, text := range map[string]string{
+		filepath.Join(root, "sub", "a.txt"):   "inside",
+		filepath.Join(root, ".env"):           "API_KEY=secret",
+		filepath.Join(root, ".git", "config"): "[core]",
+		filepath.Join(tmp, "secret.txt"):      "outside",
+	} {
+		if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for link, target := range map[string]string{
+		"link.txt":     filepath.Join(tmp, "secret.txt"),
+		"link-env.txt": filepath.Join(root, ".env"),
+	} {
+		if err := os.Symlink(target, filepath.Join(root, link)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		root    string
+		path    string
+		want    string
+		wantErr error
+	}{
+		{name: "inside", root: root, path: "sub/a.txt", want: "inside"},
+		{name: "cleaned inside", root: root, path: "sub/../sub/a.txt", want: "inside"},
+		{name: "parent", root: root, path: "../secret.txt", wantErr: ErrFilePathOutsideRoot},
+		{name: "nested parent", root: root, path: "sub/../../secret.txt", wantErr: ErrFilePathOutsideRoot},
+		{name: "absolute", root: root, path: filepath.Join(tmp, "secret.txt"), wantErr: ErrFilePathOutsideRoot},
+		{name: "absolute inside", root: root, path: filepath.Join(root, "sub", "a.txt"), wantErr: ErrFilePathOutsideRoot},
+		{name: "symlink outside", root: root, path: "link.txt", wantErr: ErrFilePathOutsideRoot},
+		{name: "hidden file", root: root, path: ".env", wantErr: ErrFilePathHidden},
+		{name: "hidden directory", root: root, path: ".git/config", wantErr: ErrFilePathHidden},
+		{name: "symlink to hidden", root: root, path: "link-env.txt", wantErr: ErrFilePathHidden},
+		{name: "no root", root: "", path: "sub/a.txt", wantErr: ErrFilePathOutsideRoot},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New(Options{Root: tt.root})
+			got, err := s.readInputFile(tt.path)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("readInputFile(%q) error = %v, want %v", tt.path, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("readInputFile(%q) = %q, %v, want %q", tt.path, got, err, tt.want)
+			}
+		})
+	}
+}
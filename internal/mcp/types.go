@@ -0,0 +1,85 @@
+package mcp
+
+import "encoding/json"
+
+// The types of the Model Context Protocol messages used by the server.
+
+type initializeParams struct {
+	ProtocolVersion string `json:"protocolVersion"`
+}
+
+type initializeResult struct {
+	ProtocolVersion string         `json:"protocolVersion"`
+	Capabilities    map[string]any `json:"capabilities"`
+	ServerInfo      serverInfo     `json:"serverInfo"`
+}
+
+type serverInfo struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// Tool is a tool of the server, a prompt of the library.
+type Tool struct {
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	InputSchema JSONSchema `json:"inputSchema"`
+}
+
+// JSONSchema is the JSON schema of the tool arguments.
+type JSONSchema struct {
+	Type       string                `json:"type"`
+	Properties map[string]JSONSchema `json:"properties,omitempty"`
+	Required   []string              `json:"required,omitempty"`
+	// Description is the description of a property.
+	Description string `json:"description,omitempty"`
+}
+
+type listToolsResult struct {
+	Tools []Tool `json:"tools"`
+}
+
+type callToolParams struct {
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+type callToolResult struct {
+	Content []content `json:"content"`
+	IsError bool      `json:"isError,omitempty"`
+}
+
+type content struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// Resource is a resource of the server.
+type Resource struct {
+	URI         string `json:"uri"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	MimeType    string `json:"mimeType"`
+}
+
+type listResourcesResult struct {
+	Resources []Resource `json:"resources"`
+}
+
+type readResourceParams struct {
+	URI string `json:"uri"`
+}
+
+type readResourceResult struct {
+	Contents []resourceContents `json:"contents"`
+}
+
+type resourceContents struct {
+	URI      string `json:"uri"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type cancelledParams struct {
+	RequestID json.RawMessage `json:"requestId"`
+}
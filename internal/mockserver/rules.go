@@ -0,0 +1,138 @@
+package mockserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ErrInvalidTransform is an error when the transform of a rule is unknown.
+var ErrInvalidTransform = errors.New("invalid transform")
+
+// Transform is the way the reply is generated from the input.
+type Transform string
+
+const (
+	TransformEcho    Transform = "echo"
+	TransformUpper   Transform = "upper"
+	TransformLower   Transform = "lower"
+	TransformReverse Transform = "reverse"
+)
+
+// ParseTransform parses the transform.
+func ParseTransform(s string) (Transform, error) {
+	switch t := Transform(s); t {
+	case TransformEcho, TransformUpper, TransformLower, TransformReverse:
+		return t, nil
+	}
+	return "", fmt.Errorf("%w: %s", ErrInvalidTransform, s)
+}
+
+// Rule scripts the reply to the prompts matching the pattern.
+type Rule struct {
+	// Match is the regular expression matched against the last user message. Empty matches any prompt.
+	Match string `yaml:"match" json:"match"`
+	// Response is the reply. $1 and ${name} are expanded with the submatches of Match.
+	Response string `yaml:"response" json:"response"`
+	// Transform generates the reply from the input instead of Response.
+	Transform Transform `yaml:"transform" json:"transform"`
+	// Status, if 400 or more, replies with the error of the status code, such as 429 or 500.
+	Status int `yaml:"status" json:"status"`
+	// Error is the message of the error reply.
+	Error string `yaml:"error" json:"error"`
+	// FinishReason "length" truncates the reply to half, as if it hit the max tokens.
+	FinishReason string `yaml:"finish_reason" json:"finish_reason"`
+	// Delay delays the reply, such as "500ms".
+	Delay string `yaml:"delay" json:"delay"`
+	// Times limits the number of the replies by the rule, so that a retry gets the next rule. 0 is unlimited.
+	Times int `yaml:"times" json:"times"`
+	// ToolCalls, if set, replies with the calls of the tools instead of a text. Combine with Times to answer after the tool results.
+	ToolCalls []ToolCall `yaml:"tool_calls" json:"tool_calls"`
+
+	re    *regexp.Regexp
+	delay time.Duration
+	used  int
+}
+
+// ToolCall is a scripted call of a tool.
+type ToolCall struct {
+	// Name is the name of the tool.
+	Name string `yaml:"name" json:"name"`
+	// Arguments is the JSON encoded arguments.
+	Arguments string `yaml:"arguments" json:"arguments"`
+}
+
+// fixtureFile is the format of a fixture file.
+type fixtureFile struct {
+	Rules []*Rule `yaml:"rules" json:"rules"`
+}
+
+// compile parses the pattern and the delay of the rule.
+func (r *Rule) compile() error {
+	var err error
+	if r.re, err = regexp.Compile(r.Match); err != nil {
+		return fmt.Errorf("invalid match %q: %w", r.Match, err)
+	}
+	if r.Delay != "" {
+		if r.delay, err = time.ParseDuration(r.Delay); err != nil {
+			return fmt.Errorf("invalid delay %q: %w", r.Delay, err)
+		}
+	}
+	if r.Transform != "" {
+		if _, err := ParseTransform(string(r.Transform)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadRules reads the rules of the fixture files (*.yaml, *.yml, *.json) in dir in the order of the file names.
+func LoadRules(dir string) ([]*Rule, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fixtures directory: %w", err)
+	}
+	var names []string
+	for _, e := range entries {
+		switch strings.ToLower(filepath.Ext(e.Name())) {
+		case ".yaml", ".yml", ".json":
+			if !e.IsDir() {
+				names = append(names, e.Name())
+			}
+		}
+	}
+	sort.Strings(names)
+
+	var rules []*Rule
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read fixture: %w", err)
+		}
+		var f fixtureFile
+		if filepath.Ext(name) == ".json" {
+			err = json.Unmarshal(data, &f)
+		} else {
+			err = yaml.Unmarshal(data, &f)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse fixture %s: %w", path, err)
+		}
+		for i, r := range f.Rules {
+			if err := r.compile(); err != nil {
+				return nil, fmt.Errorf("%s: rule %d: %w", path, i+1, err)
+			}
+		}
+		rules = append(rules, f.Rules...)
+	}
+	return rules, nil
+}
@@ -0,0 +1,293 @@
+package mockserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ytka/textforge/internal/openai"
+	"github.com/ytka/textforge/internal/tokenizer"
+)
+
+const (
+	inputOpenTag   = "<textforge-input>\n"
+	inputCloseTag  = "\n</textforge-input>"
+	streamChunkLen = 16
+)
+
+// Server is a mock of the OpenAI chat completions API. Replies are scripted by rules, or generated from the input by the default transform.
+type Server struct {
+	mu               sync.Mutex
+	rules            []*Rule
+	defaultTransform Transform
+	verbose          bool
+}
+
+var _ http.Handler = (*Server)(nil)
+
+// New creates a server with the rules, falling back to the default transform for prompts matching no rule.
+func New(rules []*Rule, defaultTransform Transform, verbose bool) *Server {
+	return &Server{rules: rules, defaultTransform: defaultTransform, verbose: verbose}
+}
+
+// ServeHTTP serves /v1/chat/completions.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.TrimSuffix(r.URL.Path, "/") != "/v1/chat/completions" {
+		writeError(w, http.StatusNotFound, "invalid_request_error", fmt.Sprintf("Unknown request URL: %s %s", r.Method, r.URL.Path))
+		return
+	}
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "invalid_request_error", "Only POST is supported")
+		return
+	}
+	var req openai.CreateChatCompletion
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", fmt.Sprintf("Invalid request body: %v", err))
+		return
+	}
+	if len(req.Messages) == 0 {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "messages must not be empty")
+		return
+	}
+
+	prompt := lastUserMessage(req.Messages)
+	rule, submatches := s.match(prompt)
+	if s.verbose {
+		log.Printf("request: model=%s stream=%t rule=%q", req.Model, req.Stream, ruleName(rule))
+	}
+	if rule != nil && rule.delay > 0 {
+		select {
+		case <-time.After(rule.delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	if rule != nil && rule.Status >= 400 {
+		message := rule.Error
+		if message == "" {
+			message = http.StatusText(rule.Status)
+		}
+		if rule.Status == http.StatusTooManyRequests {
+			w.Header().Set("Retry-After", "1")
+		}
+		writeError(w, rule.Status, errorType(rule.Status), message)
+		return
+	}
+
+	comp, err := s.complete(&req, prompt, rule, submatches)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+	if req.Stream {
+		writeStream(w, comp)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(comp)
+}
+
+// match returns the first rule matching the prompt that has replies left, and the submatches.
+func (s *Server) match(prompt string) (*Rule, []int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, r := range s.rules {
+		if r.Times > 0 && r.used >= r.Times {
+			continue
+		}
+		if m := r.re.FindStringSubmatchIndex(prompt); m != nil {
+			r.used++
+			return r, m
+		}
+	}
+	return nil, nil
+}
+
+// complete creates the completion with usage counted by the tokenizer of the model.
+func (s *Server) complete(req *openai.CreateChatCompletion, prompt string, rule *Rule, submatches []int) (*openai.ChatCompletion, error) {
+	tok, err := tokenizer.ForModel(req.Model)
+	if err != nil {
+		return nil, err
+	}
+	if rule != nil && len(rule.ToolCalls) > 0 {
+		return s.completeToolCalls(req, rule, tok), nil
+	}
+	content := s.reply(prompt, rule, submatches)
+	finishReason := "stop"
+	completionTokens := tok.Count(content)
+	if rule != nil && rule.FinishReason == "length" {
+		content, finishReason = truncate(content, 1, 2), "length"
+	}
+	if req.MaxTokens != nil && *req.MaxTokens > 0 && completionTokens > *req.MaxTokens {
+		content, finishReason = truncate(content, *req.MaxTokens, completionTokens), "length"
+	}
+	completionTokens = tok.Count(content)
+
+	return newCompletion(req, tok, openai.ChatMessage{Role: "assistant", Content: content}, finishReason, completionTokens), nil
+}
+
+// completeToolCalls creates the completion calling the tools of the rule.
+func (s *Server) completeToolCalls(req *openai.CreateChatCompletion, rule *Rule, tok *tokenizer.Tokenizer) *openai.ChatCompletion {
+	message := openai.ChatMessage{Role: "assistant"}
+	completionTokens := 0
+	for i, tc := range rule.ToolCalls {
+		message.ToolCalls = append(message.ToolCalls, openai.ToolCall{
+			ID:       fmt.Sprintf("call_mock%d_%d", rule.used, i),
+			Type:     "function",
+			Function: openai.FunctionCall{Name: tc.Name, Arguments: tc.Arguments},
+		})
+		completionTokens += tok.Count(tc.Name) + tok.Count(tc.Arguments)
+	}
+	return newCompletion(req, tok, message, "tool_calls", completionTokens)
+}
+
+// newCompletion creates the completion of the message with the prompt tokens counted from the request messages.
+func newCompletion(req *openai.CreateChatCompletion, tok *tokenizer.Tokenizer, message openai.ChatMessage, finishReason string, completionTokens int) *openai.ChatCompletion {
+	promptTokens := 0
+	for _, m := range req.Messages {
+		promptTokens += tok.CountChatPrompt(m.Content)
+	}
+	now := time.Now()
+	comp := &openai.ChatCompletion{
+		ID:                "chatcmpl-mock" + strconv.FormatInt(now.UnixNano(), 36),
+		Object:            "chat.completion",
+		Created:           int(now.Unix()),
+		Model:             req.Model,
+		SystemFingerprint: "fp_mock",
+	}
+	comp.Choices = append(comp.Choices, struct {
+		FinishReason string             `json:"finish_reason"`
+		Index        int                `json:"index"`
+		Message      openai.ChatMessage `json:"message"`
+	}{FinishReason: finishReason, Message: message})
+	comp.Usage = openai.Usage{PromptTokens: promptTokens, CompletionTokens: completionTokens, TotalTokens: promptTokens + completionTokens}
+	return comp
+}
+
+// reply returns the scripted response of the rule, or the input transformed.
+func (s *Server) reply(prompt string, rule *Rule, submatches []int) string {
+	transform := s.defaultTransform
+	if rule != nil {
+		if rule.Transform == "" {
+			return string(rule.re.ExpandString(nil, rule.Response, prompt, submatches))
+		}
+		transform = rule.Transform
+	}
+	// A textforge prompt gets the input transformed in the output tag, like a model following the instruction.
+	i := strings.Index(prompt, inputOpenTag)
+	j := strings.LastIndex(prompt, inputCloseTag)
+	if i < 0 || j < i+len(inputOpenTag) {
+		return applyTransform(transform, prompt)
+	}
+	return "<textforge-output>\n" + applyTransform(transform, prompt[i+len(inputOpenTag):j]) + "\n</textforge-output>"
+}
+
+func applyTransform(t Transform, text string) string {
+	switch t {
+	case TransformUpper:
+		return strings.ToUpper(text)
+	case TransformLower:
+		return strings.ToLower(text)
+	case TransformReverse:
+		lines := strings.Split(text, "\n")
+		slices.Reverse(lines)
+		return strings.Join(lines, "\n")
+	}
+	return text
+}
+
+// truncate keeps about num/den of the text.
+func truncate(text string, num, den int) string {
+	runes := []rune(text)
+	return string(runes[:len(runes)*num/den])
+}
+
+func lastUserMessage(messages []openai.ChatMessage) string {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == "user" {
+			return messages[i].Content
+		}
+	}
+	return messages[len(messages)-1].Content
+}
+
+func ruleName(r *Rule) string {
+	if r == nil {
+		return "(default)"
+	}
+	return r.Match
+}
+
+func errorType(status int) string {
+	switch {
+	case status == http.StatusTooManyRequests:
+		return "rate_limit_exceeded"
+	case status >= 500:
+		return "server_error"
+	}
+	return "invalid_request_error"
+}
+
+func writeError(w http.ResponseWriter, status int, errType, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(openai.ErrorResponse{Error: openai.ErrorDetail{Message: message, Type: errType, Code: errType}})
+}
+
+// writeStream sends the completion as server-sent events of chunks, ending with the finish reason, the usage and [DONE].
+// The content and the arguments of the tool calls are split into chunks of streamChunkLen runes.
+func writeStream(w http.ResponseWriter, comp *openai.ChatCompletion) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	flusher, _ := w.(http.Flusher)
+	send := func(chunk *openai.ChatCompletionChunk) {
+		data, _ := json.Marshal(chunk)
+		_, _ = fmt.Fprintf(w, "data: %s\n\n", data)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	newChunk := func(delta openai.ChunkDelta, finishReason *string) *openai.ChatCompletionChunk {
+		return &openai.ChatCompletionChunk{
+			ID: comp.ID, Object: "chat.completion.chunk", Created: comp.Created, Model: comp.Model, SystemFingerprint: comp.SystemFingerprint,
+			Choices: []openai.ChunkChoice{{Delta: delta, FinishReason: finishReason}},
+		}
+	}
+
+	choice := comp.Choices[0]
+	send(newChunk(openai.ChunkDelta{Role: "assistant"}, nil))
+	for _, part := range splitRunes(choice.Message.Content, streamChunkLen) {
+		send(newChunk(openai.ChunkDelta{Content: part}, nil))
+	}
+	for i, tc := range choice.Message.ToolCalls {
+		send(newChunk(openai.ChunkDelta{ToolCalls: []openai.ToolCallDelta{{
+			Index: i, ID: tc.ID, Type: tc.Type, Function: openai.FunctionCallDelta{Name: tc.Function.Name},
+		}}}, nil))
+		for _, part := range splitRunes(tc.Function.Arguments, streamChunkLen) {
+			send(newChunk(openai.ChunkDelta{ToolCalls: []openai.ToolCallDelta{{Index: i, Function: openai.FunctionCallDelta{Arguments: part}}}}, nil))
+		}
+	}
+	last := newChunk(openai.ChunkDelta{}, &choice.FinishReason)
+	last.Usage = &comp.Usage
+	send(last)
+	_, _ = fmt.Fprint(w, "data: [DONE]\n\n")
+	if flusher != nil {
+		flusher.Flush()
+	}
+}
+
+// splitRunes splits text into parts of n runes.
+func splitRunes(text string, n int) []string {
+	runes := []rune(text)
+	var parts []string
+	for i := 0; i < len(runes); i += n {
+		parts = append(parts, string(runes[i:min(i+n, len(runes))]))
+	}
+	return parts
+}
@@ -0,0 +1,257 @@
+package mockserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/ytka/textforge/internal/openai"
+)
+
+const testFixture = `rules:
+  - match: "^rate limited"
+    status: 429
+    times: 1
+  - match: "^rate limited"
+    response: "recovered"
+  - match: "^weather in (?P<city>\\w+)"
+    response: "sunny in ${city}"
+  - match: "^long"
+    response: "0123456789"
+    finish_reason: length
+  - match: "^call"
+    tool_calls:
+      - name: read_file
+        arguments: '{"path": "internal/mockserver/server.go"}'
+      - name: list_files
+        arguments: '{}'
+`
+
+// newTestServer creates a server with the rules of the fixture, loaded from a fixture file.
+func newTestServer(t *testing.T, fixture string) *Server {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "rules.yaml"), []byte(fixture), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	rules, err := LoadRules(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return New(rules, TransformUpper, false)
+}
+
+func post(t *testing.T, s *Server, prompt string, stream bool, maxTokens *int) *httptest.ResponseRecorder {
+	t.Helper()
+	body, err := json.Marshal(openai.CreateChatCompletion{
+		Model: "gpt-4o", Messages: []openai.ChatMessage{{Role: "user", Content: prompt}}, Stream: stream, MaxTokens: maxTokens,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewReader(body)))
+	return rec
+}
+
+func decodeCompletion(t *testing.T, rec *httptest.ResponseRecorder) *openai.ChatCompletion {
+	t.Helper()
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+	}
+	var comp openai.ChatCompletion
+	if err := json.Unmarshal(rec.Body.Bytes(), &comp); err != nil {
+		t.Fatal(err)
+	}
+	return &comp
+}
+
+// decodeStream parses the server-sent events of the response, checking that they end with [DONE].
+func decodeStream(t *testing.T, rec *httptest.ResponseRecorder) []openai.ChatCompletionChunk {
+	t.Helper()
+	if ct := rec.Header().Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type = %q, want text/event-stream", ct)
+	}
+	events := strings.Split(strings.TrimSuffix(rec.Body.String(), "\n\n"), "\n\n")
+	if events[len(events)-1] != "data: [DONE]" {
+		t.Fatalf("last event = %q, want [DONE]", events[len(events)-1])
+	}
+	chunks := make([]openai.ChatCompletionChunk, len(events)-1)
+	for i, e := range events[:len(events)-1] {
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(e, "data: ")), &chunks[i]); err != nil {
+			t.Fatalf("event %d: %v", i, err)
+		}
+	}
+	return chunks
+}
+
+func TestServerRules(t *testing.T) {
+	tests := []struct {
+		name             string
+		prompt           string
+		wantContent      string
+		wantFinishReason string
+	}{
+		{name: "named submatch", prompt: "weather in Tokyo", wantContent: "sunny in Tokyo", wantFinishReason: "stop"},
+		{name: "length", prompt: "long", wantContent: "01234", wantFinishReason: "length"},
+		{name: "default transform", prompt: "no rule", wantContent: "NO RULE", wantFinishReason: "stop"},
+		{name: "default transform of the input tag", prompt: "Fix it.\n<textforge-input>\nhello\n</textforge-input>",
+			wantContent: "<textforge-output>\nHELLO\n</textforge-output>", wantFinishReason: "stop"},
+	}
+	s := newTestServer(t, testFixture)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			comp := decodeCompletion(t, post(t, s, tt.prompt, false, nil))
+			choice := comp.Choices[0]
+			if choice.Message.Content != tt.wantContent || choice.FinishReason != tt.wantFinishReason {
+				t.Errorf("reply = %q (%s), want %q (%s)", choice.Message.Content, choice.FinishReason, tt.wantContent, tt.wantFinishReason)
+			}
+			if comp.Usage.PromptTokens == 0 || comp.Usage.TotalTokens != comp.Usage.PromptTokens+comp.Usage.CompletionTokens {
+				t.Errorf("usage = %+v", comp.Usage)
+			}
+		})
+	}
+}
+
+func TestServerTimes(t *testing.T) {
+	s := newTestServer(t, testFixture)
+	rec := post(t, s, "rate limited", false, nil)
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" {
+		t.Fatalf("first reply = %d, Retry-After %q, want 429 with Retry-After", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	var errResp openai.ErrorResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &errResp); err != nil || errResp.Error.Type != "rate_limit_exceeded" {
+		t.Errorf("error = %s, want rate_limit_exceeded", rec.Body)
+	}
+	// The rule is used up, so the retry falls through to the next rule.
+	for range 2 {
+		if got := decodeCompletion(t, post(t, s, "rate limited", false, nil)).Choices[0].Message.Content; got != "recovered" {
+			t.Errorf("retry reply = %q, want recovered", got)
+		}
+	}
+}
+
+func TestServerMaxTokens(t *testing.T) {
+	s := newTestServer(t, testFixture)
+	maxTokens := 2
+	comp := decodeCompletion(t, post(t, s, strings.Repeat("word ", 20), false, &maxTokens))
+	if comp.Choices[0].FinishReason != "length" || comp.Usage.CompletionTokens > maxTokens+1 {
+		t.Errorf("reply = %q (%s), %d tokens, want it truncated to about %d tokens",
+			comp.Choices[0].Message.Content, comp.Choices[0].FinishReason, comp.Usage.CompletionTokens, maxTokens)
+	}
+}
+
+func TestServerStream(t *testing.T) {
+	s := newTestServer(t, testFixture)
+	prompt := "Fix it.\n<textforge-input>\n" + strings.Repeat("héllo wörld ", 5) + "\n</textforge-input>"
+	want := decodeCompletion(t, post(t, s, prompt, false, nil))
+	chunks := decodeStream(t, post(t, s, prompt, true, nil))
+
+	if chunks[0].Choices[0].Delta.Role != "assistant" {
+		t.Errorf("first delta = %+v, want the role", chunks[0].Choices[0].Delta)
+	}
+	var content strings.Builder
+	for _, c := range chunks[1 : len(chunks)-1] {
+		part := c.Choices[0].Delta.Content
+		if n := utf8.RuneCountInString(part); n == 0 || n > streamChunkLen {
+			t.Errorf("chunk of %d runes, want 1 to %d", n, streamChunkLen)
+		}
+		content.WriteString(part)
+	}
+	if content.String() != want.Choices[0].Message.Content {
+		t.Errorf("streamed content = %q, want %q", content.String(), want.Choices[0].Message.Content)
+	}
+	last := chunks[len(chunks)-1]
+	if fr := last.Choices[0].FinishReason; fr == nil || *fr != "stop" {
+		t.Errorf("last finish reason = %v, want stop", fr)
+	}
+	if last.Usage == nil || *last.Usage != want.Usage {
+		t.Errorf("last usage = %+v, want %+v", last.Usage, want.Usage)
+	}
+}
+
+func TestServerStreamToolCalls(t *testing.T) {
+	s := newTestServer(t, testFixture)
+	chunks := decodeStream(t, post(t, s, "call the tools", true, nil))
+
+	var calls []openai.ToolCall
+	for _, c := range chunks {
+		if c.Choices[0].Delta.Content != "" {
+			t.Errorf("content delta %q in a tool call reply", c.Choices[0].Delta.Content)
+		}
+		for _, d := range c.Choices[0].Delta.ToolCalls {
+			if d.Index == len(calls) {
+				calls = append(calls, openai.ToolCall{ID: d.ID, Type: d.Type, Function: openai.FunctionCall{Name: d.Function.Name}})
+			}
+			calls[d.Index].Function.Arguments += d.Function.Arguments
+		}
+	}
+	want := []openai.FunctionCall{
+		{Name: "read_file", Arguments: `{"path": "internal/mockserver/server.go"}`},
+		{Name: "list_files", Arguments: `{}`},
+	}
+	if len(calls) != len(want) {
+		t.Fatalf("tool calls = %+v, want %+v", calls, want)
+	}
+	for i, c := range calls {
+		if c.ID == "" || c.Type != "function" || c.Function != want[i] {
+			t.Errorf("tool call %d = %+v, want %+v", i, c, want[i])
+		}
+	}
+	if fr := chunks[len(chunks)-1].Choices[0].FinishReason; fr == nil || *fr != "tool_calls" {
+		t.Errorf("last finish reason = %v, want tool_calls", fr)
+	}
+}
+
+func TestServerInvalidRequests(t *testing.T) {
+	s := newTestServer(t, testFixture)
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		want   int
+	}{
+		{name: "unknown path", method: http.MethodPost, path: "/v1/completions", body: "{}", want: http.StatusNotFound},
+		{name: "get", method: http.MethodGet, path: "/v1/chat/completions", want: http.StatusMethodNotAllowed},
+		{name: "broken body", method: http.MethodPost, path: "/v1/chat/completions", body: "{", want: http.StatusBadRequest},
+		{name: "no messages", method: http.MethodPost, path: "/v1/chat/completions", body: `{"model": "gpt-4o"}`, want: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			s.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadRulesInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		fixture string
+	}{
+		{name: "match", fixture: "rules:\n  - match: \"(\"\n"},
+		{name: "delay", fixture: "rules:\n  - delay: soon\n"},
+		{name: "transform", fixture: "rules:\n  - transform: shout\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(dir, "rules.yaml"), []byte(tt.fixture), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := LoadRules(dir); err == nil {
+				t.Error("LoadRules() succeeded")
+			}
+		})
+	}
+}
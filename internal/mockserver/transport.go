@@ -0,0 +1,28 @@
+package mockserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+)
+
+// Transport is an http.RoundTripper serving the requests with the server in process, without a listener.
+// Any host is accepted, so that fixtures can be recorded with a fixed base URL.
+type Transport struct {
+	server *Server
+}
+
+var _ http.RoundTripper = (*Transport)(nil)
+
+// NewTransport creates a transport serving the requests with the server.
+func NewTransport(server *Server) *Transport {
+	return &Transport{server: server}
+}
+
+// RoundTrip serves the request with the server and returns its response.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rec := httptest.NewRecorder()
+	t.server.ServeHTTP(rec, req)
+	resp := rec.Result()
+	resp.Request = req
+	return resp, nil
+}
@@ -8,8 +8,12 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 )
 
+// DefaultBaseURL is the base URL of the OpenAI API.
+const DefaultBaseURL = "https://api.openai.com/v1"
+
 // ErrUnexpectedStatusCode is an error for unexpected status code.
 var ErrUnexpectedStatusCode = errors.New("unexpected status code")
 
@@ -19,6 +23,8 @@ type ChatClient struct {
 	model     string
 	logLevel  string
 	maxTokens *int
+	transport http.RoundTripper
+	baseURL   string
 }
 
 var _ GenerativeAIClient = (*ChatClient)(nil)
@@ -30,12 +36,26 @@ func New(apikey APIKey, model, logLevel string, maxTokens *int) *ChatClient {
 		model:     model,
 		logLevel:  logLevel,
 		maxTokens: maxTokens,
+		baseURL:   DefaultBaseURL,
+	}
+}
+
+// SetBaseURL sets the base URL of the API, such as a local mock server. Empty uses DefaultBaseURL.
+func (c *ChatClient) SetBaseURL(baseURL string) {
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
 	}
+	c.baseURL = strings.TrimSuffix(baseURL, "/")
+}
+
+// SetTransport sets the transport used to send the requests, such as a recording transport. nil uses http.DefaultTransport.
+func (c *ChatClient) SetTransport(transport http.RoundTripper) {
+	c.transport = transport
 }
 
 // MakeCreateChatCompletion creates a new CreateChatCompletion.
 func (c *ChatClient) MakeCreateChatCompletion(prompt string) *CreateChatCompletion {
-	return newCreateChatCompletion(c.model, prompt, c.maxTokens, false)
+	return newCreateChatCompletion(c.model, prompt, c.maxTokens)
 }
 
 // sendChatCompletionsRequest sends a request to the chat completions endpoint.
@@ -51,14 +71,14 @@ func (c *ChatClient) sendChatCompletionsRequest(ctx context.Context, ccc *Create
 		fmt.Printf("createChatCompletion: %s\n", requestBody)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", "https://api.openai.com/v1/chat/completions", bytes.NewBuffer(requestBody))
+	req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/chat/completions", bytes.NewBuffer(requestBody))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create new request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.apikey))
 
-	client := &http.Client{}
+	client := &http.Client{Transport: c.transport}
 	resp, err := client.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("request failed: %w", err)
@@ -1,43 +1,170 @@
 package openai
 
-type Pricing struct {
-	Model                  string
-	InputTokensCostDollar  float64
-	InputTokens            float64
-	OutputTokensCostDollar float64
-	OutputTokens           float64
-}
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
 
 const OneMillion = 1_000_000
 
-var pricingList = []Pricing{
-	{Model: "gpt-4o", InputTokensCostDollar: 5, InputTokens: OneMillion, OutputTokensCostDollar: 15, OutputTokens: OneMillion},
-	{Model: "gpt-4o-2024-05-13", InputTokensCostDollar: 5, InputTokens: OneMillion, OutputTokensCostDollar: 15, OutputTokens: OneMillion},
-	{Model: "gpt-3.5-turbo-0125", InputTokensCostDollar: 0.5, InputTokens: OneMillion, OutputTokensCostDollar: 1.5, OutputTokens: OneMillion},
-	{Model: "gpt-3.5-turbo-instruct", InputTokensCostDollar: 1.5, InputTokens: OneMillion, OutputTokensCostDollar: 2, OutputTokens: OneMillion},
+// Pricing is the price of a model in dollars per one million tokens.
+type Pricing struct {
+	Model         string   `yaml:"model" json:"model"`
+	Aliases       []string `yaml:"aliases,omitempty" json:"aliases,omitempty"`
+	Prefix        bool     `yaml:"prefix,omitempty" json:"prefix,omitempty"`
+	Input         float64  `yaml:"input" json:"input"`
+	CachedInput   *float64 `yaml:"cached_input,omitempty" json:"cached_input,omitempty"`
+	Output        float64  `yaml:"output" json:"output"`
+	Reasoning     *float64 `yaml:"reasoning,omitempty" json:"reasoning,omitempty"`
+	BatchDiscount *float64 `yaml:"batch_discount,omitempty" json:"batch_discount,omitempty"`
 }
 
-var pricingMap = map[string]Pricing{}
+// pricingFile is the format of the pricing files.
+type pricingFile struct {
+	Models []Pricing `yaml:"models" json:"models"`
+}
+
+//go:embed pricing.yaml
+var defaultPricingYAML []byte
+
+var (
+	pricingList []Pricing
+	pricingMu   sync.RWMutex
+)
 
 func init() {
-	for _, p := range pricingList {
-		pricingMap[p.Model] = p
+	list, err := parsePricing(defaultPricingYAML)
+	if err != nil {
+		panic(fmt.Sprintf("invalid embedded pricing: %v", err))
 	}
+	pricingList = list
 }
 
-func GetPricing(model string) *Pricing {
-	if p, ok := pricingMap[model]; ok {
-		return &p
+// parsePricing parses a pricing file in YAML or JSON.
+func parsePricing(data []byte) ([]Pricing, error) {
+	var f pricingFile
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("failed to parse pricing: %w", err)
+	}
+	for _, p := range f.Models {
+		if p.Model == "" {
+			return nil, errors.New("failed to parse pricing: model is required")
+		}
+	}
+	return f.Models, nil
+}
+
+// LoadPricingFiles overrides the pricing with the files in order. Missing files are ignored.
+// An entry replaces the one with the same model, and new models are added.
+func LoadPricingFiles(paths ...string) error {
+	pricingMu.Lock()
+	defer pricingMu.Unlock()
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read pricing file: %w", err)
+		}
+		list, err := parsePricing(data)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		pricingList = mergePricing(pricingList, list)
 	}
 	return nil
 }
 
+func mergePricing(base, overrides []Pricing) []Pricing {
+	merged := make([]Pricing, 0, len(base)+len(overrides))
+	for _, b := range base {
+		replaced := false
+		for _, o := range overrides {
+			if o.Model == b.Model {
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			merged = append(merged, b)
+		}
+	}
+	return append(merged, overrides...)
+}
+
+// GetPricing returns the pricing of the model. The model name or an alias is matched exactly first,
+// then the longest model name with prefix matching, e.g. "gpt-4o" for "gpt-4o-2024-08-06".
+func GetPricing(model string) *Pricing {
+	pricingMu.RLock()
+	defer pricingMu.RUnlock()
+
+	var matched *Pricing
+	for i := range pricingList {
+		p := &pricingList[i]
+		if p.Model == model {
+			return p
+		}
+		for _, alias := range p.Aliases {
+			if alias == model {
+				return p
+			}
+		}
+		if p.Prefix && strings.HasPrefix(model, p.Model) && (matched == nil || len(p.Model) > len(matched.Model)) {
+			matched = p
+		}
+	}
+	return matched
+}
+
+// cachedInputRate returns the price of cached input tokens.
+func (p *Pricing) cachedInputRate() float64 {
+	if p.CachedInput != nil {
+		return *p.CachedInput
+	}
+	return p.Input
+}
+
+// reasoningRate returns the price of reasoning tokens.
+func (p *Pricing) reasoningRate() float64 {
+	if p.Reasoning != nil {
+		return *p.Reasoning
+	}
+	return p.Output
+}
+
+// discount returns the multiplier of the prices.
+func (p *Pricing) discount(batch bool) float64 {
+	if batch && p.BatchDiscount != nil {
+		return *p.BatchDiscount
+	}
+	return 1
+}
+
+// InputCost returns the cost of the input tokens, of which cachedTokens are charged at the cached rate.
+func (p *Pricing) InputCost(inputTokens, cachedTokens int, batch bool) float64 {
+	uncached := float64(inputTokens - cachedTokens)
+	return (uncached*p.Input + float64(cachedTokens)*p.cachedInputRate()) * p.discount(batch) / OneMillion
+}
+
+// OutputCost returns the cost of the output tokens, of which reasoningTokens are charged at the reasoning rate.
+func (p *Pricing) OutputCost(outputTokens, reasoningTokens int, batch bool) float64 {
+	visible := float64(outputTokens - reasoningTokens)
+	return (visible*p.Output + float64(reasoningTokens)*p.reasoningRate()) * p.discount(batch) / OneMillion
+}
+
 func CalculateInputTokensCost(model string, inputTokens float64) (bool, float64) {
 	p := GetPricing(model)
 	if p == nil {
 		return false, 0
 	}
-	return true, p.InputTokensCostDollar * inputTokens / p.InputTokens
+	return true, p.InputCost(int(inputTokens), 0, false)
 }
 
 func CalculateOutputTokensCost(model string, outputTokens float64) (bool, float64) {
@@ -45,5 +172,5 @@ func CalculateOutputTokensCost(model string, outputTokens float64) (bool, float6
 	if p == nil {
 		return false, 0
 	}
-	return true, p.OutputTokensCostDollar * outputTokens / p.OutputTokens
+	return true, p.OutputCost(int(outputTokens), 0, false)
 }
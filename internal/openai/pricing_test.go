@@ -0,0 +1,58 @@
+package openai
+
+import "testing"
+
+func TestGetPricing(t *testing.T) {
+	tests := []struct {
+		model string
+		want  string
+	}{
+		{model: "gpt-4", want: "gpt-4"},
+		{model: "gpt-4-0613", want: "gpt-4"},
+		{model: "gpt-4-32k", want: "gpt-4-32k"},
+		{model: "gpt-4-32k-0613", want: "gpt-4-32k"},
+		{model: "gpt-4o-2024-08-06", want: "gpt-4o"},
+		{model: "chatgpt-4o-latest", want: "gpt-4o"},
+		{model: "unknown-model", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			var got string
+			if p := GetPricing(tt.model); p != nil {
+				got = p.Model
+			}
+			if got != tt.want {
+				t.Errorf("GetPricing(%q) = %q, want %q", tt.model, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPricingBatchDiscount(t *testing.T) {
+	half, cached := 0.5, 1.0
+	tests := []struct {
+		name       string
+		pricing    Pricing
+		batch      bool
+		wantInput  float64
+		wantOutput float64
+	}{
+		{name: "standard", pricing: Pricing{Input: 2, CachedInput: &cached, Output: 8, BatchDiscount: &half}, wantInput: 1.5, wantOutput: 8},
+		{name: "batch", pricing: Pricing{Input: 2, CachedInput: &cached, Output: 8, BatchDiscount: &half}, batch: true, wantInput: 0.75, wantOutput: 4},
+		{name: "batch without discount", pricing: Pricing{Input: 2, CachedInput: &cached, Output: 8}, batch: true, wantInput: 1.5, wantOutput: 8},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// One million tokens, half of the input cached.
+			if got := tt.pricing.InputCost(OneMillion, OneMillion/2, tt.batch); got != tt.wantInput {
+				t.Errorf("InputCost() = %v, want %v", got, tt.wantInput)
+			}
+			if got := tt.pricing.OutputCost(OneMillion, 0, tt.batch); got != tt.wantOutput {
+				t.Errorf("OutputCost() = %v, want %v", got, tt.wantOutput)
+			}
+		})
+	}
+	if p := GetPricing("gpt-4o"); p == nil || p.BatchDiscount == nil || *p.BatchDiscount != 0.5 {
+		t.Errorf("GetPricing(gpt-4o) = %+v, want the batch discount 0.5 of pricing.yaml", p)
+	}
+}
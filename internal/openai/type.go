@@ -1,6 +1,9 @@
 package openai
 
-import "context"
+import (
+	"context"
+	"encoding/json"
+)
 
 type APIKey string
 
@@ -13,6 +16,41 @@ type GenerativeAIClient interface {
 type ChatMessage struct {
 	Role    string `json:"role"`
 	Content string `json:"content"`
+	// ToolCalls are the calls of the tools requested by the assistant.
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+	// ToolCallID is the call answered by a tool message.
+	ToolCallID string `json:"tool_call_id,omitempty"`
+}
+
+// Tool is a tool the model may call, a function with the JSON schema of its arguments.
+type Tool struct {
+	Type     string             `json:"type"`
+	Function FunctionDefinition `json:"function"`
+}
+
+// FunctionDefinition describes a function the model may call.
+type FunctionDefinition struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Parameters  json.RawMessage `json:"parameters,omitempty"`
+}
+
+// ToolCall is a call of a tool by the model.
+type ToolCall struct {
+	ID       string       `json:"id"`
+	Type     string       `json:"type"`
+	Function FunctionCall `json:"function"`
+}
+
+// FunctionCall is the function and the JSON encoded arguments of a tool call.
+type FunctionCall struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+// NewToolMessage creates the message with the result of the tool call.
+func NewToolMessage(toolCallID, content string) ChatMessage {
+	return ChatMessage{Role: "tool", Content: content, ToolCallID: toolCallID}
 }
 
 // CreateChatCompletion represents the structure of a request to the OpenAI API Chat endpoint.
@@ -30,6 +68,9 @@ type CreateChatCompletion struct {
 	LogitBias        map[string]float64 `json:"logit_bias,omitempty"`
 	User             *string            `json:"user,omitempty"`
 	PresencePenalty  *float64           `json:"presence_penalty,omitempty"`
+	Stream           bool               `json:"stream,omitempty"`
+	Tools            []Tool             `json:"tools,omitempty"`
+	ToolChoice       string             `json:"tool_choice,omitempty"`
 }
 
 // ChatCompletion represents the JSON structure for the completion response.
@@ -45,15 +86,94 @@ type ChatCompletion struct {
 		Index        int         `json:"index"`
 		Message      ChatMessage `json:"message"`
 	} `json:"choices"`
-	Usage struct {
-		PromptTokens     int `json:"prompt_tokens"`
-		CompletionTokens int `json:"completion_tokens"`
-		TotalTokens      int `json:"total_tokens"`
-	} `json:"usage"`
+	Usage Usage `json:"usage"`
+
+	// FromCache is true when the completion was served from the response cache instead of the API.
+	FromCache bool `json:"-"`
+}
+
+// ChatCompletionChunk represents a chunk of the streamed completion response, sent as a server-sent event.
+type ChatCompletionChunk struct {
+	ID                string        `json:"id"`
+	Object            string        `json:"object"`
+	Created           int           `json:"created"`
+	Model             string        `json:"model"`
+	SystemFingerprint string        `json:"system_fingerprint"`
+	Choices           []ChunkChoice `json:"choices"`
+	Usage             *Usage        `json:"usage,omitempty"`
+}
+
+// ChunkChoice represents a choice in a chunk of the streamed completion response.
+type ChunkChoice struct {
+	FinishReason *string    `json:"finish_reason"`
+	Index        int        `json:"index"`
+	Delta        ChunkDelta `json:"delta"`
+}
+
+// ChunkDelta represents the part of the message sent in a chunk.
+type ChunkDelta struct {
+	Role      string          `json:"role,omitempty"`
+	Content   string          `json:"content,omitempty"`
+	ToolCalls []ToolCallDelta `json:"tool_calls,omitempty"`
+}
+
+// ToolCallDelta represents the part of a tool call sent in a chunk. The parts of a call share the index,
+// the first one has the ID, the type and the name, and the arguments are split over the following ones.
+type ToolCallDelta struct {
+	Index    int               `json:"index"`
+	ID       string            `json:"id,omitempty"`
+	Type     string            `json:"type,omitempty"`
+	Function FunctionCallDelta `json:"function"`
 }
 
+// FunctionCallDelta represents the part of the function of a tool call sent in a chunk.
+type FunctionCallDelta struct {
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments"`
+}
+
+// Usage represents the token usage of a request.
+type Usage struct {
+	PromptTokens            int                     `json:"prompt_tokens"`
+	CompletionTokens        int                     `json:"completion_tokens"`
+	TotalTokens             int                     `json:"total_tokens"`
+	PromptTokensDetails     PromptTokensDetails     `json:"prompt_tokens_details"`
+	CompletionTokensDetails CompletionTokensDetails `json:"completion_tokens_details"`
+}
+
+// PromptTokensDetails represents the breakdown of the prompt tokens.
+type PromptTokensDetails struct {
+	CachedTokens int `json:"cached_tokens"`
+	AudioTokens  int `json:"audio_tokens"`
+}
+
+// CompletionTokensDetails represents the breakdown of the completion tokens.
+type CompletionTokensDetails struct {
+	ReasoningTokens          int `json:"reasoning_tokens"`
+	AudioTokens              int `json:"audio_tokens"`
+	AcceptedPredictionTokens int `json:"accepted_prediction_tokens"`
+	RejectedPredictionTokens int `json:"rejected_prediction_tokens"`
+}
+
+// ResponseFormat is the format the model must output, json_object or json_schema for structured outputs.
 type ResponseFormat struct {
-	Type string `json:"type"`
+	Type       string            `json:"type"`
+	JSONSchema *JSONSchemaFormat `json:"json_schema,omitempty"`
+}
+
+// String returns the type of the format, empty for the default text.
+func (f *ResponseFormat) String() string {
+	if f == nil {
+		return ""
+	}
+	return f.Type
+}
+
+// JSONSchemaFormat is the schema of the json_schema response format.
+type JSONSchemaFormat struct {
+	Name   string          `json:"name"`
+	Schema json.RawMessage `json:"schema"`
+	Strict bool            `json:"strict,omitempty"`
 }
 
 // ErrorResponse represents the JSON structure for the error response.
@@ -69,25 +189,32 @@ type ErrorDetail struct {
 	Code    string      `json:"code"`
 }
 
-func newCreateChatCompletion(model, prompt string, maxTokens *int, responseFormatJSON bool) *CreateChatCompletion {
+func newCreateChatCompletion(model, prompt string, maxTokens *int) *CreateChatCompletion {
 	n := 1
 	seed := 0
-	cr := &CreateChatCompletion{
+	return &CreateChatCompletion{
 		Model:     model,
 		N:         &n,
 		Seed:      &seed,
 		MaxTokens: maxTokens,
-	}
-	if responseFormatJSON {
-		cr.ResponseFormat = &ResponseFormat{Type: "json_object"}
-		cr.Messages = []ChatMessage{
-			{Role: "system", Content: "You are a helpful assistant designed to output JSON."},
-			{Role: "user", Content: prompt},
-		}
-	} else {
-		cr.Messages = []ChatMessage{
+		Messages: []ChatMessage{
 			{Role: "user", Content: prompt},
-		}
+		},
 	}
+}
+
+// WithResponseFormat sets the response format of the request, with the system message asking for JSON.
+func (cr *CreateChatCompletion) WithResponseFormat(format *ResponseFormat) *CreateChatCompletion {
+	cr.ResponseFormat = format
+	cr.Messages = append([]ChatMessage{{Role: "system", Content: "You are a helpful assistant designed to output JSON."}}, cr.Messages...)
 	return cr
 }
+
+// Add adds the usage of another request, such as a follow-up turn.
+func (u *Usage) Add(other Usage) {
+	u.PromptTokens += other.PromptTokens
+	u.CompletionTokens += other.CompletionTokens
+	u.TotalTokens += other.TotalTokens
+	u.PromptTokensDetails.CachedTokens += other.PromptTokensDetails.CachedTokens
+	u.CompletionTokensDetails.ReasoningTokens += other.CompletionTokensDetails.ReasoningTokens
+}
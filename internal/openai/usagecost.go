@@ -24,12 +24,43 @@ func (uc *UsageCost) TotalTokens() int {
 	return uc.chatCompletion.Usage.TotalTokens
 }
 
+// CachedTokens returns the number of prompt tokens read from the prompt cache.
+func (uc *UsageCost) CachedTokens() int {
+	return uc.chatCompletion.Usage.PromptTokensDetails.CachedTokens
+}
+
+// ReasoningTokens returns the number of completion tokens used for reasoning.
+func (uc *UsageCost) ReasoningTokens() int {
+	return uc.chatCompletion.Usage.CompletionTokensDetails.ReasoningTokens
+}
+
+// FromCache reports whether the completion was served from the response cache, which costs nothing.
+func (uc *UsageCost) FromCache() bool {
+	return uc.chatCompletion.FromCache
+}
+
+// PromptTokensCost returns the cost of the prompt tokens, charging the cached tokens at the cached rate.
 func (uc *UsageCost) PromptTokensCost() (bool, float64) {
-	return CalculateInputTokensCost(uc.ModelName(), float64(uc.PromptTokens()))
+	if uc.FromCache() {
+		return true, 0
+	}
+	p := GetPricing(uc.ModelName())
+	if p == nil {
+		return false, 0
+	}
+	return true, p.InputCost(uc.PromptTokens(), uc.CachedTokens(), false)
 }
 
+// CompletionTokensCost returns the cost of the completion tokens, charging the reasoning tokens at the reasoning rate.
 func (uc *UsageCost) CompletionTokensCost() (bool, float64) {
-	return CalculateOutputTokensCost(uc.ModelName(), float64(uc.PromptTokens()))
+	if uc.FromCache() {
+		return true, 0
+	}
+	p := GetPricing(uc.ModelName())
+	if p == nil {
+		return false, 0
+	}
+	return true, p.OutputCost(uc.CompletionTokens(), uc.ReasoningTokens(), false)
 }
 
 func (uc *UsageCost) TotalTokensCost() (bool, float64) {
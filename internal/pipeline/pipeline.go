@@ -0,0 +1,175 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/ytka/textforge/internal/steps"
+)
+
+// Input sources of a step other than a step name.
+const (
+	InputPrevious = "previous"
+	InputFile     = "file"
+)
+
+// Output handlings of a step other than an outpath template.
+const (
+	OutputNone    = "none"
+	OutputStdout  = "stdout"
+	OutputRewrite = "rewrite"
+)
+
+var (
+	// ErrNoSteps is an error when the pipeline has no steps.
+	ErrNoSteps = errors.New("pipeline has no steps")
+	// ErrInvalidStep is an error when a step is not valid.
+	ErrInvalidStep = errors.New("invalid step")
+)
+
+// Pipeline is a sequence of steps run on each input file, declared in a pipeline.yaml.
+type Pipeline struct {
+	Name  string  `yaml:"name"`
+	Model string  `yaml:"model"`
+	Steps []*Step `yaml:"steps"`
+
+	dir string
+}
+
+// Step shapes the text with the prompt and hands the output to the next step.
+type Step struct {
+	Name string `yaml:"name"`
+	// Prompt is the prompt text. PromptPath is relative to the pipeline file.
+	// The prompt may have variables such as {{language}}, given by Vars.
+	Prompt     string `yaml:"prompt"`
+	PromptPath string `yaml:"prompt_path"`
+	// Model overrides the model of the pipeline, and MaxTokens the max tokens to generate.
+	Model             string `yaml:"model"`
+	MaxTokens         int    `yaml:"max_tokens"`
+	UseFirstCodeBlock bool   `yaml:"use_first_code_block"`
+	// Input is the text to shape: previous (the output of the previous step, default), file (the input file) or a step name.
+	Input string `yaml:"input"`
+	// Vars are the values of the prompt variables. They are Go templates of
+	// {{.Path}}, {{.File}} (the content of the input file), {{.Previous}} and {{.Steps.name}}.
+	Vars map[string]string `yaml:"vars"`
+	// If and Unless are check commands run by sh with the step input on stdin.
+	// The step runs only if If succeeds and Unless fails. Skipped steps pass the input through.
+	If     string `yaml:"if"`
+	Unless string `yaml:"unless"`
+	// Output is none (default), stdout, rewrite (the input file) or an outpath template such as {{.Dir}}/{{.Stem}}.en{{.Ext}}.
+	Output string `yaml:"output"`
+
+	promptText string
+	vars       map[string]*template.Template
+	outpath    *steps.OutpathTemplate
+}
+
+// Load reads and validates the pipeline file.
+func Load(path string) (*Pipeline, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pipeline: %w", err)
+	}
+	var p Pipeline
+	if err := yaml.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("failed to parse pipeline %s: %w", path, err)
+	}
+	p.dir = filepath.Dir(path)
+	if p.Name == "" {
+		p.Name = filepath.Base(path)
+	}
+	if err := p.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &p, nil
+}
+
+// validate checks the steps and prepares their prompts and templates.
+func (p *Pipeline) validate() error {
+	if len(p.Steps) == 0 {
+		return ErrNoSteps
+	}
+	names := map[string]bool{}
+	for i, s := range p.Steps {
+		if s.Name == "" {
+			s.Name = fmt.Sprintf("step%d", i+1)
+		}
+		if err := p.validateStep(s, names); err != nil {
+			return fmt.Errorf("%w %s: %w", ErrInvalidStep, s.Name, err)
+		}
+		names[s.Name] = true
+	}
+	return nil
+}
+
+func (p *Pipeline) validateStep(s *Step, earlier map[string]bool) error {
+	if earlier[s.Name] {
+		return errors.New("duplicate name")
+	}
+	switch {
+	case s.Prompt != "" && s.PromptPath != "":
+		return errors.New("prompt and prompt_path cannot be given together")
+	case s.Prompt != "":
+		s.promptText = s.Prompt
+	case s.PromptPath != "":
+		path := s.PromptPath
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(p.dir, path)
+		}
+		text, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read prompt: %w", err)
+		}
+		s.promptText = string(text)
+	default:
+		return errors.New("prompt or prompt_path is required")
+	}
+
+	switch s.Input {
+	case "":
+		s.Input = InputPrevious
+	case InputPrevious, InputFile:
+	default:
+		if !earlier[s.Input] {
+			return fmt.Errorf("input %q is not an earlier step", s.Input)
+		}
+	}
+
+	s.vars = map[string]*template.Template{}
+	for name, text := range s.Vars {
+		tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+		if err != nil {
+			return fmt.Errorf("failed to parse var %s: %w", name, err)
+		}
+		s.vars[name] = tmpl
+	}
+
+	switch s.Output {
+	case "":
+		s.Output = OutputNone
+	case OutputNone, OutputStdout, OutputRewrite:
+	default:
+		outpath, err := steps.ParseOutpathTemplate(s.Output)
+		if err != nil {
+			return err
+		}
+		s.outpath = outpath
+	}
+	return nil
+}
+
+// model returns the model of the step, or the default model.
+func (p *Pipeline) model(s *Step, defaultModel string) string {
+	if s.Model != "" {
+		return s.Model
+	}
+	if p.Model != "" {
+		return p.Model
+	}
+	return defaultModel
+}
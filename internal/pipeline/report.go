@@ -0,0 +1,96 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ytka/textforge/internal/costreport"
+	"github.com/ytka/textforge/internal/runner"
+)
+
+// StepReport is the cost of a step for each input file, with the input files where the step was skipped by the check.
+type StepReport struct {
+	Name    string   `json:"name"`
+	Skipped []string `json:"skipped"`
+	*costreport.Report
+}
+
+// Report is the breakdown of the cost of a pipeline run by step.
+type Report struct {
+	Pipeline string        `json:"pipeline"`
+	Steps    []*StepReport `json:"steps"`
+	// TotalCost is the cost of all steps in USD, or null when the pricing of a model is unknown.
+	TotalCost *float64 `json:"total_cost_usd"`
+}
+
+func newReport(p *Pipeline, config *runner.Config) *Report {
+	r := &Report{Pipeline: p.Name}
+	for _, s := range p.Steps {
+		prompt := s.PromptPath
+		if prompt == "" {
+			prompt = "inline"
+		}
+		r.Steps = append(r.Steps, &StepReport{Name: s.Name, Skipped: []string{}, Report: costreport.New(p.model(s, config.Model), prompt, config.Profile)})
+	}
+	return r
+}
+
+// total sums the costs of the steps.
+func (r *Report) total() *float64 {
+	sum := 0.0
+	for _, s := range r.Steps {
+		if len(s.Files) == 0 {
+			continue
+		}
+		if s.Total.TotalCost == nil {
+			return nil
+		}
+		sum += *s.Total.TotalCost
+	}
+	return &sum
+}
+
+// WriteTable writes the cost table of each step and the total.
+func (r *Report) WriteTable(w io.Writer) error {
+	for _, s := range r.Steps {
+		if _, err := fmt.Fprintf(w, "Step %s (%s)\n", s.Name, s.Model); err != nil {
+			return fmt.Errorf("failed to write cost table: %w", err)
+		}
+		if len(s.Files) > 0 {
+			if err := s.Report.WriteTable(w); err != nil {
+				return err
+			}
+		}
+		if len(s.Skipped) > 0 {
+			if _, err := fmt.Fprintf(w, "skipped: %d files\n", len(s.Skipped)); err != nil {
+				return fmt.Errorf("failed to write cost table: %w", err)
+			}
+		}
+		if _, err := fmt.Fprintln(w); err != nil {
+			return fmt.Errorf("failed to write cost table: %w", err)
+		}
+	}
+	total := "unknown"
+	if t := r.total(); t != nil {
+		total = fmt.Sprintf("$%f", *t)
+	}
+	if _, err := fmt.Fprintf(w, "Pipeline total: %s\n", total); err != nil {
+		return fmt.Errorf("failed to write cost table: %w", err)
+	}
+	return nil
+}
+
+// WriteJSONFile writes the report as indented JSON to path.
+func (r *Report) WriteJSONFile(path string) error {
+	r.TotalCost = r.total()
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal report: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write report file: %w", err)
+	}
+	return nil
+}
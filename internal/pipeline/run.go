@@ -0,0 +1,287 @@
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/ytka/textforge/internal/openai"
+	"github.com/ytka/textforge/internal/prompts"
+	"github.com/ytka/textforge/internal/runner"
+	"github.com/ytka/textforge/internal/steps"
+)
+
+// ErrRewriteStdin is an error when a step rewrites the input but it is stdin.
+var ErrRewriteStdin = errors.New("stdin cannot be rewritten")
+
+// UsageFunc is called with the usage of each request, such as to record it in the ledger.
+type UsageFunc func(step *Step, inputPath string, uc *openai.UsageCost)
+
+// Executor runs the pipeline on the input files.
+type Executor struct {
+	pipeline   *Pipeline
+	config     *runner.Config
+	gaiFactory runner.GenerativeAIHandlerFactoryFunc
+	onUsage    UsageFunc
+	stdout     io.Writer
+	stderr     io.Writer
+
+	shapers map[string]*steps.Shaper
+	budget  *runner.Budget
+}
+
+// NewExecutor creates the executor. The configuration gives the defaults of the steps, and DryRun, Silent and Verbose.
+func NewExecutor(p *Pipeline, config *runner.Config, gaiFactory runner.GenerativeAIHandlerFactoryFunc, onUsage UsageFunc) *Executor {
+	return &Executor{
+		pipeline:   p,
+		config:     config,
+		gaiFactory: gaiFactory,
+		onUsage:    onUsage,
+		stdout:     os.Stdout,
+		stderr:     os.Stderr,
+		shapers:    map[string]*steps.Shaper{},
+	}
+}
+
+// varData is the data of the templates of the step variables.
+type varData struct {
+	Path     string
+	File     string
+	Previous string
+	Steps    map[string]string
+}
+
+// Run runs the steps on each input file in order and returns the report of the cost of each step.
+// The report is returned even on an error, with the cost spent until then.
+// When the next step would go over the budget, the run stops and the rest of the files are reported as skipped.
+func (e *Executor) Run(ctx context.Context, inputPaths []string) (*Report, error) {
+	report := newReport(e.pipeline, e.config)
+	models := make([]string, len(e.pipeline.Steps))
+	for i, s := range e.pipeline.Steps {
+		models[i] = e.pipeline.model(s, e.config.Model)
+	}
+	budget, err := runner.NewBudget(e.config, models)
+	if err != nil {
+		return report, err
+	}
+	e.budget = budget
+	for i, path := range inputPaths {
+		err := e.runFile(ctx, path, report)
+		if errors.Is(err, runner.ErrBudgetExceeded) {
+			e.verbosef("stop processing: %v\n", err)
+			e.budget.Skip(inputPaths[i:]...)
+			break
+		}
+		if err != nil {
+			return report, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	e.budget.Report(e.stderr)
+	return report, nil
+}
+
+func (e *Executor) runFile(ctx context.Context, path string, report *Report) error {
+	fileText, err := steps.GetInputText(path)
+	if err != nil {
+		return err
+	}
+	data := &varData{Path: path, File: fileText, Previous: fileText, Steps: map[string]string{}}
+	for i, s := range e.pipeline.Steps {
+		input := e.input(s, data)
+		if e.config.DryRun {
+			e.printPlan(path, s)
+			data.Steps[s.Name], data.Previous = input, input
+			continue
+		}
+
+		run, err := e.check(ctx, s, path, input)
+		if err != nil {
+			return fmt.Errorf("step %s: %w", s.Name, err)
+		}
+		if !run {
+			e.logf("[%s] %s: skipped by the check\n", path, s.Name)
+			report.Steps[i].Skipped = append(report.Steps[i].Skipped, path)
+			data.Steps[s.Name], data.Previous = input, input
+			continue
+		}
+
+		e.verbosef("[%s] %s: running\n", path, s.Name)
+		result, err := e.shape(ctx, s, path, input, data)
+		if err != nil {
+			return fmt.Errorf("step %s: %w", s.Name, err)
+		}
+		uc := openai.NewUsageCost(result.ChatCompletion)
+		report.Steps[i].Add(path, uc, result.Duration)
+		if e.onUsage != nil {
+			e.onUsage(s, path, uc)
+		}
+		if err := e.output(s, path, result.Result); err != nil {
+			return fmt.Errorf("step %s: %w", s.Name, err)
+		}
+		data.Steps[s.Name], data.Previous = result.Result, result.Result
+	}
+	return nil
+}
+
+// input returns the text the step shapes.
+func (e *Executor) input(s *Step, data *varData) string {
+	switch s.Input {
+	case InputPrevious:
+		return data.Previous
+	case InputFile:
+		return data.File
+	}
+	return data.Steps[s.Input]
+}
+
+// check runs the check commands of the step with the input on stdin, and reports whether the step runs.
+func (e *Executor) check(ctx context.Context, s *Step, path, input string) (bool, error) {
+	if s.If != "" {
+		ok, err := e.runCheck(ctx, s, s.If, path, input)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	if s.Unless != "" {
+		ok, err := e.runCheck(ctx, s, s.Unless, path, input)
+		if err != nil || ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// runCheck runs the command with sh and reports whether it succeeded.
+func (e *Executor) runCheck(ctx context.Context, s *Step, command, path, input string) (bool, error) {
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Stdin = strings.NewReader(input)
+	cmd.Stdout, cmd.Stderr = e.stderr, e.stderr
+	if e.config.Silent {
+		cmd.Stdout, cmd.Stderr = io.Discard, io.Discard
+	}
+	cmd.Env = append(os.Environ(), "TEXTFORGE_PATH="+path, "TEXTFORGE_STEP="+s.Name)
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to run check %q: %w", command, err)
+	}
+	return true, nil
+}
+
+func (e *Executor) shape(ctx context.Context, s *Step, path, input string, data *varData) (*steps.ShapeResult, error) {
+	values := map[string]string{}
+	for name, tmpl := range s.vars {
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, data); err != nil {
+			return nil, fmt.Errorf("failed to render var %s: %w", name, err)
+		}
+		values[name] = buf.String()
+	}
+	promptText, err := (&prompts.Prompt{Name: s.Name, Text: s.promptText}).Render(values)
+	if err != nil {
+		return nil, err
+	}
+	shaper, err := e.shaper(s)
+	if err != nil {
+		return nil, err
+	}
+	config := e.stepConfig(s)
+	return e.budget.Shape(ctx, &config, shaper, path, promptText, input)
+}
+
+// shaper returns the shaper of the step, created on the first use.
+func (e *Executor) shaper(s *Step) (*steps.Shaper, error) {
+	if shaper, ok := e.shapers[s.Name]; ok {
+		return shaper, nil
+	}
+	config := e.stepConfig(s)
+	shaper, err := runner.NewShaper(&config, e.gaiFactory)
+	if err != nil {
+		return nil, err
+	}
+	e.shapers[s.Name] = shaper
+	return shaper, nil
+}
+
+// stepConfig returns the configuration of the step over the defaults.
+func (e *Executor) stepConfig(s *Step) runner.Config {
+	config := *e.config
+	config.Model = e.pipeline.model(s, e.config.Model)
+	config.Prompt, config.PromptPath = s.promptText, ""
+	config.UseFirstCodeBlock = config.UseFirstCodeBlock || s.UseFirstCodeBlock
+	if s.MaxTokens > 0 {
+		config.MaxTokens = s.MaxTokens
+	}
+	return config
+}
+
+// output handles the output of the step.
+func (e *Executor) output(s *Step, path, result string) error {
+	switch s.Output {
+	case OutputNone:
+		return nil
+	case OutputStdout:
+		if !e.config.Silent {
+			_, _ = fmt.Fprint(e.stdout, result)
+		}
+		return nil
+	case OutputRewrite:
+		if path == "-" {
+			return ErrRewriteStdin
+		}
+		e.logf("[%s] %s: rewrite file\n", path, s.Name)
+		return steps.WriteResult(result, path)
+	}
+	outpath, err := s.outpath.Execute(path)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(outpath), 0o755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+	e.logf("[%s] %s: write file %s\n", path, s.Name, outpath)
+	return steps.WriteResult(result, outpath)
+}
+
+// printPlan prints what the step would do on the input file.
+func (e *Executor) printPlan(path string, s *Step) {
+	var conds []string
+	if s.If != "" {
+		conds = append(conds, fmt.Sprintf("if %q", s.If))
+	}
+	if s.Unless != "" {
+		conds = append(conds, fmt.Sprintf("unless %q", s.Unless))
+	}
+	output := s.Output
+	if s.outpath != nil {
+		if outpath, err := s.outpath.Execute(path); err == nil {
+			output = outpath
+		}
+	}
+	line := fmt.Sprintf("[%s] %s: model %s, input %s, output %s", path, s.Name, e.pipeline.model(s, e.config.Model), s.Input, output)
+	if len(conds) > 0 {
+		line += ", " + strings.Join(conds, ", ")
+	}
+	_, _ = fmt.Fprintln(e.stdout, line+", dry-run skipped.")
+}
+
+func (e *Executor) logf(format string, args ...any) {
+	if !e.config.Silent {
+		_, _ = fmt.Fprintf(e.stderr, format, args...)
+	}
+}
+
+func (e *Executor) verbosef(format string, args ...any) {
+	if e.config.Verbose {
+		e.logf(format, args...)
+	}
+}
@@ -0,0 +1,121 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ytka/textforge/internal/mockserver"
+	"github.com/ytka/textforge/internal/openai"
+	"github.com/ytka/textforge/internal/runner"
+)
+
+func TestExecutorStepConfig(t *testing.T) {
+	p := &Pipeline{Model: "gpt-4o", Steps: []*Step{
+		{Name: "default", promptText: "a"},
+		{Name: "override", promptText: "b", Model: "gpt-4o-mini", MaxTokens: 100, UseFirstCodeBlock: true},
+	}}
+	e := NewExecutor(p, &runner.Config{Model: "gpt-4", MaxTokens: 500, PromptPath: "prompt.txt"}, nil, nil)
+
+	tests := []struct {
+		step              *Step
+		model             string
+		maxTokens         int
+		useFirstCodeBlock bool
+	}{
+		{step: p.Steps[0], model: "gpt-4o", maxTokens: 500},
+		{step: p.Steps[1], model: "gpt-4o-mini", maxTokens: 100, useFirstCodeBlock: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.step.Name, func(t *testing.T) {
+			got := e.stepConfig(tt.step)
+			if got.Model != tt.model || got.MaxTokens != tt.maxTokens || got.UseFirstCodeBlock != tt.useFirstCodeBlock {
+				t.Errorf("stepConfig() = model %s, max tokens %d, use first code block %t, want %s, %d, %t",
+					got.Model, got.MaxTokens, got.UseFirstCodeBlock, tt.model, tt.maxTokens, tt.useFirstCodeBlock)
+			}
+			if got.Prompt != tt.step.promptText || got.PromptPath != "" {
+				t.Errorf("stepConfig() prompt = %q, %q, want the step prompt", got.Prompt, got.PromptPath)
+			}
+		})
+	}
+}
+
+// mockFactory makes the clients of the upper-casing mock server.
+func mockFactory(model string, _ int) (openai.GenerativeAIClient, error) {
+	client := openai.New("", model, "", nil)
+	client.SetBaseURL("http://textforge.test/v1")
+	client.SetTransport(mockserver.NewTransport(mockserver.New(nil, mockserver.TransformUpper, false)))
+	return client, nil
+}
+
+func TestExecutorRunBudget(t *testing.T) {
+	dir := t.TempDir()
+	pipelinePath := filepath.Join(dir, "pipeline.yaml")
+	if err := os.WriteFile(pipelinePath, []byte("name: test\nsteps:\n  - name: first\n    prompt: Fix the text.\n  - name: second\n    prompt: Polish the text.\n    model: gpt-4o-mini\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var inputs []string
+	for _, name := range []string{"a.txt", "b.txt"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte("hello from "+name+"\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		inputs = append(inputs, path)
+	}
+	p, err := Load(pipelinePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	run := func(config *runner.Config) (*Report, error) {
+		t.Helper()
+		config.Model, config.NoCache, config.MaxCompletionRepeatCount, config.Silent = "gpt-4o", true, 1, true
+		e := NewExecutor(p, config, mockFactory, nil)
+		e.stderr = io.Discard
+		return e.Run(context.Background(), inputs)
+	}
+
+	report, err := run(&runner.Config{})
+	if err != nil {
+		t.Fatalf("Run() without a budget error = %v", err)
+	}
+	firstFileTokens := 0
+	for _, s := range report.Steps {
+		if len(s.Files) != 2 {
+			t.Fatalf("step %s files = %d, want 2 without a budget", s.Name, len(s.Files))
+		}
+		firstFileTokens += s.Files[0].TotalTokens
+	}
+
+	tests := []struct {
+		name      string
+		maxTokens int
+		wantFiles int
+	}{
+		{name: "first file", maxTokens: firstFileTokens + 5, wantFiles: 1},
+		{name: "nothing", maxTokens: 1, wantFiles: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report, err := run(&runner.Config{MaxTokensTotal: tt.maxTokens})
+			if err != nil {
+				t.Fatalf("Run() error = %v, want a clean stop", err)
+			}
+			for _, s := range report.Steps {
+				if len(s.Files) != tt.wantFiles {
+					t.Errorf("step %s files = %d, want %d", s.Name, len(s.Files), tt.wantFiles)
+				}
+			}
+		})
+	}
+
+	if _, err := run(&runner.Config{MaxCost: 1}); err != nil {
+		t.Fatalf("Run() with priced models error = %v", err)
+	}
+	p.Steps[1].Model = "unknown-model"
+	if _, err := run(&runner.Config{MaxCost: 1}); !errors.Is(err, runner.ErrUnknownPricing) {
+		t.Errorf("Run() with a step model without pricing error = %v, want %v", err, runner.ErrUnknownPricing)
+	}
+}
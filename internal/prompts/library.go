@@ -0,0 +1,84 @@
+package prompts
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// promptExt is the extension of the prompt files.
+const promptExt = ".txt"
+
+// ErrPromptNotFound is an error when no prompt file has the name.
+var ErrPromptNotFound = errors.New("prompt not found")
+
+// Prompt is a prompt file in the library.
+type Prompt struct {
+	// Name is the slash separated path relative to the library without the extension, e.g. "en/go/review".
+	Name string
+	Path string
+	Text string
+}
+
+// Library is a directory of prompt files, such as prompts/.
+type Library struct {
+	dir string
+}
+
+// NewLibrary creates a library of the prompt files in dir.
+func NewLibrary(dir string) *Library {
+	return &Library{dir: dir}
+}
+
+// List returns the prompts in the library sorted by name.
+func (l *Library) List() ([]*Prompt, error) {
+	var list []*Prompt
+	err := filepath.WalkDir(l.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || filepath.Ext(path) != promptExt {
+			return nil
+		}
+		rel, err := filepath.Rel(l.dir, path)
+		if err != nil {
+			return err
+		}
+		p, err := load(strings.TrimSuffix(filepath.ToSlash(rel), promptExt), path)
+		if err != nil {
+			return err
+		}
+		list = append(list, p)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list prompts: %w", err)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+// Get returns the prompt of the name. Names escaping the library are not found.
+func (l *Library) Get(name string) (*Prompt, error) {
+	clean := filepath.Clean(filepath.FromSlash(strings.TrimSuffix(name, promptExt)))
+	if name == "" || filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return nil, fmt.Errorf("%w: %s", ErrPromptNotFound, name)
+	}
+	p, err := load(filepath.ToSlash(clean), filepath.Join(l.dir, clean+promptExt))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrPromptNotFound, name)
+	}
+	return p, err
+}
+
+func load(name, path string) (*Prompt, error) {
+	text, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read prompt: %w", err)
+	}
+	return &Prompt{Name: name, Path: path, Text: string(text)}, nil
+}
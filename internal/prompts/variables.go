@@ -0,0 +1,53 @@
+package prompts
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// reVariable matches a variable of a prompt, such as {{language}}.
+var reVariable = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+
+// ErrMissingVariable is an error when a variable of the prompt has no value.
+var ErrMissingVariable = errors.New("missing prompt variable")
+
+// Variables returns the names of the variables in the prompt text in the order of their first appearance.
+func (p *Prompt) Variables() []string {
+	var names []string
+	seen := map[string]bool{}
+	for _, m := range reVariable.FindAllStringSubmatch(p.Text, -1) {
+		if !seen[m[1]] {
+			seen[m[1]] = true
+			names = append(names, m[1])
+		}
+	}
+	return names
+}
+
+// Render replaces the variables in the prompt text with the values.
+func (p *Prompt) Render(values map[string]string) (string, error) {
+	var missing []string
+	for _, name := range p.Variables() {
+		if _, ok := values[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return "", fmt.Errorf("%w: %s", ErrMissingVariable, strings.Join(missing, ", "))
+	}
+	return reVariable.ReplaceAllStringFunc(p.Text, func(s string) string {
+		return values[reVariable.FindStringSubmatch(s)[1]]
+	}), nil
+}
+
+// Description returns the first non-empty line of the prompt text.
+func (p *Prompt) Description() string {
+	for _, line := range strings.Split(p.Text, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			return line
+		}
+	}
+	return p.Name
+}
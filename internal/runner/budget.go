@@ -0,0 +1,245 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/ytka/textforge/internal/openai"
+	"github.com/ytka/textforge/internal/steps"
+	"github.com/ytka/textforge/internal/tokenizer"
+)
+
+var (
+	// ErrBudgetExceeded is an error when the next request would go over the budget.
+	ErrBudgetExceeded = errors.New("budget exceeded")
+	// ErrUnknownPricing is an error when the cost budget is set for a model without pricing.
+	ErrUnknownPricing = errors.New("pricing of the model is unknown")
+)
+
+// budget tracks the spend of a run and decides whether the next request fits in the limits.
+// It is safe for concurrent use. The estimates of the requests in flight are reserved until their actual usage is added.
+type budget struct {
+	mu             sync.Mutex
+	model          budgetModel
+	maxCost        float64
+	maxTokens      int
+	usageCosts     []*openai.UsageCost
+	reservedTokens int
+	reservedCost   float64
+	skipped        []string
+}
+
+// budgetModel is the model of the requests with the max tokens to generate and the tokenizer, which the estimates are made with.
+type budgetModel struct {
+	name      string
+	maxOutput int
+	tokenizer *tokenizer.Tokenizer
+}
+
+// reservation is the estimate of a request in flight.
+type reservation struct {
+	model  budgetModel
+	tokens int
+	cost   float64
+}
+
+// newBudget creates a budget from the configuration. Limits of zero are unlimited.
+func newBudget(config *Config, tok *tokenizer.Tokenizer) (*budget, error) {
+	if config.MaxCost > 0 && openai.GetPricing(config.Model) == nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownPricing, config.Model)
+	}
+	return &budget{
+		model:     budgetModel{name: config.Model, maxOutput: config.MaxTokens, tokenizer: tok},
+		maxCost:   config.MaxCost,
+		maxTokens: config.MaxTokensTotal,
+	}, nil
+}
+
+// estimate estimates the tokens and the cost of a request to the model from the prompt and the input text.
+// The output is assumed to be about as long as the input, capped by the max tokens option.
+func (m budgetModel) estimate(prompt, inputText string) (int, float64) {
+	inputTokens := m.tokenizer.CountChatPrompt(prompt)
+	outputTokens := m.tokenizer.Count(inputText)
+	if m.maxOutput > 0 {
+		outputTokens = min(outputTokens, m.maxOutput)
+	}
+	_, inputCost := openai.CalculateInputTokensCost(m.name, float64(inputTokens))
+	_, outputCost := openai.CalculateOutputTokensCost(m.name, float64(outputTokens))
+	return inputTokens + outputTokens, inputCost + outputCost
+}
+
+// spent returns the actual tokens and cost spent so far. Completions served from the cache are free.
+func (b *budget) spent() (int, float64) {
+	tokens, cost := 0, 0.0
+	for _, uc := range b.usageCosts {
+		if uc.FromCache() {
+			continue
+		}
+		tokens += uc.TotalTokens()
+		cost += b.cost(uc)
+	}
+	return tokens, cost
+}
+
+// cost returns the cost of the usage. Responses from a dated model without pricing are priced as the requested model.
+func (b *budget) cost(uc *openai.UsageCost) float64 {
+	if ok, c := uc.TotalTokensCost(); ok {
+		return c
+	}
+	_, inputCost := openai.CalculateInputTokensCost(b.model.name, float64(uc.PromptTokens()))
+	_, outputCost := openai.CalculateOutputTokensCost(b.model.name, float64(uc.CompletionTokens()))
+	return inputCost + outputCost
+}
+
+// reserve returns ErrBudgetExceeded when the request estimated from the prompt and the input would go over the budget
+// with the spend and the requests in flight. Otherwise, the estimate is reserved until add or release.
+func (b *budget) reserve(prompt, inputText string) (*reservation, error) {
+	return b.reserveModel(b.model, prompt, inputText)
+}
+
+// reserveModel is reserve for a request to another model than the one of the run.
+func (b *budget) reserveModel(m budgetModel, prompt, inputText string) (*reservation, error) {
+	estTokens, estCost := m.estimate(prompt, inputText)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	spentTokens, spentCost := b.spent()
+	spentTokens, spentCost = spentTokens+b.reservedTokens, spentCost+b.reservedCost
+	if b.maxTokens > 0 && spentTokens+estTokens > b.maxTokens {
+		return nil, fmt.Errorf("%w: %d tokens spent + %d estimated > %d max tokens", ErrBudgetExceeded, spentTokens, estTokens, b.maxTokens)
+	}
+	if b.maxCost > 0 && spentCost+estCost > b.maxCost {
+		return nil, fmt.Errorf("%w: $%f spent + $%f estimated > $%f max cost", ErrBudgetExceeded, spentCost, estCost, b.maxCost)
+	}
+	b.reservedTokens += estTokens
+	b.reservedCost += estCost
+	return &reservation{model: m, tokens: estTokens, cost: estCost}, nil
+}
+
+// checkTurn returns ErrBudgetExceeded when the next turn of a request with tool calls would go over the budget.
+// The usage of the earlier turns of the request is counted instead of its reservation, and the next turn is estimated from all its messages.
+func (b *budget) checkTurn(res *reservation, used openai.Usage, next *openai.CreateChatCompletion) error {
+	if b.maxTokens <= 0 && b.maxCost <= 0 {
+		return nil
+	}
+	var sb strings.Builder
+	for _, m := range next.Messages {
+		sb.WriteString(m.Content)
+		for _, call := range m.ToolCalls {
+			sb.WriteString(call.Function.Arguments)
+		}
+	}
+	estTokens, estCost := res.model.estimate(sb.String(), "")
+	usedTokens, usedCost := used.TotalTokens, b.cost(openai.NewUsageCost(&openai.ChatCompletion{Model: res.model.name, Usage: used}))
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	spentTokens, spentCost := b.spent()
+	spentTokens += b.reservedTokens - res.tokens + usedTokens
+	spentCost += b.reservedCost - res.cost + usedCost
+	if b.maxTokens > 0 && spentTokens+estTokens > b.maxTokens {
+		return fmt.Errorf("%w: %d tokens spent + %d estimated for the next tool turn > %d max tokens", ErrBudgetExceeded, spentTokens, estTokens, b.maxTokens)
+	}
+	if b.maxCost > 0 && spentCost+estCost > b.maxCost {
+		return fmt.Errorf("%w: $%f spent + $%f estimated for the next tool turn > $%f max cost", ErrBudgetExceeded, spentCost, estCost, b.maxCost)
+	}
+	return nil
+}
+
+// turnCheck returns the check of the tool turns of the request with the reservation.
+func (b *budget) turnCheck(res *reservation) steps.TurnCheckFunc {
+	return func(used openai.Usage, next *openai.CreateChatCompletion) error {
+		return b.checkTurn(res, used, next)
+	}
+}
+
+// shape shapes the prompt within the budget. The estimate is reserved while the request is in flight,
+// so that parallel requests cannot together go over the budget.
+func (b *budget) shape(ctx context.Context, m budgetModel, shaper *steps.Shaper, prompt steps.ShapePrompt, inputText string) (*steps.ShapeResult, error) {
+	res, err := b.reserveModel(m, string(prompt), inputText)
+	if err != nil {
+		return nil, err
+	}
+	result, err := shaper.WithTurnCheck(b.turnCheck(res)).Shape(ctx, prompt)
+	if err != nil {
+		b.release(res)
+		return nil, fmt.Errorf("failed to shape text: %w", err)
+	}
+	b.add(res, result.ChatCompletion)
+	return result, nil
+}
+
+// release drops the reservation of a request which failed.
+func (b *budget) release(res *reservation) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.reservedTokens -= res.tokens
+	b.reservedCost -= res.cost
+}
+
+// add replaces the reservation of a request with its actual usage.
+func (b *budget) add(res *reservation, comp *openai.ChatCompletion) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.reservedTokens -= res.tokens
+	b.reservedCost -= res.cost
+	b.usageCosts = append(b.usageCosts, openai.NewUsageCost(comp))
+}
+
+// report writes the spend and the files skipped because of the budget.
+func (b *budget) report(w io.Writer) {
+	if len(b.skipped) == 0 {
+		return
+	}
+	b.mu.Lock()
+	spentTokens, spentCost := b.spent()
+	b.mu.Unlock()
+	_, _ = fmt.Fprintf(w, "Budget reached after %d tokens ($%f). Skipped %d files:\n", spentTokens, spentCost, len(b.skipped))
+	for _, f := range b.skipped {
+		_, _ = fmt.Fprintf(w, "  %s\n", f)
+	}
+}
+
+// Budget limits the total spend of the requests shaped outside a Runner, such as the steps of a pipeline,
+// by MaxCost and MaxTokensTotal of the configuration. It is safe for concurrent use.
+type Budget struct {
+	b *budget
+}
+
+// NewBudget creates the budget of the configuration for the requests to the models. Limits of zero are unlimited.
+// With MaxCost, every model must have pricing.
+func NewBudget(config *Config, models []string) (*Budget, error) {
+	for _, model := range models {
+		if config.MaxCost > 0 && openai.GetPricing(model) == nil {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownPricing, model)
+		}
+	}
+	return &Budget{b: &budget{model: budgetModel{name: config.Model}, maxCost: config.MaxCost, maxTokens: config.MaxTokensTotal}}, nil
+}
+
+// Shape shapes the input text labelled with label with the shaper made from config, warning when the prompt does not fit
+// in the context window of the model. ErrBudgetExceeded is returned without a request when it would go over the budget.
+func (b *Budget) Shape(ctx context.Context, config *Config, shaper *steps.Shaper, label, promptText, inputText string) (*steps.ShapeResult, error) {
+	tok, err := tokenizer.ForModel(config.Model)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tokenizer: %w", err)
+	}
+	prompt := shaper.MakeShapePrompt(label, promptText, inputText)
+	warnContextWindow(label, config.Model, tok.CountChatPrompt(string(prompt)), config.MaxTokens)
+	return b.b.shape(ctx, budgetModel{name: config.Model, maxOutput: config.MaxTokens, tokenizer: tok}, shaper, prompt, inputText)
+}
+
+// Skip records the inputs skipped because of the budget.
+func (b *Budget) Skip(labels ...string) {
+	b.b.mu.Lock()
+	defer b.b.mu.Unlock()
+	b.b.skipped = append(b.b.skipped, labels...)
+}
+
+// Report writes the spend and the inputs skipped because of the budget, if any.
+func (b *Budget) Report(w io.Writer) {
+	b.b.report(w)
+}
@@ -0,0 +1,69 @@
+package runner
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ytka/textforge/internal/openai"
+	"github.com/ytka/textforge/internal/tokenizer"
+)
+
+func TestBudgetReserve(t *testing.T) {
+	tok, err := tokenizer.ForModel("gpt-4o")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := newBudget(&Config{Model: "gpt-4o"}, tok)
+	if err != nil {
+		t.Fatal(err)
+	}
+	estTokens, _ := b.model.estimate("prompt", "input")
+	b.maxTokens = estTokens*2 + 1
+
+	first, err := b.reserve("prompt", "input")
+	if err != nil {
+		t.Fatalf("reserve() error = %v", err)
+	}
+	second, err := b.reserve("prompt", "input")
+	if err != nil {
+		t.Fatalf("reserve() error = %v", err)
+	}
+	if _, err := b.reserve("prompt", "input"); !errors.Is(err, ErrBudgetExceeded) {
+		t.Errorf("reserve() over the requests in flight error = %v, want %v", err, ErrBudgetExceeded)
+	}
+
+	b.release(first)
+	comp := &openai.ChatCompletion{Model: "gpt-4o", Usage: openai.Usage{PromptTokens: 1, CompletionTokens: 1, TotalTokens: 2}}
+	b.add(second, comp)
+	if b.reservedTokens != 0 {
+		t.Errorf("reservedTokens = %d, want 0", b.reservedTokens)
+	}
+	if tokens, _ := b.spent(); tokens != 2 {
+		t.Errorf("spent() tokens = %d, want the actual 2", tokens)
+	}
+	if _, err := b.reserve("prompt", "input"); err != nil {
+		t.Errorf("reserve() after the actual usage error = %v", err)
+	}
+}
+
+func TestBudgetCheckTurn(t *testing.T) {
+	tok, err := tokenizer.ForModel("gpt-4o")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := newBudget(&Config{Model: "gpt-4o", MaxTokensTotal: 1000}, tok)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := b.reserve("prompt", "input")
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := &openai.CreateChatCompletion{Messages: []openai.ChatMessage{{Role: "user", Content: "prompt"}}}
+	if err := b.checkTurn(res, openai.Usage{TotalTokens: 100}, next); err != nil {
+		t.Errorf("checkTurn() within the budget error = %v", err)
+	}
+	if err := b.checkTurn(res, openai.Usage{TotalTokens: 995}, next); !errors.Is(err, ErrBudgetExceeded) {
+		t.Errorf("checkTurn() over the budget error = %v, want %v", err, ErrBudgetExceeded)
+	}
+}
@@ -0,0 +1,208 @@
+package runner
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ytka/textforge/internal/ioutil"
+)
+
+// ItemStatus is the processing status of an input file in a run.
+type ItemStatus string
+
+const (
+	ItemPending ItemStatus = "pending"
+	ItemDone    ItemStatus = "done"
+	ItemFailed  ItemStatus = "failed"
+)
+
+// ErrRunNotFound is an error when the run file of the run ID does not exist.
+var ErrRunNotFound = errors.New("run not found")
+
+// CheckpointItem is the status of an input file in a run.
+type CheckpointItem struct {
+	Path   string     `json:"path"`
+	Status ItemStatus `json:"status"`
+	Error  string     `json:"error,omitempty"`
+}
+
+// Checkpoint records the configuration of a run and the status of each input file, so that an interrupted run can be resumed.
+type Checkpoint struct {
+	ID         string           `json:"id"`
+	CreatedAt  time.Time        `json:"created_at"`
+	UpdatedAt  time.Time        `json:"updated_at"`
+	WorkDir    string           `json:"work_dir"`
+	Config     Config           `json:"config"`
+	PromptText string           `json:"prompt_text"`
+	Items      []CheckpointItem `json:"items"`
+}
+
+// runsDir returns the directory of the run files.
+func runsDir() (string, error) {
+	dir, err := ioutil.DataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "runs"), nil
+}
+
+// newRunID returns a run ID of the current time and a random suffix, which sorts by time.
+func newRunID() (string, error) {
+	b := make([]byte, 3)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate run id: %w", err)
+	}
+	return time.Now().Format("20060102-150405") + "-" + hex.EncodeToString(b), nil
+}
+
+// newCheckpoint creates the checkpoint of a new run with all input files pending.
+func newCheckpoint(config *Config, promptText string, inputFilePaths []string) (*Checkpoint, error) {
+	id, err := newRunID()
+	if err != nil {
+		return nil, err
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get working directory: %w", err)
+	}
+	now := time.Now().UTC()
+	cp := &Checkpoint{ID: id, CreatedAt: now, UpdatedAt: now, WorkDir: wd, Config: *config, PromptText: promptText}
+	for _, p := range inputFilePaths {
+		cp.Items = append(cp.Items, CheckpointItem{Path: p, Status: ItemPending})
+	}
+	return cp, cp.save()
+}
+
+// LoadCheckpoint reads the run file of the run ID.
+func LoadCheckpoint(id string) (*Checkpoint, error) {
+	dir, err := runsDir()
+	if err != nil {
+		return nil, err
+	}
+	return loadCheckpointFile(filepath.Join(dir, filepath.Base(id)+".json"))
+}
+
+func loadCheckpointFile(path string) (*Checkpoint, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrRunNotFound, strings.TrimSuffix(filepath.Base(path), ".json"))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read run file: %w", err)
+	}
+	var cp Checkpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return nil, fmt.Errorf("failed to parse run file %s: %w", path, err)
+	}
+	return &cp, nil
+}
+
+// ListCheckpoints returns the runs with pending or failed input files, the newest first. The run files of completed runs are removed.
+func ListCheckpoints() ([]*Checkpoint, error) {
+	dir, err := runsDir()
+	if err != nil {
+		return nil, err
+	}
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list run files: %w", err)
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(paths)))
+	var cps []*Checkpoint
+	for _, p := range paths {
+		cp, err := loadCheckpointFile(p)
+		if err != nil {
+			return nil, err
+		}
+		if len(cp.Remaining()) == 0 {
+			if err := cp.remove(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		cps = append(cps, cp)
+	}
+	return cps, nil
+}
+
+// Remaining returns the paths of the input files not done yet, the pending and the failed ones.
+func (cp *Checkpoint) Remaining() []string {
+	var paths []string
+	for _, item := range cp.Items {
+		if item.Status != ItemDone {
+			paths = append(paths, item.Path)
+		}
+	}
+	return paths
+}
+
+// Count returns the number of the input files in the status.
+func (cp *Checkpoint) Count(status ItemStatus) int {
+	n := 0
+	for _, item := range cp.Items {
+		if item.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+// mark updates the status of the input file and saves the run file.
+func (cp *Checkpoint) mark(path string, status ItemStatus, err error) error {
+	for i := range cp.Items {
+		if cp.Items[i].Path != path {
+			continue
+		}
+		cp.Items[i].Status = status
+		cp.Items[i].Error = ""
+		if err != nil {
+			cp.Items[i].Error = err.Error()
+		}
+	}
+	cp.UpdatedAt = time.Now().UTC()
+	return cp.save()
+}
+
+// remove removes the run file.
+func (cp *Checkpoint) remove() error {
+	dir, err := runsDir()
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(filepath.Join(dir, cp.ID+".json")); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to remove run file: %w", err)
+	}
+	return nil
+}
+
+// save writes the run file atomically.
+func (cp *Checkpoint) save() error {
+	dir, err := runsDir()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("failed to create runs directory: %w", err)
+	}
+	data, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal run file: %w", err)
+	}
+	tmp := filepath.Join(dir, "."+cp.ID+".tmp")
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o600); err != nil {
+		return fmt.Errorf("failed to write run file: %w", err)
+	}
+	if err := os.Rename(tmp, filepath.Join(dir, cp.ID+".json")); err != nil {
+		return fmt.Errorf("failed to write run file: %w", err)
+	}
+	return nil
+}
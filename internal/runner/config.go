@@ -1,23 +1,73 @@
 package runner
 
+import (
+	"slices"
+	"time"
+
+	"github.com/ytka/textforge/internal/steps"
+)
+
 type Config struct {
 	Prompt                   string
 	PromptPath               string
 	PromptOptimize           bool
+	Reduce                   string
+	ReducePath               string
+	MapParallel              int
+	ReduceChunkTokens        int
+	Context                  []string
+	ContextMaxTokens         int
 	Model                    string
+	BaseURL                  string
 	MaxTokens                int
 	MaxCompletionRepeatCount int
+	MaxCost                  float64
+	MaxTokensTotal           int
+	NoCache                  bool
+	RefreshCache             bool
+	CacheTTL                 time.Duration
+	CacheMaxSize             int64
 	DryRun                   bool
+	Estimate                 bool
 	Silent                   bool
 	Verbose                  bool
 	ShowCost                 bool
+	Report                   string
+	Profile                  string
 	Diff                     bool
+	DiffFormat               string
+	DiffContext              int
+	PatchOut                 string
 	InputFileList            string
+	GitChanged               string
+	GitStaged                bool
+	GitUntracked             bool
+	Include                  []string
+	Exclude                  []string
+	MaxFileSize              int64
+	MaxDepth                 int
+	ListInputs               bool
 	LogAPILevel              string
+	ReplayDir                string
+	ReplayMode               string
 	Rewrite                  bool
 	Outpath                  string
 	UseFirstCodeBlock        bool
+	MultiOutput              bool
+	Tools                    bool
+	MaxToolCalls             int
+	JSONSchema               string
+	JSONObject               bool
+	JSONRaw                  bool
 	Confirm                  bool
+	GitBranch                string
+	GitStash                 bool
+	GitCommitPerFile         bool
+	Incremental              bool
+	StateFile                string
+	Force                    bool
+	ContinueOnError          bool
+	ResumeRunID              string `json:"-"`
 }
 
 // Validate checks the configuration for errors.
@@ -28,8 +78,29 @@ func (c *Config) Validate(inputFiles []string) error {
 	if c.Outpath != "" && c.Rewrite {
 		return ErrOutpathRewriteConflict
 	}
-	if c.Outpath != "" && len(inputFiles) > 1 {
+	if c.ReduceEnabled() && (c.Rewrite || c.GitBranch != "") {
+		return ErrReduceRewriteConflict
+	}
+	if c.ReduceEnabled() && (c.Incremental || c.ResumeRunID != "") {
+		return ErrReduceIncrementalConflict
+	}
+	if c.MultiOutput && (c.Outpath != "" || c.ReduceEnabled()) {
+		return ErrMultiOutputConflict
+	}
+	if c.JSONSchema != "" && c.MultiOutput {
+		return ErrJSONSchemaMultiOutputConflict
+	}
+	if c.Outpath != "" && len(inputFiles) > 1 && !c.ReduceEnabled() {
 		return ErrOutpathMultipleFiles
 	}
+	if c.GitBranch != "" && c.Outpath == "" && !c.Rewrite {
+		return ErrGitBranchWithoutWrite
+	}
+	if slices.Contains(c.Context, "-") {
+		return ErrContextStdin
+	}
+	if _, err := steps.ParseDiffFormat(c.DiffFormat); err != nil {
+		return err
+	}
 	return nil
 }
@@ -0,0 +1,28 @@
+package runner
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestConfigValidateReduce(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr error
+	}{
+		{name: "reduce", config: Config{Reduce: "Summarize"}},
+		{name: "rewrite", config: Config{Reduce: "Summarize", Rewrite: true}, wantErr: ErrReduceRewriteConflict},
+		{name: "incremental", config: Config{Reduce: "Summarize", Incremental: true}, wantErr: ErrReduceIncrementalConflict},
+		{name: "resume", config: Config{ReducePath: "reduce.txt", ResumeRunID: "run"}, wantErr: ErrReduceIncrementalConflict},
+		{name: "incremental without reduce", config: Config{Incremental: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config.Prompt, tt.config.DiffFormat = "prompt", "unified"
+			if err := tt.config.Validate([]string{"a.txt", "b.txt"}); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Validate() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
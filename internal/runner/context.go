@@ -0,0 +1,136 @@
+package runner
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/ytka/textforge/internal/inputs"
+	"github.com/ytka/textforge/internal/steps"
+	"github.com/ytka/textforge/internal/tokenizer"
+)
+
+// minTruncatedContextTokens is the fewest tokens worth attaching of a truncated context file. With less budget left, the file is dropped.
+const minTruncatedContextTokens = 64
+
+// contextSet is the read-only context files attached to the prompts. They are never written.
+type contextSet struct {
+	files     []steps.ContextFile
+	paths     map[string]bool
+	truncated []string
+	dropped   []string
+	rewritten []string
+}
+
+// loadContextFiles resolves the context paths and reads the files in the given priority order within the token budget.
+// The first file over the budget is truncated by lines, and the files after it are dropped.
+func loadContextFiles(config *Config, tok *tokenizer.Tokenizer) (*contextSet, error) {
+	cs := &contextSet{paths: map[string]bool{}}
+	if len(config.Context) == 0 {
+		return cs, nil
+	}
+	paths, err := inputs.Resolve(config.Context, &inputs.Options{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve context files: %w", err)
+	}
+
+	remaining := config.ContextMaxTokens
+	if remaining <= 0 {
+		remaining = tokenizer.LookupModel(config.Model).ContextWindow / 4
+	}
+	for _, path := range paths {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get absolute path of context file: %w", err)
+		}
+		cs.paths[abs] = true
+
+		if remaining < minTruncatedContextTokens {
+			cs.dropped = append(cs.dropped, path)
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read context file: %w", err)
+		}
+		file := steps.ContextFile{Path: path, Text: string(data)}
+		n := tok.Count(file.Text)
+		if n > remaining {
+			file.Text, n = truncateLines(tok, file.Text, remaining)
+			file.Truncated = true
+			cs.truncated = append(cs.truncated, path)
+		}
+		cs.files = append(cs.files, file)
+		remaining -= n
+	}
+	return cs, nil
+}
+
+// truncateLines keeps the leading lines of the text within the tokens, and returns them with their tokens.
+func truncateLines(tok *tokenizer.Tokenizer, text string, maxTokens int) (string, int) {
+	var sb strings.Builder
+	tokens := 0
+	for _, line := range strings.SplitAfter(text, "\n") {
+		n := tok.Count(line)
+		if tokens+n > maxTokens {
+			break
+		}
+		sb.WriteString(line)
+		tokens += n
+	}
+	return sb.String(), tokens
+}
+
+// contains reports whether the path is one of the context files.
+func (cs *contextSet) contains(path string) bool {
+	if cs == nil || path == "" || path == "-" {
+		return false
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	return cs.paths[abs]
+}
+
+// checkWritable returns an error when the path is one of the context files.
+func (cs *contextSet) checkWritable(path string) error {
+	if cs.contains(path) {
+		return fmt.Errorf("%w: %s", ErrContextFileWrite, path)
+	}
+	return nil
+}
+
+// dropRewritten removes the input files rewritten by the run from the context files, so that they are never written.
+func (cs *contextSet) dropRewritten(inputFilePaths []string) {
+	for _, path := range inputFilePaths {
+		if !cs.contains(path) {
+			continue
+		}
+		abs, _ := filepath.Abs(path)
+		delete(cs.paths, abs)
+		cs.files = slices.DeleteFunc(cs.files, func(f steps.ContextFile) bool {
+			fabs, err := filepath.Abs(f.Path)
+			return err == nil && fabs == abs
+		})
+		cs.rewritten = append(cs.rewritten, path)
+	}
+}
+
+// report warns about the context files truncated or dropped by the token budget, or dropped as rewritten input files.
+func (cs *contextSet) report(config *Config) {
+	if config.Silent {
+		return
+	}
+	for _, path := range cs.truncated {
+		_, _ = fmt.Fprintf(os.Stderr, "warning: context file truncated to fit the token budget: %s\n", path)
+	}
+	for _, path := range cs.dropped {
+		_, _ = fmt.Fprintf(os.Stderr, "warning: context file dropped over the token budget: %s\n", path)
+	}
+	for _, path := range cs.rewritten {
+		_, _ = fmt.Fprintf(os.Stderr, "warning: context file dropped as a rewritten input file: %s\n", path)
+	}
+}
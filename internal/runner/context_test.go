@@ -0,0 +1,48 @@
+package runner
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/ytka/textforge/internal/tokenizer"
+)
+
+func TestRunnerCheckContextWritable(t *testing.T) {
+	tok, err := tokenizer.ForModel("gpt-4o")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		rewrite   bool
+		outpath   string
+		wantFiles int
+		wantErr   error
+	}{
+		{name: "rewrite drops the input", rewrite: true, wantFiles: 0},
+		{name: "stdout keeps the input", wantFiles: 1},
+		{name: "outpath is an error", outpath: "testdata/input.txt", wantErr: ErrContextFileWrite},
+		{name: "other outpath", outpath: filepath.Join(t.TempDir(), "out.txt"), wantFiles: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{Model: "gpt-4o", Context: []string{"testdata/input.txt"}, Rewrite: tt.rewrite, Outpath: tt.outpath, Silent: true}
+			cs, err := loadContextFiles(config, tok)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := New(config, []string{"testdata/input.txt"}, nil, nil)
+			err = r.checkContextWritable(cs, []string{"testdata/input.txt"})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("checkContextWritable() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && len(cs.files) != tt.wantFiles {
+				t.Errorf("context files = %d, want %d", len(cs.files), tt.wantFiles)
+			}
+			if tt.rewrite && cs.contains("testdata/input.txt") {
+				t.Error("rewritten input is still a context file")
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package runner
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/ytka/textforge/internal/openai"
+	"github.com/ytka/textforge/internal/steps"
+	"github.com/ytka/textforge/internal/tokenizer"
+)
+
+// estimateRow is the estimate of a request for one input file.
+type estimateRow struct {
+	inputPath       string
+	inputTokens     int
+	outputTokensMin int
+	outputTokensMax int
+}
+
+// projectOutputTokens projects the range of output tokens from the tokens of the input text.
+// Shaping usually returns text about as long as the input, so the range is half to one and a half times the input.
+// Without input text, the prompt alone decides the output, so the range is up to the prompt size.
+func projectOutputTokens(inputTextTokens, promptTokens, maxTokens int) (int, int) {
+	low, high := inputTextTokens/2, inputTextTokens*3/2
+	if inputTextTokens == 0 {
+		low, high = 0, promptTokens
+	}
+	if maxTokens > 0 {
+		low, high = min(low, maxTokens), min(high, maxTokens)
+	}
+	return low, high
+}
+
+// estimate tokenizes the prompt of each input file locally and prints the projected tokens and cost without calling the API.
+func (r *Runner) estimate(w io.Writer, opt *RunOption) error {
+	tok := opt.tokenizer
+	shaper := opt.newShaper(r.config)
+
+	rows := make([]estimateRow, 0, len(opt.inputFilePaths))
+	for _, inputPath := range opt.inputFilePaths {
+		inputText, err := steps.GetInputText(inputPath)
+		if err != nil {
+			return fmt.Errorf("failed to get input text: %w", err)
+		}
+		prompt := shaper.MakeShapePrompt(inputPath, opt.promptText, inputText)
+		row := estimateRow{inputPath: inputPath, inputTokens: tok.CountChatPrompt(string(prompt))}
+		row.outputTokensMin, row.outputTokensMax = projectOutputTokens(tok.Count(inputText), row.inputTokens, r.config.MaxTokens)
+		rows = append(rows, row)
+	}
+	return r.printEstimate(w, tok.Encoding(), rows)
+}
+
+func (r *Runner) printEstimate(w io.Writer, encoding tokenizer.Encoding, rows []estimateRow) error {
+	model := r.config.Model
+	costRange := func(inputTokens, outputMin, outputMax int) string {
+		okIn, inputCost := openai.CalculateInputTokensCost(model, float64(inputTokens))
+		okMin, outputCostMin := openai.CalculateOutputTokensCost(model, float64(outputMin))
+		okMax, outputCostMax := openai.CalculateOutputTokensCost(model, float64(outputMax))
+		if !okIn || !okMin || !okMax {
+			return "unknown"
+		}
+		return fmt.Sprintf("$%f - $%f", inputCost+outputCostMin, inputCost+outputCostMax)
+	}
+
+	_, _ = fmt.Fprintf(w, "Model: %s (%s)\n", model, encoding)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "FILE\tINPUT TOKENS\tOUTPUT TOKENS\tCOST")
+	var total estimateRow
+	for _, row := range rows {
+		_, _ = fmt.Fprintf(tw, "%s\t%d\t%d - %d\t%s\n", row.inputPath, row.inputTokens, row.outputTokensMin, row.outputTokensMax,
+			costRange(row.inputTokens, row.outputTokensMin, row.outputTokensMax))
+		total.inputTokens += row.inputTokens
+		total.outputTokensMin += row.outputTokensMin
+		total.outputTokensMax += row.outputTokensMax
+	}
+	_, _ = fmt.Fprintf(tw, "TOTAL\t%d\t%d - %d\t%s\n", total.inputTokens, total.outputTokensMin, total.outputTokensMax,
+		costRange(total.inputTokens, total.outputTokensMin, total.outputTokensMax))
+	if err := tw.Flush(); err != nil {
+		return fmt.Errorf("failed to write estimate: %w", err)
+	}
+	if p := openai.GetPricing(model); p != nil && p.BatchDiscount != nil {
+		inputCost := p.InputCost(total.inputTokens, 0, true)
+		_, _ = fmt.Fprintf(w, "Batch API: $%f - $%f\n", inputCost+p.OutputCost(total.outputTokensMin, 0, true), inputCost+p.OutputCost(total.outputTokensMax, 0, true))
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package runner
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/ytka/textforge/internal/tokenizer"
+)
+
+func TestPrintEstimate(t *testing.T) {
+	rows := []estimateRow{{inputPath: "a.txt", inputTokens: 1_000_000, outputTokensMin: 0, outputTokensMax: 1_000_000}}
+	tests := []struct {
+		model       string
+		contains    []string
+		notContains []string
+	}{
+		{model: "gpt-4o", contains: []string{"$2.500000 - $12.500000", "Batch API: $1.250000 - $6.250000"}},
+		{model: "gpt-4-32k", contains: []string{"$60.000000 - $180.000000"}, notContains: []string{"Batch API"}},
+		{model: "unknown-model", contains: []string{"unknown"}, notContains: []string{"Batch API"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			var buf bytes.Buffer
+			r := New(&Config{Model: tt.model}, nil, nil, nil)
+			if err := r.printEstimate(&buf, tokenizer.O200kBase, rows); err != nil {
+				t.Fatal(err)
+			}
+			for _, s := range tt.contains {
+				if !strings.Contains(buf.String(), s) {
+					t.Errorf("estimate = %q, want to contain %q", buf.String(), s)
+				}
+			}
+			for _, s := range tt.notContains {
+				if strings.Contains(buf.String(), s) {
+					t.Errorf("estimate = %q, want not to contain %q", buf.String(), s)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,182 @@
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ytka/textforge/internal/gitutil"
+)
+
+var (
+	ErrDirtyWorkingTree = errors.New("working tree has changes; commit them or use --git-stash")
+	ErrBranchExists     = errors.New("branch already exists")
+	ErrOutsideWorktree  = errors.New("output path is outside the git working tree")
+)
+
+// gitBranchSession writes the results to a new branch checked out in a separate worktree,
+// so that the changes can be reviewed and merged or thrown away without touching the working tree.
+type gitBranchSession struct {
+	config       *Config
+	repo         *gitutil.Repository
+	worktree     *gitutil.Repository
+	worktreePath string
+	stashed      bool
+	pending      []string
+	committed    []string
+}
+
+// newGitBranchSession checks the working tree, stashing the changes if requested, and creates the branch and its worktree.
+// A resumed run reopens the branch of the run, so that the remaining files are committed on top of the ones already done.
+func newGitBranchSession(config *Config) (*gitBranchSession, error) {
+	repo, err := gitutil.Open(".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open git repository: %w", err)
+	}
+	reopen := repo.BranchExists(config.GitBranch)
+	if reopen && config.ResumeRunID == "" {
+		return nil, fmt.Errorf("%w: %s", ErrBranchExists, config.GitBranch)
+	}
+
+	s := &gitBranchSession{config: config, repo: repo}
+	clean, err := repo.IsClean()
+	if err != nil {
+		return nil, fmt.Errorf("failed to check working tree: %w", err)
+	}
+	if !clean {
+		if !config.GitStash {
+			return nil, ErrDirtyWorkingTree
+		}
+		if err := repo.Stash("textforge: before " + config.GitBranch); err != nil {
+			return nil, fmt.Errorf("failed to stash changes: %w", err)
+		}
+		s.stashed = true
+	}
+
+	gitDir, err := repo.GitPath("textforge-worktrees")
+	if err != nil {
+		return nil, s.abort(fmt.Errorf("failed to get worktree directory: %w", err))
+	}
+	s.worktreePath = filepath.Join(gitDir, strings.ReplaceAll(config.GitBranch, "/", "-"))
+	if s.worktree, err = s.openWorktree(reopen); err != nil {
+		return nil, s.abort(fmt.Errorf("failed to create worktree: %w", err))
+	}
+	return s, nil
+}
+
+// openWorktree creates the branch in a new worktree, or checks out the existing branch,
+// reusing the worktree left by an interrupted run.
+func (s *gitBranchSession) openWorktree(reopen bool) (*gitutil.Repository, error) {
+	if !reopen {
+		return s.repo.AddWorktree(s.worktreePath, s.config.GitBranch)
+	}
+	if _, err := os.Stat(s.worktreePath); err == nil {
+		return gitutil.Open(s.worktreePath)
+	}
+	return s.repo.CheckoutWorktree(s.worktreePath, s.config.GitBranch)
+}
+
+// abort restores the stashed changes after a failed setup.
+func (s *gitBranchSession) abort(err error) error {
+	if s.stashed {
+		if perr := s.repo.StashPop(); perr != nil {
+			return fmt.Errorf("%w (also failed to restore stash: %w)", err, perr)
+		}
+	}
+	return err
+}
+
+// mapPath converts a path in the working tree to the same path in the branch worktree.
+func (s *gitBranchSession) mapPath(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to get absolute path: %w", err)
+	}
+	rel, err := filepath.Rel(s.repo.Root(), abs)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%w: %s", ErrOutsideWorktree, path)
+	}
+	dest := filepath.Join(s.worktree.Root(), rel)
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return "", fmt.Errorf("failed to create directory: %w", err)
+	}
+	return dest, nil
+}
+
+// written records a file written to the worktree, committing it right away in per-file mode.
+func (s *gitBranchSession) written(dest string) error {
+	s.pending = append(s.pending, dest)
+	if s.config.GitCommitPerFile {
+		return s.commit()
+	}
+	return nil
+}
+
+// commit commits the pending files with a message including the prompt and the model.
+func (s *gitBranchSession) commit() error {
+	if len(s.pending) == 0 {
+		return nil
+	}
+	var rels []string
+	for _, p := range s.pending {
+		rel, err := filepath.Rel(s.worktree.Root(), p)
+		if err != nil {
+			return fmt.Errorf("failed to get relative path: %w", err)
+		}
+		rels = append(rels, filepath.ToSlash(rel))
+	}
+	committed, err := s.worktree.CommitFiles(s.commitMessage(rels), s.pending...)
+	if err != nil {
+		return fmt.Errorf("failed to commit: %w", err)
+	}
+	if committed {
+		s.committed = append(s.committed, rels...)
+	}
+	s.pending = nil
+	return nil
+}
+
+// commitMessage generates the commit message for the files.
+func (s *gitBranchSession) commitMessage(files []string) string {
+	prompt := s.config.Prompt
+	if prompt == "" {
+		prompt = "prompt file: " + s.config.PromptPath
+	}
+	subject := fmt.Sprintf("textforge: update %d files", len(files))
+	if len(files) == 1 {
+		subject = "textforge: update " + files[0]
+	}
+
+	var sb strings.Builder
+	sb.WriteString(subject + "\n\n")
+	sb.WriteString("Prompt: " + prompt + "\n")
+	sb.WriteString("Model: " + s.config.Model + "\n\n")
+	for _, f := range files {
+		sb.WriteString("- " + f + "\n")
+	}
+	return sb.String()
+}
+
+// finish commits the remaining files, removes the worktree keeping the branch, restores the stash and prints a summary.
+func (s *gitBranchSession) finish() error {
+	errs := []error{s.commit()}
+	if err := s.repo.RemoveWorktree(s.worktreePath); err != nil {
+		errs = append(errs, fmt.Errorf("failed to remove worktree: %w", err))
+	}
+	if s.stashed {
+		if err := s.repo.StashPop(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to restore stashed changes: %w", err))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+
+	fmt.Printf("Committed %d files to branch '%s'.\n", len(s.committed), s.config.GitBranch)
+	fmt.Printf("Review: git diff HEAD...%s\n", s.config.GitBranch)
+	fmt.Printf("Merge:  git merge %s\n", s.config.GitBranch)
+	fmt.Printf("Discard: git branch -D %s\n", s.config.GitBranch)
+	return nil
+}
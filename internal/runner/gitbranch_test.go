@@ -0,0 +1,128 @@
+package runner
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// setupGitRepo creates a git repository with an initial commit and changes into it.
+func setupGitRepo(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	root, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, args := range [][]string{
+		{"init", "--quiet"},
+		{"config", "user.email", "test@example.com"},
+		{"config", "user.name", "test"},
+		{"commit", "--quiet", "--allow-empty", "-m", "initial"},
+	} {
+		if out, err := exec.Command("git", append([]string{"-C", root}, args...)...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(root); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.Chdir(wd) })
+	return root
+}
+
+func TestGitBranchSessionMapPath(t *testing.T) {
+	root := setupGitRepo(t)
+	s, err := newGitBranchSession(&Config{GitBranch: "textforge/map", Prompt: "test", Model: "gpt-4o"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = s.repo.RemoveWorktree(s.worktreePath) })
+
+	tests := []struct {
+		path    string
+		want    string
+		wantErr error
+	}{
+		{path: "a.txt", want: "a.txt"},
+		{path: "..config/x.txt", want: "..config/x.txt"},
+		{path: filepath.Join(root, "sub", "b.txt"), want: "sub/b.txt"},
+		{path: "../outside.txt", wantErr: ErrOutsideWorktree},
+		{path: filepath.Dir(root), wantErr: ErrOutsideWorktree},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, err := s.mapPath(tt.path)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("mapPath(%q) = %q, %v, want %v", tt.path, got, err, tt.wantErr)
+				}
+				return
+			}
+			if want := filepath.Join(s.worktree.Root(), filepath.FromSlash(tt.want)); err != nil || got != want {
+				t.Errorf("mapPath(%q) = %q, %v, want %q", tt.path, got, err, want)
+			}
+		})
+	}
+}
+
+func TestNewGitBranchSessionResume(t *testing.T) {
+	root := setupGitRepo(t)
+
+	write := func(s *gitBranchSession, name string) {
+		t.Helper()
+		dest, err := s.mapPath(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(dest, []byte(name+"\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.written(dest); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	config := &Config{GitBranch: "textforge/test", Prompt: "test", Model: "gpt-4o"}
+	s, err := newGitBranchSession(config)
+	if err != nil {
+		t.Fatalf("newGitBranchSession() error = %v", err)
+	}
+	write(s, "a.txt")
+	if err := s.finish(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := newGitBranchSession(config); !errors.Is(err, ErrBranchExists) {
+		t.Errorf("newGitBranchSession() of a new run error = %v, want %v", err, ErrBranchExists)
+	}
+
+	resumed := *config
+	resumed.ResumeRunID = "20250101-120000-a1b2c3"
+	s, err = newGitBranchSession(&resumed)
+	if err != nil {
+		t.Fatalf("newGitBranchSession() of a resumed run error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(s.worktree.Root(), "a.txt")); err != nil {
+		t.Errorf("file committed before the resume is not in the worktree: %v", err)
+	}
+	write(s, "b.txt")
+	if err := s.finish(); err != nil {
+		t.Fatal(err)
+	}
+	out, err := exec.Command("git", "-C", root, "ls-tree", "--name-only", "textforge/test").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "a.txt\nb.txt\n"; string(out) != want {
+		t.Errorf("files of the branch = %q, want %q", out, want)
+	}
+}
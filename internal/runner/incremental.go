@@ -0,0 +1,78 @@
+package runner
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ytka/textforge/internal/state"
+	"github.com/ytka/textforge/internal/steps"
+)
+
+// incremental skips the input files already processed with the same content, prompt, settings and model.
+type incremental struct {
+	file       *state.File
+	promptHash string
+	model      string
+	skipped    []string
+}
+
+// newIncremental loads the state file of the configuration.
+func newIncremental(config *Config, promptText string, cs *contextSet, schema *steps.JSONSchema) (*incremental, error) {
+	file, err := state.Load(config.StateFile)
+	if err != nil {
+		return nil, err
+	}
+	return &incremental{file: file, promptHash: state.Hash(promptSettings(config, promptText, cs, schema)), model: config.Model}, nil
+}
+
+// promptSettings returns the prompt text with the settings which change the requests or the output: the context files, the output mode and the tools.
+// Without them, it is the prompt text alone, so that the state recorded by a plain run stays valid.
+func promptSettings(config *Config, promptText string, cs *contextSet, schema *steps.JSONSchema) string {
+	var sb strings.Builder
+	sb.WriteString(promptText)
+	if cs != nil {
+		for _, f := range cs.files {
+			_, _ = fmt.Fprintf(&sb, "\x00context %s truncated=%t\n%s", f.Path, f.Truncated, f.Text)
+		}
+	}
+	if config.MultiOutput {
+		sb.WriteString("\x00multi-output")
+	}
+	if schema != nil {
+		_, _ = fmt.Fprintf(&sb, "\x00json-schema object=%t raw=%t\n%s", config.JSONObject, config.JSONRaw, schema)
+	}
+	if config.Tools {
+		_, _ = fmt.Fprintf(&sb, "\x00tools max=%d", config.MaxToolCalls)
+	}
+	return sb.String()
+}
+
+func (inc *incremental) entry(content string) state.Entry {
+	return state.Entry{ContentHash: state.Hash(content), PromptHash: inc.promptHash, Model: inc.model}
+}
+
+// unchanged reports whether the input file is unchanged since it was last processed. Stdin is never skipped.
+func (inc *incremental) unchanged(inputPath string) (bool, error) {
+	if inputPath == "-" {
+		return false, nil
+	}
+	inputText, err := steps.GetInputText(inputPath)
+	if err != nil {
+		return false, fmt.Errorf("failed to get input text: %w", err)
+	}
+	return inc.file.Unchanged(inputPath, inc.entry(inputText)), nil
+}
+
+// record records the content of the input file after processing.
+func (inc *incremental) record(inputPath, content string) error {
+	if inputPath == "-" {
+		return nil
+	}
+	e := inc.entry(content)
+	e.UpdatedAt = time.Now().UTC()
+	if err := inc.file.Record(inputPath, e); err != nil {
+		return fmt.Errorf("failed to record state: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package runner
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIncrementalUnchanged(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "a.txt")
+	if err := os.WriteFile(input, []byte("hello\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	config := &Config{Model: "gpt-4o", StateFile: filepath.Join(dir, "state.json")}
+	inc, err := newIncremental(config, "prompt", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := inc.unchanged(input); err != nil || ok {
+		t.Fatalf("unchanged() before processing = %v, %v, want false", ok, err)
+	}
+	// A rewrite records the shaped content, which is the input of the next run.
+	if err := inc.record(input, "HELLO\n"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(input, []byte("HELLO\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		config Config
+		prompt string
+		edit   string
+		want   bool
+	}{
+		{name: "same", config: *config, prompt: "prompt", want: true},
+		{name: "prompt changed", config: *config, prompt: "other prompt"},
+		{name: "model changed", config: Config{Model: "gpt-4o-mini", StateFile: config.StateFile}, prompt: "prompt"},
+		{name: "setting changed", config: Config{Model: "gpt-4o", StateFile: config.StateFile, MultiOutput: true}, prompt: "prompt"},
+		{name: "content changed", config: *config, prompt: "prompt", edit: "HELLO!\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.edit != "" {
+				if err := os.WriteFile(input, []byte(tt.edit), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				t.Cleanup(func() { _ = os.WriteFile(input, []byte("HELLO\n"), 0o644) })
+			}
+			inc, err := newIncremental(&tt.config, tt.prompt, nil, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, err := inc.unchanged(input); err != nil || got != tt.want {
+				t.Errorf("unchanged() = %v, %v, want %v", got, err, tt.want)
+			}
+		})
+	}
+
+	if ok, err := inc.unchanged("-"); err != nil || ok {
+		t.Errorf("unchanged(stdin) = %v, %v, want false", ok, err)
+	}
+}
@@ -5,10 +5,12 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+	"slices"
 
 	"github.com/pkg/errors"
-	"github.com/ytka/textforge/internal/openai"
 	"github.com/ytka/textforge/internal/steps"
+	"github.com/ytka/textforge/internal/tokenizer"
 )
 
 type Process struct {
@@ -29,7 +31,7 @@ func (p *Process) verboseLog(msg string, args ...interface{}) {
 func (p *Process) Run(ctx context.Context, i int, inputPath string, opt *RunOption, onBeforeProcessing func(string), onAfterProcessing func(string, *steps.ShapeResult)) error {
 	p.verboseLog("start processing")
 	onBeforeProcessing(inputPath)
-	shapeResult, err := p.getInputAndShape(ctx, inputPath, opt.promptText, opt.gaiClient)
+	inputText, shapeResult, err := p.getInputAndShape(ctx, inputPath, opt)
 	if err != nil {
 		onAfterProcessing(inputPath, shapeResult)
 		p.verboseLog("end processing")
@@ -39,29 +41,65 @@ func (p *Process) Run(ctx context.Context, i int, inputPath string, opt *RunOpti
 	p.verboseLog("end processing: %s", shapeResult.ChatCompletion.ID)
 	p.verboseLog("prompt: '%s'", shapeResult.Prompt)
 
-	if err := p.output(shapeResult, i+1, inputPath, shapeResult.Prompt); err != nil {
+	written, err := p.output(shapeResult, i+1, inputPath, inputText, opt)
+	if err != nil {
 		return err
 	}
+	// Only a written result marks the file as processed, so that printing it to stdout does not skip it next time.
+	if opt.incremental != nil && len(written) > 0 {
+		return opt.incremental.record(inputPath, processedContent(inputPath, inputText, shapeResult, written, opt))
+	}
 	return nil
 }
 
-func (p *Process) getInputAndShape(ctx context.Context, inputFilePath string, promptText string, gai openai.GenerativeAIClient) (*steps.ShapeResult, error) {
+// processedContent returns the content of the input file after processing, the result when the file was rewritten in place.
+func processedContent(inputPath, inputText string, shapeResult *steps.ShapeResult, written []string, opt *RunOption) string {
+	rewritten := slices.ContainsFunc(written, func(path string) bool { return filepath.Clean(path) == filepath.Clean(inputPath) })
+	if !rewritten || opt.gitBranch != nil {
+		return inputText
+	}
+	if shapeResult.Files == nil {
+		return shapeResult.Result
+	}
+	for _, f := range shapeResult.Files {
+		if filepath.Clean(f.Path) == filepath.Clean(inputPath) {
+			return f.Text
+		}
+	}
+	return inputText
+}
+
+func (p *Process) getInputAndShape(ctx context.Context, inputFilePath string, opt *RunOption) (string, *steps.ShapeResult, error) {
 	inputText, err := steps.GetInputText(inputFilePath)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to get input text")
+		return "", nil, errors.Wrap(err, "failed to get input text")
 	}
 
-	shaper := steps.NewShaper(gai, p.config.MaxCompletionRepeatCount, p.config.UseFirstCodeBlock, p.config.PromptOptimize)
-	prompt := shaper.MakeShapePrompt(inputFilePath, promptText, inputText)
+	shaper := opt.newShaper(p.config)
+	prompt := shaper.MakeShapePrompt(inputFilePath, opt.promptText, inputText)
 
 	if p.config.DryRun {
-		return &steps.ShapeResult{Prompt: string(prompt)}, nil
+		return inputText, &steps.ShapeResult{Prompt: string(prompt)}, nil
+	}
+	res, err := opt.budget.reserve(string(prompt), inputText)
+	if err != nil {
+		return inputText, nil, err
 	}
-	result, err := shaper.Shape(ctx, prompt)
+	warnContextWindow(inputFilePath, p.config.Model, opt.tokenizer.CountChatPrompt(string(prompt)), p.config.MaxTokens)
+	result, err := shaper.WithTurnCheck(opt.budget.turnCheck(res)).Shape(ctx, prompt)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to shape text")
+		opt.budget.release(res)
+		return inputText, nil, errors.Wrap(err, "failed to shape text")
+	}
+	opt.budget.add(res, result.ChatCompletion)
+	return inputText, result, nil
+}
+
+// warnContextWindow warns when the prompt tokens and the max tokens to generate do not fit in the context window of the model.
+func warnContextWindow(label, model string, promptTokens, maxTokens int) {
+	if err := tokenizer.LookupModel(model).CheckContextWindow(promptTokens, maxTokens); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "warning: %s: %v\n", label, err)
 	}
-	return result, nil
 }
 
 func (p *Process) confirm(index int, inputFilePath string) error {
@@ -77,7 +115,22 @@ func (p *Process) confirm(index int, inputFilePath string) error {
 	return nil
 }
 
-func (p *Process) write(index int, resultText string, outpath string) error {
+// confirmWrite asks whether to write the output file, which is skipped when declined.
+func (p *Process) confirmWrite(index int, path string) (bool, error) {
+	p.verboseLog("[%d] Confirming %s", index, path)
+	conf, err := p.confirmFunc(fmt.Sprintf("Write %s (y/n)?: ", path))
+	if err != nil {
+		return false, errors.Wrap(err, "confirmation failed")
+	}
+	p.verboseLog("[%d] Confirmation: %t", index, conf)
+	if !conf && !p.config.Silent {
+		fmt.Printf("Skip file:%s\n", path)
+	}
+	return conf, nil
+}
+
+// write writes the result to the outpath, and reports whether it was written.
+func (p *Process) write(index int, resultText string, outpath string, gitBranch *gitBranchSession) (bool, error) {
 	if p.config.Rewrite {
 		if p.config.DryRun {
 			fmt.Printf("Rewrite file:%s, dry-run skipped.\n", outpath)
@@ -85,26 +138,57 @@ func (p *Process) write(index int, resultText string, outpath string) error {
 			fmt.Printf("Rewrite file:%s\n", outpath)
 		}
 	}
-	if outpath != "" && !p.config.DryRun {
-		p.verboseLog("[%d] Writing to file: %s", index, outpath)
-		if err := steps.WriteResult(resultText, outpath); err != nil {
-			return errors.Wrap(err, "failed to write result")
+	if outpath == "" || p.config.DryRun {
+		return false, nil
+	}
+	if gitBranch != nil {
+		dest, err := gitBranch.mapPath(outpath)
+		if err != nil {
+			return false, err
 		}
+		outpath = dest
 	}
-	return nil
+	p.verboseLog("[%d] Writing to file: %s", index, outpath)
+	if err := steps.WriteResult(resultText, outpath); err != nil {
+		return false, errors.Wrap(err, "failed to write result")
+	}
+	if gitBranch != nil {
+		if err := gitBranch.written(outpath); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
 }
 
-func (p *Process) output(shapeResult *steps.ShapeResult, index int, inputFilePath string, inputText string) error {
+// output shows, confirms and writes the result, and returns the paths of the files written.
+func (p *Process) output(shapeResult *steps.ShapeResult, index int, inputFilePath string, inputText string, opt *RunOption) ([]string, error) {
 	p.verboseLog("[%d] rawResult: size:%d, '%s'", index, len(shapeResult.RawResult), shapeResult.RawResult)
 	p.verboseLog("[%d] resultText: '%s'", index, shapeResult.Result)
+	if shapeResult.Files != nil {
+		return p.outputFiles(shapeResult.Files, index, opt)
+	}
 
-	if !p.config.Silent && !p.config.DryRun && !p.config.Rewrite {
-		steps.Print(shapeResult.Result, inputText, p.config.Diff)
+	diffName := inputFilePath
+	if inputFilePath == "-" {
+		diffName = "stdin"
+	}
+	if !p.config.Silent && !p.config.DryRun {
+		diffOut := os.Stdout
+		if !p.config.Rewrite {
+			steps.Print(shapeResult.Result)
+			diffOut = os.Stderr
+		}
+		if p.config.Diff {
+			steps.PrintDiff(diffOut, diffName, inputText, shapeResult.Result, opt.diffOption)
+		}
+	}
+	if p.config.PatchOut != "" && !p.config.DryRun {
+		opt.patchSet.Add(diffName, inputText, shapeResult.Result, p.config.DiffContext)
 	}
 
 	if p.config.Confirm {
 		if err := p.confirm(index, inputFilePath); err != nil {
-			return err
+			return nil, err
 		}
 	}
 
@@ -112,5 +196,93 @@ func (p *Process) output(shapeResult *steps.ShapeResult, index int, inputFilePat
 	if p.config.Rewrite && inputFilePath != "-" {
 		outpath = inputFilePath
 	}
-	return p.write(index, shapeResult.Result, outpath)
+	if err := opt.context.checkWritable(outpath); err != nil {
+		return nil, err
+	}
+	wrote, err := p.write(index, shapeResult.Result, outpath, opt.gitBranch)
+	if err != nil || !wrote {
+		return nil, err
+	}
+	return []string{outpath}, nil
+}
+
+// outputFiles shows and writes each file of a multi-output response through the same diff, confirm and write flow as a single result.
+// The files are written only with rewrite, and all the paths are checked before any file is written.
+func (p *Process) outputFiles(files []steps.OutputFile, index int, opt *RunOption) ([]string, error) {
+	paths := make([]string, len(files))
+	for i, f := range files {
+		path, err := steps.ResolveOutputPath(opt.projectRoot, f.Path)
+		if err != nil {
+			return nil, err
+		}
+		if err := opt.context.checkWritable(path); err != nil {
+			return nil, err
+		}
+		paths[i] = path
+	}
+
+	var written []string
+
+	for i, f := range files {
+		path := paths[i]
+		oldText, exists, err := readExistingFile(path)
+		if err != nil {
+			return written, err
+		}
+		if !p.config.Silent && !p.config.DryRun {
+			diffOut := os.Stdout
+			if !p.config.Rewrite {
+				fmt.Printf("==> %s <==\n", path)
+				steps.Print(f.Text)
+				diffOut = os.Stderr
+			}
+			if p.config.Diff {
+				steps.PrintDiff(diffOut, path, oldText, f.Text, opt.diffOption)
+			}
+		}
+		if p.config.PatchOut != "" && !p.config.DryRun {
+			if exists {
+				opt.patchSet.Add(path, oldText, f.Text, p.config.DiffContext)
+			} else {
+				opt.patchSet.AddNew(path, f.Text, p.config.DiffContext)
+			}
+		}
+		if !p.config.Rewrite {
+			continue
+		}
+		if p.config.Confirm {
+			ok, err := p.confirmWrite(index, path)
+			if err != nil {
+				return written, err
+			}
+			if !ok {
+				continue
+			}
+		}
+		if opt.gitBranch == nil && !p.config.DryRun {
+			if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+				return written, errors.Wrap(err, "failed to create directory")
+			}
+		}
+		wrote, err := p.write(index, f.Text, path, opt.gitBranch)
+		if err != nil {
+			return written, err
+		}
+		if wrote {
+			written = append(written, path)
+		}
+	}
+	return written, nil
+}
+
+// readExistingFile returns the content of the file and whether it exists, with an empty text when it does not exist yet.
+func readExistingFile(path string) (string, bool, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, errors.Wrap(err, "failed to read output file")
+	}
+	return string(data), true, nil
 }
@@ -0,0 +1,237 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/ytka/textforge/internal/steps"
+	"github.com/ytka/textforge/internal/tokenizer"
+)
+
+// maxReduceLevels limits the levels of the recursive reduce.
+const maxReduceLevels = 8
+
+// reduceInstruction tells the model the format of the reduce input.
+const reduceInstruction = "\nThe input is the results for the files, each enclosed in a textforge-file tag with the path of the file."
+
+// ReduceEnabled reports whether the run is in the map-reduce mode.
+func (c *Config) ReduceEnabled() bool {
+	return c.Reduce != "" || c.ReducePath != ""
+}
+
+// reduceItem is a map output, or a partial reduce output, labelled with the file paths it came from.
+type reduceItem struct {
+	label string
+	text  string
+}
+
+// mapReduce shapes each input file with the prompt, then reduces all the outputs with the reduce prompt into one result.
+func (r *Runner) mapReduce(ctx context.Context, opt *RunOption, onAfterProcessing func(string, *steps.ShapeResult)) error {
+	reducePrompt, err := steps.GetPromptText(r.config.Reduce, r.config.ReducePath)
+	if err != nil {
+		return fmt.Errorf("failed to get reduce prompt text: %w", err)
+	}
+	if r.config.DryRun {
+		fmt.Printf("Map %d files and reduce the outputs, dry-run skipped.\n", len(opt.inputFilePaths))
+		return nil
+	}
+
+	// The JSON schema applies to the reduce only, so the map outputs stay text for the reduce prompt.
+	mapShaper := opt.newShaper(r.config).WithJSONSchema(nil)
+	reduceShaper := opt.newShaper(r.config)
+	shape := func(ctx context.Context, label, promptText, inputText string) (*steps.ShapeResult, error) {
+		return r.shapeBudgeted(ctx, opt, mapShaper, label, promptText, inputText)
+	}
+	items, err := r.mapInputs(ctx, opt, shape, onAfterProcessing)
+	if err != nil {
+		return err
+	}
+	if len(items) == 0 {
+		// Nothing was mapped within the budget, so there is nothing to reduce.
+		opt.budget.report(os.Stderr)
+		return nil
+	}
+	result, err := r.reduce(ctx, opt, reducePrompt+reduceInstruction, items, 1, func(ctx context.Context, label, promptText, inputText string) (string, error) {
+		sr, err := r.shapeBudgeted(ctx, opt, reduceShaper, label, promptText, inputText)
+		if err != nil {
+			return "", err
+		}
+		onAfterProcessing(label, sr)
+		return sr.Result, nil
+	})
+	opt.budget.report(os.Stderr)
+	if err != nil {
+		return err
+	}
+
+	if r.config.Outpath != "" {
+		r.verboseLog("Writing to file: %s", r.config.Outpath)
+		return steps.WriteResult(result, r.config.Outpath)
+	}
+	if !r.config.Silent {
+		steps.Print(result)
+	}
+	return nil
+}
+
+// shapeBudgeted shapes the text within the budget, so that the requests of the parallel map cannot together go over it.
+func (r *Runner) shapeBudgeted(ctx context.Context, opt *RunOption, shaper *steps.Shaper, label, promptText, inputText string) (*steps.ShapeResult, error) {
+	return opt.budget.shape(ctx, opt.budget.model, shaper, shaper.MakeShapePrompt(label, promptText, inputText), inputText)
+}
+
+// mapInputs shapes the input files with the prompt, up to MapParallel at a time, and returns the outputs in the order of the files.
+// The results are passed to onAfterProcessing in the order of the files too, even when the map fails.
+// The files which do not fit in the budget are left out of the outputs and recorded as skipped in the budget.
+func (r *Runner) mapInputs(ctx context.Context, opt *RunOption, shape func(ctx context.Context, label, promptText, inputText string) (*steps.ShapeResult, error),
+	onAfterProcessing func(string, *steps.ShapeResult)) ([]reduceItem, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	items := make([]reduceItem, len(opt.inputFilePaths))
+	results := make([]*steps.ShapeResult, len(opt.inputFilePaths))
+	errs := make([]error, len(opt.inputFilePaths))
+	overBudget := make([]bool, len(opt.inputFilePaths))
+	sem := make(chan struct{}, max(1, r.config.MapParallel))
+	var wg sync.WaitGroup
+	for i, inputPath := range opt.inputFilePaths {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			if ctx.Err() != nil {
+				return
+			}
+			inputText, err := steps.GetInputText(inputPath)
+			if err == nil {
+				r.verboseLog("map: %s", inputPath)
+				results[i], err = shape(ctx, inputPath, opt.promptText, inputText)
+			}
+			if errors.Is(err, ErrBudgetExceeded) {
+				r.verboseLog("map: skip %s: %v", inputPath, err)
+				overBudget[i] = true
+				return
+			}
+			if err != nil {
+				errs[i] = fmt.Errorf("%s: %w", inputPath, err)
+				cancel()
+				return
+			}
+			items[i] = reduceItem{label: inputPath, text: results[i].Result}
+		}()
+	}
+	wg.Wait()
+	for i, sr := range results {
+		if sr != nil {
+			onAfterProcessing(opt.inputFilePaths[i], sr)
+		}
+	}
+	for _, err := range errs {
+		if err != nil && !errors.Is(err, context.Canceled) {
+			return nil, fmt.Errorf("map error: %w", err)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, fmt.Errorf("map error: %w", err)
+	}
+	mapped := make([]reduceItem, 0, len(items))
+	for i, item := range items {
+		if overBudget[i] {
+			opt.budget.skipped = append(opt.budget.skipped, opt.inputFilePaths[i])
+			continue
+		}
+		mapped = append(mapped, item)
+	}
+	return mapped, nil
+}
+
+// reduce reduces the items with the prompt. When they do not fit in one request,
+// each group of the items that fits is reduced first, and the partial results are reduced again.
+func (r *Runner) reduce(ctx context.Context, opt *RunOption, prompt string, items []reduceItem, level int,
+	shape func(ctx context.Context, label, promptText, inputText string) (string, error)) (string, error) {
+	groups := r.groupReduceItems(opt, prompt, items)
+	if len(groups) == 1 {
+		r.verboseLog("reduce: level %d, %d items", level, len(items))
+		return shape(ctx, "reduce", prompt, formatReduceInput(groups[0]))
+	}
+	if level >= maxReduceLevels {
+		return "", fmt.Errorf("%w: %d groups at level %d", ErrReduceTooLarge, len(groups), level)
+	}
+	next := make([]reduceItem, len(groups))
+	for i, g := range groups {
+		if len(g) == 1 {
+			// A single item has nothing to combine, so it is reduced at the next level.
+			next[i] = g[0]
+			continue
+		}
+		r.verboseLog("reduce: level %d, group %d/%d, %d items", level, i+1, len(groups), len(g))
+		text, err := shape(ctx, fmt.Sprintf("reduce %d.%d", level, i+1), prompt, formatReduceInput(g))
+		if err != nil {
+			return "", err
+		}
+		labels := make([]string, len(g))
+		for j, item := range g {
+			labels[j] = item.label
+		}
+		next[i] = reduceItem{label: strings.Join(labels, ", "), text: text}
+	}
+	return r.reduce(ctx, opt, prompt, next, level+1, shape)
+}
+
+// groupReduceItems packs the items in order into groups which fit in the reduce chunk tokens.
+// At least two items are packed together so that each level makes progress.
+func (r *Runner) groupReduceItems(opt *RunOption, prompt string, items []reduceItem) [][]reduceItem {
+	tok := opt.tokenizer
+	shaper := opt.newShaper(r.config)
+	limit := r.reduceChunkTokens() - tok.CountChatPrompt(string(shaper.MakeShapePrompt("", prompt, "")))
+	var groups [][]reduceItem
+	var group []reduceItem
+	tokens := 0
+	for _, item := range items {
+		n := tok.Count(formatReduceInput([]reduceItem{item}))
+		if len(group) > 0 && tokens+n > limit {
+			groups = append(groups, group)
+			group, tokens = nil, 0
+		}
+		group = append(group, item)
+		tokens += n
+	}
+	groups = append(groups, group)
+
+	if len(groups) == len(items) && len(items) > 1 {
+		groups = nil
+		for i := 0; i < len(items); i += 2 {
+			groups = append(groups, items[i:min(i+2, len(items))])
+		}
+	}
+	return groups
+}
+
+// reduceChunkTokens returns the max tokens of a reduce request: the configured size,
+// or the context window of the model without the tokens to generate, a quarter of it when unlimited.
+func (r *Runner) reduceChunkTokens() int {
+	if r.config.ReduceChunkTokens > 0 {
+		return r.config.ReduceChunkTokens
+	}
+	contextWindow := tokenizer.LookupModel(r.config.Model).ContextWindow
+	reserve := r.config.MaxTokens
+	if reserve <= 0 {
+		reserve = contextWindow / 4
+	}
+	return contextWindow - reserve
+}
+
+// formatReduceInput encloses each item in a textforge-file tag with its label.
+func formatReduceInput(items []reduceItem) string {
+	var sb strings.Builder
+	for i, item := range items {
+		if i > 0 {
+			sb.WriteString("\n")
+		}
+		fmt.Fprintf(&sb, "<textforge-file path=%q>\n%s\n</textforge-file>", item.label, strings.TrimRight(item.text, "\n"))
+	}
+	return sb.String()
+}
@@ -0,0 +1,76 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/ytka/textforge/internal/steps"
+)
+
+// writeInputs writes the input files with their names as the text and returns their paths.
+func writeInputs(t *testing.T, names ...string) []string {
+	t.Helper()
+	dir := t.TempDir()
+	paths := make([]string, len(names))
+	for i, name := range names {
+		paths[i] = filepath.Join(dir, name)
+		if err := os.WriteFile(paths[i], []byte(name), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return paths
+}
+
+func TestRunnerMapInputsOverBudget(t *testing.T) {
+	paths := writeInputs(t, "a.txt", "b.txt", "c.txt")
+	r := New(&Config{MapParallel: 2}, paths, nil, nil)
+	opt := &RunOption{inputFilePaths: paths, budget: &budget{}}
+	shape := func(_ context.Context, label, _, inputText string) (*steps.ShapeResult, error) {
+		if label == paths[1] {
+			return nil, fmt.Errorf("%w: test", ErrBudgetExceeded)
+		}
+		return &steps.ShapeResult{Result: "mapped " + inputText}, nil
+	}
+	var processed []string
+	items, err := r.mapInputs(context.Background(), opt, shape, func(path string, _ *steps.ShapeResult) {
+		processed = append(processed, path)
+	})
+	if err != nil {
+		t.Fatalf("mapInputs() error = %v", err)
+	}
+	want := []reduceItem{{label: paths[0], text: "mapped a.txt"}, {label: paths[2], text: "mapped c.txt"}}
+	if !slices.Equal(items, want) {
+		t.Errorf("mapInputs() = %+v, want %+v", items, want)
+	}
+	if !slices.Equal(opt.budget.skipped, []string{paths[1]}) {
+		t.Errorf("skipped = %q, want %q", opt.budget.skipped, paths[1])
+	}
+	if !slices.Equal(processed, []string{paths[0], paths[2]}) {
+		t.Errorf("processed = %q, want the mapped files", processed)
+	}
+}
+
+func TestRunnerMapReduceNothingWithinBudget(t *testing.T) {
+	config := newReplayConfig(t)
+	config.Reduce = "Summarize the files"
+	config.MaxTokensTotal = 10
+	paths := writeInputs(t, "a.txt", "b.txt")
+	r := New(config, paths, replayFactory, nil)
+	opt, err := r.Setup()
+	if err != nil {
+		t.Fatalf("Setup() error = %v", err)
+	}
+	if err := r.Run(context.Background(), opt, func(string) {}, func(string, *steps.ShapeResult) {}); err != nil {
+		t.Fatalf("Run() error = %v, want a clean stop", err)
+	}
+	if !slices.Equal(opt.budget.skipped, paths) {
+		t.Errorf("skipped = %q, want %q", opt.budget.skipped, paths)
+	}
+	if _, err := os.Stat(config.Outpath); !os.IsNotExist(err) {
+		t.Errorf("outpath was written: %v", err)
+	}
+}
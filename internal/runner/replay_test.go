@@ -0,0 +1,155 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ytka/textforge/internal/httpreplay"
+	"github.com/ytka/textforge/internal/mockserver"
+	"github.com/ytka/textforge/internal/openai"
+	"github.com/ytka/textforge/internal/steps"
+)
+
+var update = flag.Bool("update", false, "record the replay fixtures with the mock server")
+
+const replayDir = "testdata/replay"
+
+// replayFactory makes the clients replaying the fixtures in testdata/replay, recording them with the upper-casing mock server with -update.
+func replayFactory(model string, _ int) (openai.GenerativeAIClient, error) {
+	mode, next := httpreplay.ModeReplay, http.RoundTripper(nil)
+	if *update {
+		mode, next = httpreplay.ModeRecord, mockserver.NewTransport(mockserver.New(nil, mockserver.TransformUpper, false))
+	}
+	client := openai.New("", model, "", nil)
+	client.SetBaseURL("http://textforge.test/v1")
+	client.SetTransport(httpreplay.New(replayDir, mode, next))
+	return client, nil
+}
+
+// newReplayConfig returns the configuration of a run with the replay fixtures, with the data and cache directories in a temporary directory.
+func newReplayConfig(t *testing.T) *Config {
+	t.Helper()
+	tmp := t.TempDir()
+	t.Setenv("XDG_DATA_HOME", filepath.Join(tmp, "data"))
+	t.Setenv("XDG_CACHE_HOME", filepath.Join(tmp, "cache"))
+	return &Config{
+		Prompt:                   "Convert to upper case",
+		PromptOptimize:           true,
+		Model:                    "gpt-4o",
+		MaxCompletionRepeatCount: 1,
+		DiffFormat:               "unified",
+		Silent:                   true,
+		ReplayDir:                replayDir,
+		ReplayMode:               string(httpreplay.ModeReplay),
+		Outpath:                  filepath.Join(tmp, "out.txt"),
+	}
+}
+
+// assertNoCache fails if the response cache was written.
+func assertNoCache(t *testing.T) {
+	t.Helper()
+	entries, err := os.ReadDir(filepath.Join(os.Getenv("XDG_CACHE_HOME"), "textforge"))
+	if err == nil && len(entries) > 0 {
+		t.Errorf("response cache has %d entries, want none with the replay directory", len(entries))
+	}
+}
+
+func TestRunnerRunReplay(t *testing.T) {
+	config := newReplayConfig(t)
+	r := New(config, []string{"testdata/input.txt"}, replayFactory, nil)
+	opt, err := r.Setup()
+	if err != nil {
+		t.Fatalf("Setup() error = %v", err)
+	}
+	var results []*steps.ShapeResult
+	err = r.Run(context.Background(), opt, func(string) {}, func(_ string, result *steps.ShapeResult) {
+		results = append(results, result)
+	})
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	data, err := os.ReadFile(config.Outpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "HELLO, WORLD\n"; string(data) != want {
+		t.Errorf("output = %q, want %q", data, want)
+	}
+	if len(results) != 1 || results[0].ChatCompletion.FromCache {
+		t.Errorf("results = %+v, want one result from the API", results)
+	}
+	if cps, err := ListCheckpoints(); err != nil || len(cps) != 0 {
+		t.Errorf("ListCheckpoints() = %d runs, %v, want none", len(cps), err)
+	}
+	if _, err := LoadCheckpoint(opt.checkpoint.ID); !errors.Is(err, ErrRunNotFound) {
+		t.Errorf("LoadCheckpoint() of the completed run error = %v, want %v", err, ErrRunNotFound)
+	}
+	assertNoCache(t)
+}
+
+func TestNewShaperReplay(t *testing.T) {
+	config := newReplayConfig(t)
+	shaper, err := NewShaper(config, replayFactory)
+	if err != nil {
+		t.Fatalf("NewShaper() error = %v", err)
+	}
+	inputText, err := steps.GetInputText("testdata/input.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := shaper.Shape(context.Background(), shaper.MakeShapePrompt("testdata/input.txt", config.Prompt, inputText))
+	if err != nil {
+		t.Fatalf("Shape() error = %v", err)
+	}
+	if want := "HELLO, WORLD\n"; result.Result != want {
+		t.Errorf("Result = %q, want %q", result.Result, want)
+	}
+	assertNoCache(t)
+}
+
+func TestRunnerRunIncrementalRecordsWrittenFiles(t *testing.T) {
+	tests := []struct {
+		name     string
+		outpath  bool
+		recorded bool
+	}{
+		{name: "stdout", outpath: false, recorded: false},
+		{name: "outpath", outpath: true, recorded: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := newReplayConfig(t)
+			config.Incremental = true
+			config.StateFile = filepath.Join(t.TempDir(), "state.json")
+			if !tt.outpath {
+				config.Outpath = ""
+			}
+			r := New(config, []string{"testdata/input.txt"}, replayFactory, nil)
+			opt, err := r.Setup()
+			if err != nil {
+				t.Fatalf("Setup() error = %v", err)
+			}
+			if err := r.Run(context.Background(), opt, func(string) {}, func(string, *steps.ShapeResult) {}); err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+
+			inc, err := newIncremental(config, opt.promptText, opt.context, opt.jsonSchema)
+			if err != nil {
+				t.Fatal(err)
+			}
+			unchanged, err := inc.unchanged("testdata/input.txt")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if unchanged != tt.recorded {
+				t.Errorf("recorded = %t, want %t", unchanged, tt.recorded)
+			}
+		})
+	}
+}
@@ -5,16 +5,33 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"os"
+	"path/filepath"
+	"strings"
 
+	"github.com/ytka/textforge/internal/cache"
+	"github.com/ytka/textforge/internal/gitutil"
 	"github.com/ytka/textforge/internal/ioutil"
 	"github.com/ytka/textforge/internal/openai"
 	"github.com/ytka/textforge/internal/steps"
+	"github.com/ytka/textforge/internal/tokenizer"
+	"github.com/ytka/textforge/internal/tools"
 )
 
 var (
-	ErrPromptOrPromptPathRequired = errors.New("either prompt or prompt-path must be provided")
-	ErrOutpathRewriteConflict     = errors.New("outpath and rewrite cannot be provided together")
-	ErrOutpathMultipleFiles       = errors.New("outpath cannot be provided when multiple input files are provided")
+	ErrPromptOrPromptPathRequired    = errors.New("either prompt or prompt-path must be provided")
+	ErrOutpathRewriteConflict        = errors.New("outpath and rewrite cannot be provided together")
+	ErrOutpathMultipleFiles          = errors.New("outpath cannot be provided when multiple input files are provided")
+	ErrGitBranchWithoutWrite         = errors.New("git-branch requires rewrite or outpath")
+	ErrInputFilesFailed              = errors.New("some input files failed")
+	ErrReduceRewriteConflict         = errors.New("reduce cannot be used with rewrite or git-branch")
+	ErrReduceIncrementalConflict     = errors.New("reduce cannot be used with incremental or resume")
+	ErrReduceTooLarge                = errors.New("map outputs do not fit in the context window after reducing")
+	ErrContextStdin                  = errors.New("context cannot be read from stdin")
+	ErrContextFileWrite              = errors.New("context files are read-only and cannot be written")
+	ErrMultiOutputConflict           = errors.New("multi-output cannot be used with outpath or reduce")
+	ErrJSONSchemaMultiOutputConflict = errors.New("json-schema cannot be used with multi-output")
+	ErrPatchOutsideCwd               = errors.New("patch-out cannot include input files outside the current directory")
 )
 
 // Runner manages the execution of text processing tasks.
@@ -26,7 +43,7 @@ type Runner struct {
 }
 
 type (
-	GenerativeAIHandlerFactoryFunc func(model string) (openai.GenerativeAIClient, error)
+	GenerativeAIHandlerFactoryFunc func(model string, maxTokens int) (openai.GenerativeAIClient, error)
 	ConfirmFunc                    func(string) (bool, error)
 )
 
@@ -52,6 +69,17 @@ type RunOption struct {
 	gaiClient      openai.GenerativeAIClient
 	promptText     string
 	inputFilePaths []string
+	diffOption     steps.DiffOption
+	patchSet       *steps.PatchSet
+	gitBranch      *gitBranchSession
+	budget         *budget
+	tokenizer      *tokenizer.Tokenizer
+	incremental    *incremental
+	checkpoint     *Checkpoint
+	context        *contextSet
+	projectRoot    string
+	jsonSchema     *steps.JSONSchema
+	tools          steps.ToolHandler
 }
 
 // Setup initializes the Runner and returns a RunOption.
@@ -61,45 +89,354 @@ func (r *Runner) Setup() (*RunOption, error) {
 	if err := r.config.Validate(r.inputFiles); err != nil {
 		return nil, fmt.Errorf("invalid configuration: %+v, %w", r.config, err)
 	}
-	r.verboseLog("make generative ai client")
-	gai, err := r.generativeAIHandlerFactoryFunc(r.config.Model)
-	if err != nil {
-		return nil, fmt.Errorf("failed to make generative ai client: %w", err)
+	var gai openai.GenerativeAIClient
+	if !r.config.Estimate {
+		r.verboseLog("make generative ai client")
+		var err error
+		if gai, err = r.generativeAIHandlerFactoryFunc(r.config.Model, r.config.MaxTokens); err != nil {
+			return nil, fmt.Errorf("failed to make generative ai client: %w", err)
+		}
+		if gai, err = r.wrapCache(gai); err != nil {
+			return nil, err
+		}
 	}
 	r.verboseLog("get prompt")
+	var checkpoint *Checkpoint
+	var promptText string
+	if r.config.ResumeRunID != "" {
+		r.verboseLog("resume run: %s", r.config.ResumeRunID)
+		var err error
+		if checkpoint, err = LoadCheckpoint(r.config.ResumeRunID); err != nil {
+			return nil, fmt.Errorf("failed to load run: %w", err)
+		}
+		// The prompt is taken from the run so that the resumed files are shaped the same even if the prompt file or stdin changed.
+		promptText = checkpoint.PromptText
+	} else {
+		var err error
+		if promptText, err = r.getPromptText(); err != nil {
+			return nil, err
+		}
+	}
+
+	var inputFilePaths []string
+	if len(r.inputFiles) == 0 {
+		inputFilePaths = []string{"-"}
+	} else {
+		inputFilePaths = r.inputFiles
+	}
+
+	diffOption, err := r.makeDiffOption()
+	if err != nil {
+		return nil, err
+	}
+
+	r.verboseLog("load tokenizer")
+	tok, err := tokenizer.ForModel(r.config.Model)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tokenizer: %w", err)
+	}
+	r.verboseLog("load context files: %v", r.config.Context)
+	contextFiles, err := loadContextFiles(r.config, tok)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.checkContextWritable(contextFiles, inputFilePaths); err != nil {
+		return nil, err
+	}
+	if err := r.checkPatchPaths(inputFilePaths); err != nil {
+		return nil, err
+	}
+	contextFiles.report(r.config)
+
+	var projectRoot string
+	if r.config.MultiOutput || r.config.Tools {
+		if projectRoot, err = findProjectRoot(); err != nil {
+			return nil, err
+		}
+		r.verboseLog("project root: %s", projectRoot)
+	}
+	var toolHandler steps.ToolHandler
+	if r.config.Tools {
+		toolbox, err := tools.New(projectRoot)
+		if err != nil {
+			return nil, fmt.Errorf("failed to set up tools: %w", err)
+		}
+		toolHandler = toolbox
+	}
+
+	var jsonSchema *steps.JSONSchema
+	if r.config.JSONSchema != "" {
+		r.verboseLog("load JSON schema: %s", r.config.JSONSchema)
+		if jsonSchema, err = steps.LoadJSONSchema(r.config.JSONSchema, r.config.JSONObject, r.config.JSONRaw); err != nil {
+			return nil, err
+		}
+	}
+
+	if checkpoint == nil && !r.config.DryRun && !r.config.Estimate && !r.config.ReduceEnabled() && !(len(inputFilePaths) == 1 && inputFilePaths[0] == "-") {
+		if checkpoint, err = newCheckpoint(r.config, promptText, inputFilePaths); err != nil {
+			return nil, fmt.Errorf("failed to create run file: %w", err)
+		}
+		r.verboseLog("run id: %s", checkpoint.ID)
+	}
+
+	budget, err := newBudget(r.config, tok)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set up budget: %w", err)
+	}
+
+	var inc *incremental
+	if r.config.Incremental {
+		r.verboseLog("load state: %s", r.config.StateFile)
+		if inc, err = newIncremental(r.config, promptText, contextFiles, jsonSchema); err != nil {
+			return nil, fmt.Errorf("failed to load state: %w", err)
+		}
+	}
+
+	var gitBranch *gitBranchSession
+	if r.config.GitBranch != "" && !r.config.DryRun && !r.config.Estimate {
+		r.verboseLog("create git branch: %s", r.config.GitBranch)
+		if gitBranch, err = newGitBranchSession(r.config); err != nil {
+			return nil, fmt.Errorf("failed to prepare git branch: %w", err)
+		}
+	}
+
+	return &RunOption{
+		gaiClient:      gai,
+		promptText:     promptText,
+		inputFilePaths: inputFilePaths,
+		diffOption:     diffOption,
+		patchSet:       steps.NewPatchSet(),
+		gitBranch:      gitBranch,
+		budget:         budget,
+		tokenizer:      tok,
+		incremental:    inc,
+		checkpoint:     checkpoint,
+		context:        contextFiles,
+		projectRoot:    projectRoot,
+		jsonSchema:     jsonSchema,
+		tools:          toolHandler,
+	}, nil
+}
+
+// checkContextWritable fails before any request when the outpath is a context file, and drops the rewritten input files from the context files.
+func (r *Runner) checkContextWritable(cs *contextSet, inputFilePaths []string) error {
+	if err := cs.checkWritable(r.config.Outpath); err != nil {
+		return err
+	}
+	if r.config.Rewrite {
+		cs.dropRewritten(inputFilePaths)
+	}
+	return nil
+}
+
+// checkPatchPaths rejects input files outside the current directory with patch-out,
+// because git apply cannot apply their absolute paths relative to it.
+func (r *Runner) checkPatchPaths(inputFilePaths []string) error {
+	if r.config.PatchOut == "" || r.config.DryRun {
+		return nil
+	}
+	for _, path := range inputFilePaths {
+		clean := filepath.Clean(path)
+		if filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("%w: %s", ErrPatchOutsideCwd, path)
+		}
+	}
+	return nil
+}
+
+// newShaper creates the shaper of the run, attaching the context files to the prompts.
+func (opt *RunOption) newShaper(config *Config) *steps.Shaper {
+	var files []steps.ContextFile
+	if opt.context != nil {
+		files = opt.context.files
+	}
+	return steps.NewShaper(opt.gaiClient, config.MaxCompletionRepeatCount, config.UseFirstCodeBlock, config.PromptOptimize).
+		WithContext(files).
+		WithMultiOutput(config.MultiOutput).
+		WithJSONSchema(opt.jsonSchema).
+		WithTools(opt.tools, config.MaxToolCalls)
+}
+
+// findProjectRoot returns the top-level directory of the git working tree, or the current directory outside of one.
+// The files of a multi-output response and the paths of the tools must stay inside it.
+func findProjectRoot() (string, error) {
+	if repo, err := gitutil.Open("."); err == nil {
+		return repo.Root(), nil
+	}
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("failed to get current directory: %w", err)
+	}
+	return dir, nil
+}
+
+// getPromptText returns the prompt text, followed by stdin when it is piped together with input files.
+func (r *Runner) getPromptText() (string, error) {
 	promptText, err := steps.GetPromptText(r.config.Prompt, r.config.PromptPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get prompt text: %w", err)
+		return "", fmt.Errorf("failed to get prompt text: %w", err)
 	}
 	pipeAvailable, err := ioutil.IsStdinPipe()
 	if err != nil {
-		return nil, fmt.Errorf("failed to check if stdin is pipe: %w", err)
+		return "", fmt.Errorf("failed to check if stdin is pipe: %w", err)
 	}
 	if pipeAvailable && len(r.inputFiles) >= 1 {
 		added, err := steps.GetInputText("-")
 		if err != nil {
-			return nil, fmt.Errorf("failed to get input text from stdin: %w", err)
+			return "", fmt.Errorf("failed to get input text from stdin: %w", err)
 		}
 		promptText += "\n" + added
 	}
+	return promptText, nil
+}
 
-	var inputFilePaths []string
-	if len(r.inputFiles) == 0 {
-		inputFilePaths = []string{"-"}
-	} else {
-		inputFilePaths = r.inputFiles
+// NewShaper creates the shaper of the configuration with the client made by gaiFactory, behind the response cache unless it is disabled.
+func NewShaper(config *Config, gaiFactory GenerativeAIHandlerFactoryFunc) (*steps.Shaper, error) {
+	r := New(config, nil, gaiFactory, nil)
+	gai, err := gaiFactory(config.Model, config.MaxTokens)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make generative ai client: %w", err)
+	}
+	if gai, err = r.wrapCache(gai); err != nil {
+		return nil, err
 	}
+	return steps.NewShaper(gai, config.MaxCompletionRepeatCount, config.UseFirstCodeBlock, config.PromptOptimize), nil
+}
 
-	return &RunOption{gaiClient: gai, promptText: promptText, inputFilePaths: inputFilePaths}, nil
+// wrapCache puts the response cache in front of the client unless it is disabled.
+// With --replay-dir the cache is not used, so that every request reaches the replay transport and is recorded or replayed.
+func (r *Runner) wrapCache(gai openai.GenerativeAIClient) (openai.GenerativeAIClient, error) {
+	if r.config.NoCache || r.config.ReplayDir != "" {
+		return gai, nil
+	}
+	dir, err := cache.DefaultDir()
+	if err != nil {
+		return nil, err
+	}
+	r.verboseLog("response cache: %s, refresh: %t", dir, r.config.RefreshCache)
+	store := cache.NewStore(dir, r.config.CacheTTL, r.config.CacheMaxSize)
+	return cache.NewClient(gai, store, r.config.RefreshCache, r.config.BaseURL), nil
+}
+
+// makeDiffOption creates the diff rendering options. Colors are used only when the diff goes to a terminal.
+func (r *Runner) makeDiffOption() (steps.DiffOption, error) {
+	format, err := steps.ParseDiffFormat(r.config.DiffFormat)
+	if err != nil {
+		return steps.DiffOption{}, fmt.Errorf("failed to parse diff format: %w", err)
+	}
+	diffOut := os.Stderr
+	if r.config.Rewrite {
+		diffOut = os.Stdout
+	}
+	color, err := ioutil.IsTerminal(diffOut)
+	if err != nil {
+		return steps.DiffOption{}, fmt.Errorf("failed to check if diff output is terminal: %w", err)
+	}
+	return steps.DiffOption{Format: format, ContextLines: r.config.DiffContext, Color: color}, nil
 }
 
 // Run processing of multiple input files.
 func (r *Runner) Run(ctx context.Context, opt *RunOption, onBeforeProcessing func(string), onAfterProcessing func(string, *steps.ShapeResult)) error {
+	if r.config.Estimate {
+		return r.estimate(os.Stdout, opt)
+	}
+	if r.config.ReduceEnabled() {
+		return r.mapReduce(ctx, opt, onAfterProcessing)
+	}
+	err := r.runProcesses(ctx, opt, onBeforeProcessing, onAfterProcessing)
+	if opt.gitBranch != nil {
+		// The files processed before an error are still committed so that they can be reviewed.
+		if ferr := opt.gitBranch.finish(); ferr != nil {
+			err = errors.Join(err, fmt.Errorf("failed to finish git branch: %w", ferr))
+		}
+	}
+	return err
+}
+
+func (r *Runner) runProcesses(ctx context.Context, opt *RunOption, onBeforeProcessing func(string), onAfterProcessing func(string, *steps.ShapeResult)) error {
+	var failed []string
 	for i, inputPath := range opt.inputFilePaths {
+		if opt.incremental != nil && !r.config.Force {
+			unchanged, err := opt.incremental.unchanged(inputPath)
+			if err != nil {
+				return fmt.Errorf("processing error: %w", err)
+			}
+			if unchanged {
+				r.verboseLog("skip unchanged file: %s", inputPath)
+				opt.incremental.skipped = append(opt.incremental.skipped, inputPath)
+				if err := r.markCheckpoint(opt, inputPath, nil); err != nil {
+					return err
+				}
+				continue
+			}
+		}
 		p := NewProcess(r.config, r.confirmFunc)
-		if err := p.Run(ctx, i, inputPath, opt, onBeforeProcessing, onAfterProcessing); err != nil {
-			return fmt.Errorf("processing error: %w", err)
+		err := p.Run(ctx, i, inputPath, opt, onBeforeProcessing, onAfterProcessing)
+		if errors.Is(err, ErrBudgetExceeded) {
+			r.verboseLog("stop processing: %v", err)
+			opt.budget.skipped = opt.inputFilePaths[i:]
+			break
+		}
+		if cerr := r.markCheckpoint(opt, inputPath, err); cerr != nil {
+			return errors.Join(err, cerr)
+		}
+		if err != nil {
+			if !r.config.ContinueOnError || ctx.Err() != nil {
+				r.reportRun(opt)
+				return fmt.Errorf("processing error: %w", err)
+			}
+			_, _ = fmt.Fprintf(os.Stderr, "error: %s: %v\n", inputPath, err)
+			failed = append(failed, inputPath)
+		}
+	}
+	opt.budget.report(os.Stderr)
+	if opt.incremental != nil && len(opt.incremental.skipped) > 0 && !r.config.Silent {
+		_, _ = fmt.Fprintf(os.Stderr, "Skipped %d unchanged files (use --force to process them)\n", len(opt.incremental.skipped))
+	}
+	if r.config.PatchOut != "" && !r.config.DryRun {
+		r.verboseLog("write patch: %s, files: %d", r.config.PatchOut, opt.patchSet.Len())
+		if err := opt.patchSet.Write(r.config.PatchOut); err != nil {
+			return fmt.Errorf("failed to write patch: %w", err)
 		}
 	}
+	r.reportRun(opt)
+	if len(failed) > 0 {
+		_, _ = fmt.Fprintf(os.Stderr, "Failed %d files:\n", len(failed))
+		for _, f := range failed {
+			_, _ = fmt.Fprintf(os.Stderr, "  %s\n", f)
+		}
+		return fmt.Errorf("%w: %d of %d", ErrInputFilesFailed, len(failed), len(opt.inputFilePaths))
+	}
+	return nil
+}
+
+// markCheckpoint records the input file as done, or failed with err, in the run file.
+func (r *Runner) markCheckpoint(opt *RunOption, inputPath string, err error) error {
+	if opt.checkpoint == nil {
+		return nil
+	}
+	status := ItemDone
+	if err != nil {
+		status = ItemFailed
+	}
+	if merr := opt.checkpoint.mark(inputPath, status, err); merr != nil {
+		return fmt.Errorf("failed to update run file: %w", merr)
+	}
 	return nil
 }
+
+// reportRun tells how to resume the run when some input files are not done, and removes the run file when all are done.
+func (r *Runner) reportRun(opt *RunOption) {
+	if opt.checkpoint == nil {
+		return
+	}
+	remaining := len(opt.checkpoint.Remaining())
+	if remaining == 0 {
+		if err := opt.checkpoint.remove(); err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+		}
+		return
+	}
+	_, _ = fmt.Fprintf(os.Stderr, "Run %s has %d unfinished files (%d failed). Resume with: textforge resume %s\n",
+		opt.checkpoint.ID, remaining, opt.checkpoint.Count(ItemFailed), opt.checkpoint.ID)
+}
@@ -0,0 +1,36 @@
+package runner
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunnerCheckPatchPaths(t *testing.T) {
+	abs, err := filepath.Abs(filepath.Join("..", "other", "a.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		patchOut string
+		dryRun   bool
+		paths    []string
+		wantErr  error
+	}{
+		{name: "relative", patchOut: "out.patch", paths: []string{"testdata/input.txt", "..config/a.txt"}},
+		{name: "stdin", patchOut: "out.patch", paths: []string{"-"}},
+		{name: "absolute", patchOut: "out.patch", paths: []string{"testdata/input.txt", abs}, wantErr: ErrPatchOutsideCwd},
+		{name: "parent", patchOut: "out.patch", paths: []string{"../other/a.txt"}, wantErr: ErrPatchOutsideCwd},
+		{name: "without patch-out", paths: []string{abs}},
+		{name: "dry run", patchOut: "out.patch", dryRun: true, paths: []string{abs}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := New(&Config{PatchOut: tt.patchOut, DryRun: tt.dryRun}, tt.paths, nil, nil)
+			if err := r.checkPatchPaths(tt.paths); !errors.Is(err, tt.wantErr) {
+				t.Errorf("checkPatchPaths() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,285 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/ytka/textforge/internal/openai"
+	"github.com/ytka/textforge/internal/prompts"
+	"github.com/ytka/textforge/internal/runner"
+	"github.com/ytka/textforge/internal/steps"
+)
+
+// maxRequestSize is the max size of a request body.
+const maxRequestSize = 10 << 20
+
+// ErrFilePathOutsideRoot is an error when the file_path of a request is not inside the root directory, or no root directory is configured.
+var ErrFilePathOutsideRoot = errors.New("file_path is outside the root directory")
+
+// UsageFunc is called with the usage of each completed request, such as to record it in the ledger.
+type UsageFunc func(prompt, inputPath string, uc *openai.UsageCost)
+
+// Options holds the options of the server.
+type Options struct {
+	// Token, if set, is required as the bearer token of the requests.
+	Token string
+	// MaxConcurrent limits the number of requests to the API at a time. Other requests wait for their turn.
+	MaxConcurrent int
+	// Defaults is the configuration of the requests, overridden by the request fields.
+	Defaults runner.Config
+	// Root is the directory the file_path of the requests is read from. Paths escaping it are rejected, and empty rejects every file_path.
+	Root string
+	// Library resolves the prompt names.
+	Library *prompts.Library
+	// GAIFactory makes the client of the model.
+	GAIFactory runner.GenerativeAIHandlerFactoryFunc
+	// OnUsage is called with the usage of each request, if set.
+	OnUsage UsageFunc
+}
+
+// Server exposes the shaping pipeline as a local REST API.
+type Server struct {
+	opts Options
+	sem  chan struct{}
+	mux  *http.ServeMux
+}
+
+var _ http.Handler = (*Server)(nil)
+
+// New creates a server.
+func New(opts Options) *Server {
+	if opts.MaxConcurrent <= 0 {
+		opts.MaxConcurrent = 1
+	}
+	s := &Server{opts: opts, sem: make(chan struct{}, opts.MaxConcurrent), mux: http.NewServeMux()}
+	s.mux.HandleFunc("GET /healthz", s.handleHealth)
+	s.mux.HandleFunc("GET /prompts", s.handlePrompts)
+	s.mux.HandleFunc("POST /shape", s.handleShape)
+	return s
+}
+
+// ServeHTTP authorizes the request and routes it.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.opts.Token != "" && r.URL.Path != "/healthz" && !s.authorized(r) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeError(w, http.StatusUnauthorized, "invalid or missing bearer token")
+		return
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Server) authorized(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(s.opts.Token)) == 1
+}
+
+func (s *Server) handleHealth(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func (s *Server) handlePrompts(w http.ResponseWriter, _ *http.Request) {
+	if s.opts.Library == nil {
+		writeJSON(w, http.StatusOK, map[string][]string{"prompts": {}})
+		return
+	}
+	list, err := s.opts.Library.List()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	names := make([]string, 0, len(list))
+	for _, p := range list {
+		names = append(names, p.Name)
+	}
+	writeJSON(w, http.StatusOK, map[string][]string{"prompts": names})
+}
+
+func (s *Server) handleShape(w http.ResponseWriter, r *http.Request) {
+	var req ShapeRequest
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestSize))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
+		return
+	}
+
+	if !req.Stream {
+		resp, err := s.shape(r.Context(), &req)
+		if err != nil {
+			writeError(w, statusOf(err), err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, resp)
+		return
+	}
+
+	// Streaming reports the progress as server-sent events, ending with the result or the error.
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	flusher, _ := w.(http.Flusher)
+	send := func(event string, v any) {
+		data, _ := json.Marshal(v)
+		_, _ = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	req.onStatus = func(status string) { send("status", map[string]string{"status": status}) }
+	resp, err := s.shape(r.Context(), &req)
+	if err != nil {
+		send("error", errorBody{Error: err.Error()})
+		return
+	}
+	send("result", resp)
+}
+
+// shape resolves the configuration of the request and shapes the input text, waiting for a free slot of the concurrency limit.
+func (s *Server) shape(ctx context.Context, req *ShapeRequest) (*ShapeResponse, error) {
+	config, promptText, err := s.resolve(req)
+	if err != nil {
+		return nil, err
+	}
+	inputText := req.Input
+	if inputText == "" && req.FilePath != "" {
+		if inputText, err = s.readInputFile(req.FilePath); err != nil {
+			return nil, badRequest(err)
+		}
+	}
+
+	req.status("queued")
+	select {
+	case s.sem <- struct{}{}:
+		defer func() { <-s.sem }()
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	req.status("processing")
+
+	shaper, err := runner.NewShaper(config, s.opts.GAIFactory)
+	if err != nil {
+		return nil, err
+	}
+	result, err := shaper.Shape(ctx, shaper.MakeShapePrompt(req.FilePath, promptText, inputText))
+	if err != nil {
+		return nil, fmt.Errorf("failed to shape text: %w", err)
+	}
+
+	uc := openai.NewUsageCost(result.ChatCompletion)
+	if s.opts.OnUsage != nil {
+		inputPath := req.FilePath
+		if inputPath == "" {
+			inputPath = "-"
+		}
+		s.opts.OnUsage(promptLabel(req), inputPath, uc)
+	}
+	return newShapeResponse(config, req, inputText, result, uc)
+}
+
+// readInputFile reads the file at the path relative to the root directory. Paths escaping the root, also through symbolic links, are rejected.
+func (s *Server) readInputFile(path string) (string, error) {
+	if s.opts.Root == "" {
+		return "", fmt.Errorf("%w: %s", ErrFilePathOutsideRoot, path)
+	}
+	clean := filepath.Clean(filepath.FromSlash(path))
+	if filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%w: %s", ErrFilePathOutsideRoot, path)
+	}
+	root, err := filepath.EvalSymlinks(s.opts.Root)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve root directory: %w", err)
+	}
+	resolved, err := filepath.EvalSymlinks(filepath.Join(root, clean))
+	if err != nil {
+		return "", fmt.Errorf("error reading input file: %w", err)
+	}
+	if rel, err := filepath.Rel(root, resolved); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%w: %s", ErrFilePathOutsideRoot, path)
+	}
+	return steps.GetInputText(resolved)
+}
+
+// resolve applies the request fields to the default configuration and returns it with the prompt text.
+func (s *Server) resolve(req *ShapeRequest) (*runner.Config, string, error) {
+	config := s.opts.Defaults
+	if req.Model != "" {
+		config.Model = req.Model
+	}
+	if req.UseFirstCodeBlock != nil {
+		config.UseFirstCodeBlock = *req.UseFirstCodeBlock
+	}
+	if req.PromptOptimize != nil {
+		config.PromptOptimize = *req.PromptOptimize
+	}
+	if req.DiffFormat != "" {
+		config.DiffFormat = req.DiffFormat
+	}
+	if req.DiffContext != nil {
+		config.DiffContext = *req.DiffContext
+	}
+
+	config.Prompt, config.PromptPath = req.Prompt, ""
+	if req.PromptName != "" {
+		if s.opts.Library == nil {
+			return nil, "", badRequest(prompts.ErrPromptNotFound)
+		}
+		p, err := s.opts.Library.Get(req.PromptName)
+		if err != nil {
+			return nil, "", notFound(err)
+		}
+		config.Prompt = p.Text
+	}
+	if err := config.Validate(nil); err != nil {
+		return nil, "", badRequest(err)
+	}
+	return &config, config.Prompt, nil
+}
+
+func promptLabel(req *ShapeRequest) string {
+	if req.PromptName != "" {
+		return req.PromptName
+	}
+	return "inline"
+}
+
+// statusError is an error with the HTTP status of the response.
+type statusError struct {
+	status int
+	err    error
+}
+
+func (e *statusError) Error() string { return e.err.Error() }
+func (e *statusError) Unwrap() error { return e.err }
+
+func badRequest(err error) error { return &statusError{status: http.StatusBadRequest, err: err} }
+func notFound(err error) error   { return &statusError{status: http.StatusNotFound, err: err} }
+
+func statusOf(err error) int {
+	var se *statusError
+	if errors.As(err, &se) {
+		return se.status
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusBadGateway
+}
+
+type errorBody struct {
+	Error string `json:"error"`
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, errorBody{Error: message})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestServerReadInputFile(t *testing.T) {
+	tmp := t.TempDir()
+	root := filepath.Join(tmp, "root")
+	if err := os.MkdirAll(filepath.Join(root, "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for path, text := range map[string]string{
+		filepath.Join(root, "sub", "a.txt"): "inside",
+		filepath.Join(tmp, "secret.txt"):    "outside",
+	} {
+		if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(tmp, "secret.txt"), filepath.Join(root, "link.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		root    string
+		path    string
+		want    string
+		wantErr error
+	}{
+		{name: "inside", root: root, path: "sub/a.txt", want: "inside"},
+		{name: "cleaned inside", root: root, path: "sub/../sub/a.txt", want: "inside"},
+		{name: "parent", root: root, path: "../secret.txt", wantErr: ErrFilePathOutsideRoot},
+		{name: "absolute", root: root, path: filepath.Join(tmp, "secret.txt"), wantErr: ErrFilePathOutsideRoot},
+		{name: "symlink outside", root: root, path: "link.txt", wantErr: ErrFilePathOutsideRoot},
+		{name: "no root", root: "", path: "sub/a.txt", wantErr: ErrFilePathOutsideRoot},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New(Options{Root: tt.root})
+			got, err := s.readInputFile(tt.path)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("readInputFile(%q) error = %v, want %v", tt.path, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("readInputFile(%q) = %q, %v, want %q", tt.path, got, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"github.com/ytka/textforge/internal/openai"
+	"github.com/ytka/textforge/internal/runner"
+	"github.com/ytka/textforge/internal/steps"
+)
+
+// ShapeRequest is the request of POST /shape.
+type ShapeRequest struct {
+	// Prompt is the prompt text. PromptName takes the prompt from the library instead.
+	Prompt     string `json:"prompt"`
+	PromptName string `json:"prompt_name"`
+	// Input is the text to shape. If empty, the file at FilePath is read.
+	Input string `json:"input"`
+	// FilePath is the path of the input relative to the root directory, given to the prompt for the context of the file type.
+	FilePath          string `json:"file_path"`
+	Model             string `json:"model"`
+	UseFirstCodeBlock *bool  `json:"use_first_code_block"`
+	PromptOptimize    *bool  `json:"prompt_optimize"`
+	// Diff adds the diff text of the input and the result to the response.
+	Diff        bool   `json:"diff"`
+	DiffFormat  string `json:"diff_format"`
+	DiffContext *int   `json:"diff_context"`
+	// Stream responds with server-sent events of the status and the result.
+	Stream bool `json:"stream"`
+
+	onStatus func(status string)
+}
+
+// status reports the status of the request when streaming.
+func (r *ShapeRequest) status(status string) {
+	if r.onStatus != nil {
+		r.onStatus(status)
+	}
+}
+
+// DiffStats is the size of the changes from the input to the result.
+type DiffStats struct {
+	Changed bool `json:"changed"`
+	Added   int  `json:"added"`
+	Removed int  `json:"removed"`
+}
+
+// Cost is the usage and the cost of the request in USD. Costs are null when the model has no pricing.
+type Cost struct {
+	PromptTokens     int      `json:"prompt_tokens"`
+	CompletionTokens int      `json:"completion_tokens"`
+	TotalTokens      int      `json:"total_tokens"`
+	CachedTokens     int      `json:"cached_tokens"`
+	FromCache        bool     `json:"from_cache"`
+	PromptCost       *float64 `json:"prompt_cost_usd"`
+	CompletionCost   *float64 `json:"completion_cost_usd"`
+	TotalCost        *float64 `json:"total_cost_usd"`
+}
+
+// ShapeResponse is the response of POST /shape with the fields of the shape result.
+type ShapeResponse struct {
+	Prompt     string    `json:"prompt"`
+	RawResult  string    `json:"raw_result"`
+	Result     string    `json:"result"`
+	Model      string    `json:"model"`
+	DiffStats  DiffStats `json:"diff_stats"`
+	Diff       string    `json:"diff,omitempty"`
+	Cost       Cost      `json:"cost"`
+	DurationMS int64     `json:"duration_ms"`
+}
+
+func newShapeResponse(config *runner.Config, req *ShapeRequest, inputText string, result *steps.ShapeResult, uc *openai.UsageCost) (*ShapeResponse, error) {
+	changed, added, removed := steps.GetDiffSize(inputText, result.Result)
+	resp := &ShapeResponse{
+		Prompt:     result.Prompt,
+		RawResult:  result.RawResult,
+		Result:     result.Result,
+		Model:      uc.ModelName(),
+		DiffStats:  DiffStats{Changed: changed, Added: added, Removed: removed},
+		Cost:       newCost(uc),
+		DurationMS: result.Duration.Milliseconds(),
+	}
+	if req.Diff {
+		format, err := steps.ParseDiffFormat(config.DiffFormat)
+		if err != nil {
+			return nil, badRequest(err)
+		}
+		name := req.FilePath
+		if name == "" {
+			name = "input"
+		}
+		resp.Diff = steps.Diff(name, inputText, result.Result, steps.DiffOption{Format: format, ContextLines: config.DiffContext})
+	}
+	return resp, nil
+}
+
+func newCost(uc *openai.UsageCost) Cost {
+	cost := Cost{
+		PromptTokens:     uc.PromptTokens(),
+		CompletionTokens: uc.CompletionTokens(),
+		TotalTokens:      uc.TotalTokens(),
+		CachedTokens:     uc.CachedTokens(),
+		FromCache:        uc.FromCache(),
+	}
+	if ok, v := uc.PromptTokensCost(); ok {
+		cost.PromptCost = &v
+	}
+	if ok, v := uc.CompletionTokensCost(); ok {
+		cost.CompletionCost = &v
+	}
+	if ok, v := uc.TotalTokensCost(); ok {
+		cost.TotalCost = &v
+	}
+	return cost
+}
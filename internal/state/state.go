@@ -0,0 +1,105 @@
+package state
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// DefaultPath is the default path of the state file, relative to the current directory.
+const DefaultPath = ".textforge/state.json"
+
+// version is the format version of the state file.
+const version = 1
+
+// Entry records an input file at the time of its last successful processing.
+type Entry struct {
+	ContentHash string    `json:"content_hash"`
+	PromptHash  string    `json:"prompt_hash"`
+	Model       string    `json:"model"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// File is the state of the processed input files, keyed by the input path.
+type File struct {
+	path    string
+	Version int              `json:"version"`
+	Entries map[string]Entry `json:"entries"`
+}
+
+// Load reads the state file at path. A missing file is an empty state.
+func Load(path string) (*File, error) {
+	f := &File{path: path, Version: version, Entries: map[string]Entry{}}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return f, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state file: %w", err)
+	}
+	if err := json.Unmarshal(data, f); err != nil {
+		return nil, fmt.Errorf("failed to parse state file %s: %w", path, err)
+	}
+	if f.Entries == nil {
+		f.Entries = map[string]Entry{}
+	}
+	return f, nil
+}
+
+// key converts the input path to the key, a slash separated clean path.
+func key(inputPath string) string {
+	return filepath.ToSlash(filepath.Clean(inputPath))
+}
+
+// Unchanged reports whether the input was processed with the same content, prompt and model.
+func (f *File) Unchanged(inputPath string, e Entry) bool {
+	prev, ok := f.Entries[key(inputPath)]
+	return ok && prev.ContentHash == e.ContentHash && prev.PromptHash == e.PromptHash && prev.Model == e.Model
+}
+
+// Record records the entry of the input and saves the state file, so that a killed run keeps the finished files.
+func (f *File) Record(inputPath string, e Entry) error {
+	f.Entries[key(inputPath)] = e
+	return f.save()
+}
+
+// save writes the state file atomically.
+func (f *File) save() error {
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal state: %w", err)
+	}
+	dir := filepath.Dir(f.path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(dir, ".state-*")
+	if err != nil {
+		return fmt.Errorf("failed to create state file: %w", err)
+	}
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), f.path); err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	return nil
+}
+
+// Hash returns the SHA-256 hash of s in hex.
+func Hash(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
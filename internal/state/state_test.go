@@ -0,0 +1,67 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHash(t *testing.T) {
+	if got, want := Hash(""), "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"; got != want {
+		t.Errorf("Hash(\"\") = %s, want %s", got, want)
+	}
+	if Hash("a") == Hash("b") {
+		t.Error("different texts have the same hash")
+	}
+}
+
+func TestFileUnchanged(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".textforge", "state.json")
+	f, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorded := Entry{ContentHash: Hash("content"), PromptHash: Hash("prompt"), Model: "gpt-4o"}
+	if f.Unchanged("a.txt", recorded) {
+		t.Error("Unchanged() of an unrecorded file = true")
+	}
+	if err := f.Record("./dir/../a.txt", recorded); err != nil {
+		t.Fatal(err)
+	}
+
+	// The state is saved on each record, so that a new run sees it.
+	f, err = Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		path  string
+		entry Entry
+		want  bool
+	}{
+		{name: "same", path: "a.txt", entry: recorded, want: true},
+		{name: "same with another spelling of the path", path: "./a.txt", entry: recorded, want: true},
+		{name: "content changed", path: "a.txt", entry: Entry{ContentHash: Hash("edited"), PromptHash: recorded.PromptHash, Model: recorded.Model}},
+		{name: "prompt changed", path: "a.txt", entry: Entry{ContentHash: recorded.ContentHash, PromptHash: Hash("other"), Model: recorded.Model}},
+		{name: "model changed", path: "a.txt", entry: Entry{ContentHash: recorded.ContentHash, PromptHash: recorded.PromptHash, Model: "gpt-4o-mini"}},
+		{name: "other file", path: "b.txt", entry: recorded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := f.Unchanged(tt.path, tt.entry); got != tt.want {
+				t.Errorf("Unchanged(%q) = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadBrokenFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := os.WriteFile(path, []byte("{"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err == nil {
+		t.Error("Load() of a broken file succeeded")
+	}
+}
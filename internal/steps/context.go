@@ -0,0 +1,34 @@
+package steps
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// ContextFile is a read-only reference file attached to the prompt, such as a neighbouring file with the types and conventions to follow.
+type ContextFile struct {
+	Path      string
+	Text      string
+	Truncated bool
+}
+
+// formatContextFiles wraps each context file in a textforge-context tag with its path, skipping the input file itself.
+func formatContextFiles(files []ContextFile, inputFilePath string) string {
+	var sb strings.Builder
+	for _, f := range files {
+		if inputFilePath != "" && filepath.Clean(f.Path) == filepath.Clean(inputFilePath) {
+			continue
+		}
+		truncated := ""
+		if f.Truncated {
+			truncated = ` truncated="true"`
+		}
+		text := f.Text
+		if !strings.HasSuffix(text, "\n") {
+			text += "\n"
+		}
+		_, _ = fmt.Fprintf(&sb, "<textforge-context path=\"%s\"%s>\n%s</textforge-context>\n", f.Path, truncated, text)
+	}
+	return sb.String()
+}
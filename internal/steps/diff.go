@@ -0,0 +1,369 @@
+package steps
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// DiffFormat is the output format of a diff.
+type DiffFormat string
+
+const (
+	DiffFormatUnified    DiffFormat = "unified"
+	DiffFormatSideBySide DiffFormat = "side-by-side"
+	DiffFormatWord       DiffFormat = "word"
+	DiffFormatPretty     DiffFormat = "pretty"
+)
+
+const (
+	colorReset = "\x1b[0m"
+	colorRed   = "\x1b[31m"
+	colorGreen = "\x1b[32m"
+	colorCyan  = "\x1b[36m"
+	colorBold  = "\x1b[1m"
+
+	sideBySideColumnWidth = 60
+
+	surrogateMin = 0xD800
+	surrogateMax = 0xDFFF
+)
+
+// ErrInvalidDiffFormat is an error for an unknown diff format.
+var ErrInvalidDiffFormat = errors.New("invalid diff format")
+
+// ParseDiffFormat converts a string to a DiffFormat.
+func ParseDiffFormat(s string) (DiffFormat, error) {
+	switch f := DiffFormat(s); f {
+	case DiffFormatUnified, DiffFormatSideBySide, DiffFormatWord, DiffFormatPretty:
+		return f, nil
+	default:
+		return "", fmt.Errorf("%w: %s (expected unified, side-by-side, word or pretty)", ErrInvalidDiffFormat, s)
+	}
+}
+
+// DiffOption holds options for rendering a diff.
+type DiffOption struct {
+	Format       DiffFormat
+	ContextLines int
+	Color        bool
+}
+
+// diffLine is a single line of a line-level diff.
+type diffLine struct {
+	op   diffmatchpatch.Operation
+	text string
+}
+
+// lineDiff computes a line-level diff between leftText and rightText.
+// Each distinct line is encoded as a single rune so that the diff is computed line by line.
+func lineDiff(leftText, rightText string) []diffLine {
+	var lineArray []string
+	lineIndex := map[string]rune{}
+	encode := func(text string) []rune {
+		var runes []rune
+		for _, l := range strings.SplitAfter(text, "\n") {
+			if l == "" {
+				continue
+			}
+			r, ok := lineIndex[l]
+			if !ok {
+				r = lineRune(len(lineArray))
+				lineIndex[l] = r
+				lineArray = append(lineArray, l)
+			}
+			runes = append(runes, r)
+		}
+		return runes
+	}
+	left, right := encode(leftText), encode(rightText)
+
+	dmp := diffmatchpatch.New()
+	var lines []diffLine
+	for _, d := range dmp.DiffMainRunes(left, right, false) {
+		for _, r := range d.Text {
+			lines = append(lines, diffLine{op: d.Type, text: lineArray[runeLine(r)]})
+		}
+	}
+	return lines
+}
+
+// lineRune converts a line index to a rune, skipping the surrogate range which is not a valid rune.
+func lineRune(i int) rune {
+	if i >= surrogateMin {
+		return rune(i + surrogateMax - surrogateMin + 1)
+	}
+	return rune(i)
+}
+
+// runeLine converts a rune made by lineRune back to a line index.
+func runeLine(r rune) int {
+	if r > surrogateMax {
+		return int(r) - (surrogateMax - surrogateMin + 1)
+	}
+	return int(r)
+}
+
+// Diff renders the differences between leftText and rightText in the given format.
+// The name is used for the file headers of the unified format.
+func Diff(name, leftText, rightText string, opt DiffOption) string {
+	switch opt.Format {
+	case DiffFormatSideBySide:
+		return sideBySideDiff(leftText, rightText, opt.Color)
+	case DiffFormatWord:
+		return wordDiff(leftText, rightText, opt.Color)
+	case DiffFormatPretty:
+		return prettyDiff(leftText, rightText, opt.Color)
+	case DiffFormatUnified:
+		return UnifiedDiff(name, leftText, rightText, opt.ContextLines, opt.Color)
+	default:
+		return UnifiedDiff(name, leftText, rightText, opt.ContextLines, opt.Color)
+	}
+}
+
+// hunk is a group of changed lines with surrounding context.
+type hunk struct {
+	leftStart, leftCount   int
+	rightStart, rightCount int
+	lines                  []diffLine
+}
+
+// makeHunks groups the changed lines into hunks with contextLines lines of context.
+func makeHunks(lines []diffLine, contextLines int) []hunk {
+	leftLines := make([]int, len(lines)+1)
+	rightLines := make([]int, len(lines)+1)
+	leftLines[0], rightLines[0] = 1, 1
+	for i, l := range lines {
+		leftLines[i+1], rightLines[i+1] = leftLines[i], rightLines[i]
+		if l.op != diffmatchpatch.DiffInsert {
+			leftLines[i+1]++
+		}
+		if l.op != diffmatchpatch.DiffDelete {
+			rightLines[i+1]++
+		}
+	}
+
+	var hunks []hunk
+	start, end := -1, -1
+	flush := func() {
+		h := hunk{leftStart: leftLines[start], rightStart: rightLines[start], lines: lines[start:end]}
+		h.leftCount = leftLines[end] - leftLines[start]
+		h.rightCount = rightLines[end] - rightLines[start]
+		hunks = append(hunks, h)
+	}
+	for i, l := range lines {
+		if l.op == diffmatchpatch.DiffEqual {
+			continue
+		}
+		s, e := max(i-contextLines, 0), min(i+contextLines+1, len(lines))
+		if start >= 0 && s > end {
+			flush()
+			start = -1
+		}
+		if start < 0 {
+			start = s
+		}
+		end = e
+	}
+	if start >= 0 {
+		flush()
+	}
+	return hunks
+}
+
+// hunkRange formats a hunk range as used in unified diff headers.
+func hunkRange(start, count int) string {
+	if count == 0 {
+		start--
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+// colorize wraps text with the color code when enabled.
+func colorize(text, color string, enabled bool) string {
+	if !enabled || text == "" {
+		return text
+	}
+	return color + text + colorReset
+}
+
+// UnifiedDiff returns the differences between leftText and rightText in the unified diff format.
+// It returns an empty string if there are no differences.
+func UnifiedDiff(name, leftText, rightText string, contextLines int, color bool) string {
+	hunks := makeHunks(lineDiff(leftText, rightText), max(contextLines, 0))
+	if len(hunks) == 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+	sb.WriteString(colorize(fmt.Sprintf("--- a/%s\n", name), colorBold, color))
+	sb.WriteString(colorize(fmt.Sprintf("+++ b/%s\n", name), colorBold, color))
+	for _, h := range hunks {
+		header := fmt.Sprintf("@@ -%s +%s @@", hunkRange(h.leftStart, h.leftCount), hunkRange(h.rightStart, h.rightCount))
+		sb.WriteString(colorize(header, colorCyan, color))
+		sb.WriteString("\n")
+		for _, l := range h.lines {
+			prefix, lineColor := " ", ""
+			switch l.op {
+			case diffmatchpatch.DiffDelete:
+				prefix, lineColor = "-", colorRed
+			case diffmatchpatch.DiffInsert:
+				prefix, lineColor = "+", colorGreen
+			case diffmatchpatch.DiffEqual:
+			}
+			text := strings.TrimSuffix(l.text, "\n")
+			if lineColor != "" {
+				sb.WriteString(colorize(prefix+text, lineColor, color))
+			} else {
+				sb.WriteString(prefix + text)
+			}
+			sb.WriteString("\n")
+			if !strings.HasSuffix(l.text, "\n") {
+				sb.WriteString("\\ No newline at end of file\n")
+			}
+		}
+	}
+	return sb.String()
+}
+
+// sideBySideDiff returns the differences between leftText and rightText in two columns.
+func sideBySideDiff(leftText, rightText string, color bool) string {
+	lines := lineDiff(leftText, rightText)
+	var sb strings.Builder
+	writeRow := func(left, mark, right, rowColor string) {
+		row := fmt.Sprintf("%-*s %s %s", sideBySideColumnWidth, truncateColumn(left), mark, truncateColumn(right))
+		sb.WriteString(colorize(strings.TrimRight(row, " "), rowColor, color))
+		sb.WriteString("\n")
+	}
+
+	for i := 0; i < len(lines); {
+		if lines[i].op == diffmatchpatch.DiffEqual {
+			text := strings.TrimSuffix(lines[i].text, "\n")
+			writeRow(text, " ", text, "")
+			i++
+			continue
+		}
+		var deleted, inserted []string
+		for ; i < len(lines) && lines[i].op != diffmatchpatch.DiffEqual; i++ {
+			text := strings.TrimSuffix(lines[i].text, "\n")
+			if lines[i].op == diffmatchpatch.DiffDelete {
+				deleted = append(deleted, text)
+			} else {
+				inserted = append(inserted, text)
+			}
+		}
+		for j := 0; j < max(len(deleted), len(inserted)); j++ {
+			switch {
+			case j < len(deleted) && j < len(inserted):
+				writeRow(deleted[j], "|", inserted[j], colorCyan)
+			case j < len(deleted):
+				writeRow(deleted[j], "<", "", colorRed)
+			default:
+				writeRow("", ">", inserted[j], colorGreen)
+			}
+		}
+	}
+	return sb.String()
+}
+
+// truncateColumn shortens text to fit in a side-by-side column.
+func truncateColumn(text string) string {
+	text = strings.ReplaceAll(text, "\t", "    ")
+	runes := []rune(text)
+	if len(runes) > sideBySideColumnWidth {
+		return string(runes[:sideBySideColumnWidth-1]) + "…"
+	}
+	return text
+}
+
+// wordDiff returns the differences between leftText and rightText marked inline at the word level.
+func wordDiff(leftText, rightText string, color bool) string {
+	dmp := diffmatchpatch.New()
+	diffs := dmp.DiffMain(leftText, rightText, false)
+	diffs = dmp.DiffCleanupSemantic(diffs)
+	return inlineDiffText(diffs, color)
+}
+
+// prettyDiff returns the line-level differences between leftText and rightText marked inline.
+func prettyDiff(leftText, rightText string, color bool) string {
+	var diffs []diffmatchpatch.Diff
+	for _, l := range lineDiff(leftText, rightText) {
+		if n := len(diffs); n > 0 && diffs[n-1].Type == l.op {
+			diffs[n-1].Text += l.text
+			continue
+		}
+		diffs = append(diffs, diffmatchpatch.Diff{Type: l.op, Text: l.text})
+	}
+	if color {
+		return diffmatchpatch.New().DiffPrettyText(diffs)
+	}
+	return inlineDiffText(diffs, false)
+}
+
+// inlineDiffText renders diffs inline, using colors or [-removed-]{+added+} markers.
+func inlineDiffText(diffs []diffmatchpatch.Diff, color bool) string {
+	var sb strings.Builder
+	for _, d := range diffs {
+		switch d.Type {
+		case diffmatchpatch.DiffInsert:
+			if color {
+				sb.WriteString(colorize(d.Text, colorGreen, true))
+			} else {
+				sb.WriteString("{+" + d.Text + "+}")
+			}
+		case diffmatchpatch.DiffDelete:
+			if color {
+				sb.WriteString(colorize(d.Text, colorRed, true))
+			} else {
+				sb.WriteString("[-" + d.Text + "-]")
+			}
+		case diffmatchpatch.DiffEqual:
+			sb.WriteString(d.Text)
+		}
+	}
+	return sb.String()
+}
+
+// PatchSet collects unified diffs of several files into a single patch.
+type PatchSet struct {
+	patches []string
+}
+
+// NewPatchSet creates a new PatchSet.
+func NewPatchSet() *PatchSet {
+	return &PatchSet{}
+}
+
+// Add adds the differences of the file at path to the patch set.
+func (ps *PatchSet) Add(path, leftText, rightText string, contextLines int) {
+	if patch := UnifiedDiff(path, leftText, rightText, contextLines, false); patch != "" {
+		ps.patches = append(ps.patches, fmt.Sprintf("diff --git a/%s b/%s\n%s", path, path, patch))
+	}
+}
+
+// AddNew adds the file created at path to the patch set, so that the patch creates it when applied.
+func (ps *PatchSet) AddNew(path, text string, contextLines int) {
+	if patch := UnifiedDiff(path, "", text, contextLines, false); patch != "" {
+		patch = strings.Replace(patch, fmt.Sprintf("--- a/%s\n", path), "--- /dev/null\n", 1)
+		ps.patches = append(ps.patches, fmt.Sprintf("diff --git a/%s b/%s\nnew file mode 100644\n%s", path, path, patch))
+	}
+}
+
+// Len returns the number of files in the patch set.
+func (ps *PatchSet) Len() int {
+	return len(ps.patches)
+}
+
+// Write writes the combined patch to outpath.
+func (ps *PatchSet) Write(outpath string) error {
+	if err := os.WriteFile(outpath, []byte(strings.Join(ps.patches, "")), 0o600); err != nil {
+		return fmt.Errorf("error writing patch file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+package steps
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"github.com/ytka/textforge/internal/openai"
+)
+
+var (
+	// reSchemaNameInvalid matches the characters not allowed in the name of a json_schema response format.
+	reSchemaNameInvalid = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+	// ErrJSONSchemaValidation is an error when the response does not match the JSON schema even after the repair turn.
+	ErrJSONSchemaValidation = errors.New("response does not match the JSON schema")
+
+	// ErrJSONSchemaNotStrict is an error when the JSON schema cannot be used in the strict mode of structured outputs.
+	ErrJSONSchemaNotStrict = errors.New("JSON schema does not meet the strict mode of structured outputs (use --json-object to validate it locally only)")
+)
+
+// jsonRepairPrompt asks the model to fix the JSON which failed the validation.
+const jsonRepairPrompt = "The JSON does not match the schema:\n%v\nReturn the corrected JSON only."
+
+// JSONSchema is the schema the response must match in the JSON output mode.
+type JSONSchema struct {
+	name       string
+	raw        json.RawMessage
+	schema     *jsonschema.Schema
+	jsonObject bool
+	rawOutput  bool
+}
+
+// LoadJSONSchema reads and compiles the JSON schema file.
+// With jsonObject, the request asks for json_object instead of json_schema, for providers without structured outputs; the response is validated locally either way.
+// With rawOutput, the JSON is written as returned instead of pretty-printed.
+func LoadJSONSchema(path string, jsonObject, rawOutput bool) (*JSONSchema, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JSON schema: %w", err)
+	}
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse JSON schema: %w", err)
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get absolute path: %w", err)
+	}
+	c := jsonschema.NewCompiler()
+	if err := c.AddResource(abs, doc); err != nil {
+		return nil, fmt.Errorf("failed to load JSON schema: %w", err)
+	}
+	schema, err := c.Compile(abs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile JSON schema: %w", err)
+	}
+	if !jsonObject {
+		if err := checkStrict(doc, "#"); err != nil {
+			return nil, err
+		}
+	}
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, data); err != nil {
+		return nil, fmt.Errorf("failed to parse JSON schema: %w", err)
+	}
+
+	name := reSchemaNameInvalid.ReplaceAllString(strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)), "_")
+	if name == "" {
+		name = "response"
+	}
+	return &JSONSchema{name: name[:min(len(name), 64)], raw: compact.Bytes(), schema: schema, jsonObject: jsonObject, rawOutput: rawOutput}, nil
+}
+
+// String returns the schema as compact JSON.
+func (js *JSONSchema) String() string {
+	return string(js.raw)
+}
+
+// responseFormat returns the response format of the requests.
+func (js *JSONSchema) responseFormat() *openai.ResponseFormat {
+	if js.jsonObject {
+		return &openai.ResponseFormat{Type: "json_object"}
+	}
+	return &openai.ResponseFormat{Type: "json_schema", JSONSchema: &openai.JSONSchemaFormat{Name: js.name, Schema: js.raw, Strict: true}}
+}
+
+// sortedKeys returns the keys of the map in order, so that the errors are stable.
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// checkStrict checks the requirements of the strict mode which the API rejects late or silently:
+// the top level is an object, and each object sets additionalProperties to false and requires all of its properties.
+func checkStrict(doc any, ptr string) error {
+	m, ok := doc.(map[string]any)
+	if !ok {
+		return nil
+	}
+	if ptr == "#" && m["type"] != "object" {
+		return fmt.Errorf("%w: %s: the top level must be an object", ErrJSONSchemaNotStrict, ptr)
+	}
+	if props, ok := m["properties"].(map[string]any); ok || m["type"] == "object" {
+		if m["additionalProperties"] != false {
+			return fmt.Errorf("%w: %s: additionalProperties must be false", ErrJSONSchemaNotStrict, ptr)
+		}
+		required := map[string]bool{}
+		if list, ok := m["required"].([]any); ok {
+			for _, name := range list {
+				if s, ok := name.(string); ok {
+					required[s] = true
+				}
+			}
+		}
+		for _, name := range sortedKeys(props) {
+			if !required[name] {
+				return fmt.Errorf("%w: %s: property %q must be required", ErrJSONSchemaNotStrict, ptr, name)
+			}
+			if err := checkStrict(props[name], ptr+"/properties/"+name); err != nil {
+				return err
+			}
+		}
+	}
+	for _, key := range []string{"items", "$defs", "definitions", "anyOf"} {
+		switch v := m[key].(type) {
+		case map[string]any:
+			if key == "items" {
+				if err := checkStrict(v, ptr+"/"+key); err != nil {
+					return err
+				}
+				continue
+			}
+			for _, name := range sortedKeys(v) {
+				if err := checkStrict(v[name], ptr+"/"+key+"/"+name); err != nil {
+					return err
+				}
+			}
+		case []any:
+			for i, s := range v {
+				if err := checkStrict(s, fmt.Sprintf("%s/%s/%d", ptr, key, i)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// instruction returns the instruction of the output, including the schema for the providers which do not receive it in the response format.
+func (js *JSONSchema) instruction() string {
+	return fmt.Sprintf("Return only a JSON value matching the following JSON Schema, without a textforge-output tag or explanation: %s", js.raw)
+}
+
+// validate checks the JSON in the response against the schema and returns it pretty-printed, or as returned with rawOutput.
+func (js *JSONSchema) validate(rawResult string) (string, error) {
+	text := strings.TrimSpace(optimizeResponseResult(rawResult, false))
+	inst, err := jsonschema.UnmarshalJSON(strings.NewReader(text))
+	if err != nil {
+		return "", fmt.Errorf("invalid JSON: %w", err)
+	}
+	if err := js.schema.Validate(inst); err != nil {
+		return "", err
+	}
+	if js.rawOutput {
+		return text, nil
+	}
+	var pretty bytes.Buffer
+	if err := json.Indent(&pretty, []byte(text), "", "  "); err != nil {
+		return "", fmt.Errorf("invalid JSON: %w", err)
+	}
+	return pretty.String(), nil
+}
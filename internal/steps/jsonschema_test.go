@@ -0,0 +1,46 @@
+package steps
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadJSONSchemaStrict(t *testing.T) {
+	tests := []struct {
+		name       string
+		schema     string
+		jsonObject bool
+		wantErr    error
+	}{
+		{
+			name:   "strict",
+			schema: `{"type":"object","properties":{"todos":{"type":"array","items":{"type":"object","properties":{"line":{"type":"integer"}},"required":["line"],"additionalProperties":false}}},"required":["todos"],"additionalProperties":false}`,
+		},
+		{name: "top level array", schema: `{"type":"array","items":{"type":"string"}}`, wantErr: ErrJSONSchemaNotStrict},
+		{name: "additional properties", schema: `{"type":"object","properties":{"a":{"type":"string"}},"required":["a"]}`, wantErr: ErrJSONSchemaNotStrict},
+		{name: "optional property", schema: `{"type":"object","properties":{"a":{"type":"string"}},"additionalProperties":false}`, wantErr: ErrJSONSchemaNotStrict},
+		{
+			name:    "nested object",
+			schema:  `{"type":"object","properties":{"a":{"type":"object","properties":{"b":{"type":"string"}}}},"required":["a"],"additionalProperties":false}`,
+			wantErr: ErrJSONSchemaNotStrict,
+		},
+		{name: "json object", schema: `{"type":"array","items":{"type":"string"}}`, jsonObject: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "test.schema.json")
+			if err := os.WriteFile(path, []byte(tt.schema), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			js, err := LoadJSONSchema(path, tt.jsonObject, false)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("LoadJSONSchema() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && !tt.jsonObject && !js.responseFormat().JSONSchema.Strict {
+				t.Error("responseFormat() is not strict")
+			}
+		})
+	}
+}
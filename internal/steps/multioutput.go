@@ -0,0 +1,108 @@
+package steps
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+var (
+	// reOutputFileBlock is a regular expression to find the output tag blocks with a path in the multi-output mode.
+	reOutputFileBlock = regexp.MustCompile(`(?s)<textforge-output\s+path="([^"]*)"\s*>\n?(.*?)</textforge-output>`)
+
+	// ErrNoOutputFiles is an error when a multi-output response has no output tag blocks with a path.
+	ErrNoOutputFiles = errors.New("no output files in the response")
+	// ErrOutputPathOutsideRoot is an error when an output file path is not inside the project root.
+	ErrOutputPathOutsideRoot = errors.New("output file path is outside the project root")
+)
+
+// multiOutputSupplement is the instruction of the multi-output protocol, replacing the single output tag.
+const multiOutputSupplement = `The result may consist of several files. Wrap each file in a <textforge-output path="..."> tag with its path relative to the current directory, and return the whole content of each file. Only the files to create or modify should be returned.`
+
+// OutputFile is a file created or modified by a multi-output response.
+type OutputFile struct {
+	Path string
+	Text string
+}
+
+// ParseOutputFiles extracts the output files from the response. A path returned more than once keeps its last content.
+func ParseOutputFiles(rawResult string, useFirstCodeBlock bool) ([]OutputFile, error) {
+	matches := reOutputFileBlock.FindAllStringSubmatch(rawResult, -1)
+	if len(matches) == 0 {
+		return nil, ErrNoOutputFiles
+	}
+	var files []OutputFile
+	index := map[string]int{}
+	for _, m := range matches {
+		path := strings.TrimSpace(m[1])
+		if path == "" {
+			return nil, fmt.Errorf("%w: empty path", ErrOutputPathOutsideRoot)
+		}
+		text := optimizeResponseResult(strings.TrimSuffix(m[2], "\n"), useFirstCodeBlock)
+		if !strings.HasSuffix(text, "\n") {
+			text += "\n"
+		}
+		if i, ok := index[path]; ok {
+			files[i].Text = text
+			continue
+		}
+		index[path] = len(files)
+		files = append(files, OutputFile{Path: path, Text: text})
+	}
+	return files, nil
+}
+
+// ResolveOutputPath returns the clean path of the output file, which must stay inside the root directory after following the symbolic links.
+// Paths in a .git directory are rejected so that a response cannot rewrite the repository.
+func ResolveOutputPath(root, path string) (string, error) {
+	clean := filepath.Clean(path)
+	if filepath.IsAbs(clean) || slices.Contains(strings.Split(filepath.ToSlash(clean), "/"), ".git") {
+		return "", fmt.Errorf("%w: %s", ErrOutputPathOutsideRoot, path)
+	}
+	abs, err := filepath.Abs(clean)
+	if err != nil {
+		return "", fmt.Errorf("failed to get absolute path: %w", err)
+	}
+	resolvedRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve project root: %w", err)
+	}
+	resolved, err := evalExistingSymlinks(abs)
+	if err != nil {
+		return "", err
+	}
+	if !insideDir(resolvedRoot, resolved) {
+		return "", fmt.Errorf("%w: %s", ErrOutputPathOutsideRoot, path)
+	}
+	return clean, nil
+}
+
+// evalExistingSymlinks follows the symbolic links of the longest existing part of the path, which may not exist yet.
+func evalExistingSymlinks(path string) (string, error) {
+	var rest []string
+	for {
+		resolved, err := filepath.EvalSymlinks(path)
+		if err == nil {
+			return filepath.Join(append([]string{resolved}, rest...)...), nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", fmt.Errorf("failed to resolve output file path: %w", err)
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return "", fmt.Errorf("failed to resolve output file path: %w", err)
+		}
+		rest = append([]string{filepath.Base(path)}, rest...)
+		path = parent
+	}
+}
+
+// insideDir reports whether the absolute path is the directory or inside it.
+func insideDir(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,78 @@
+package steps
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolveOutputPath(t *testing.T) {
+	tmp, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := filepath.Join(tmp, "root")
+	outside := filepath.Join(tmp, "outside")
+	for _, dir := range []string{filepath.Join(root, "sub"), filepath.Join(root, ".git"), outside} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(outside, "file.txt"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for link, target := range map[string]string{
+		"link-dir":  outside,
+		"link-file": filepath.Join(outside, "file.txt"),
+		"link-sub":  filepath.Join(root, "sub"),
+	} {
+		if err := os.Symlink(target, filepath.Join(root, link)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(root); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.Chdir(wd) })
+
+	tests := []struct {
+		path    string
+		want    string
+		wantErr error
+	}{
+		{path: "a.txt", want: "a.txt"},
+		{path: "sub/../a.txt", want: "a.txt"},
+		{path: "new/dir/b.txt", want: "new/dir/b.txt"},
+		{path: "link-sub/c.txt", want: "link-sub/c.txt"},
+		{path: "../outside/file.txt", wantErr: ErrOutputPathOutsideRoot},
+		{path: "sub/../../x.txt", wantErr: ErrOutputPathOutsideRoot},
+		{path: filepath.Join(root, "a.txt"), wantErr: ErrOutputPathOutsideRoot},
+		{path: "/etc/passwd", wantErr: ErrOutputPathOutsideRoot},
+		{path: ".git/config", wantErr: ErrOutputPathOutsideRoot},
+		{path: ".git/hooks/pre-commit", wantErr: ErrOutputPathOutsideRoot},
+		{path: "sub/.git/config", wantErr: ErrOutputPathOutsideRoot},
+		{path: "sub/../.git/config", wantErr: ErrOutputPathOutsideRoot},
+		{path: "link-dir/new.txt", wantErr: ErrOutputPathOutsideRoot},
+		{path: "link-dir/deep/new.txt", wantErr: ErrOutputPathOutsideRoot},
+		{path: "link-file", wantErr: ErrOutputPathOutsideRoot},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, err := ResolveOutputPath(root, tt.path)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("ResolveOutputPath(%q) = %q, %v, want %v", tt.path, got, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != filepath.FromSlash(tt.want) {
+				t.Errorf("ResolveOutputPath(%q) = %q, %v, want %q", tt.path, got, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package steps
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// ErrOutpathNotTemplated is an error when the outpath is the same for several inputs.
+var ErrOutpathNotTemplated = errors.New("outpath must be a template such as {{.Dir}}/{{.Stem}}.out{{.Ext}} for several input files")
+
+// OutpathTemplate makes the output path of an input path.
+type OutpathTemplate struct {
+	tmpl   *template.Template
+	static bool
+}
+
+// outpathData is the data of the template.
+type outpathData struct {
+	Path string // Path is the input path, e.g. docs/README.ja.md
+	Dir  string // Dir is the directory of the input, e.g. docs
+	Base string // Base is the file name, e.g. README.ja.md
+	Stem string // Stem is the file name without the extension, e.g. README.ja
+	Ext  string // Ext is the extension, e.g. .md
+}
+
+// ParseOutpathTemplate parses the outpath in the Go template syntax. trimSuffix and replace are available as functions.
+func ParseOutpathTemplate(text string) (*OutpathTemplate, error) {
+	tmpl, err := template.New("outpath").Option("missingkey=error").Funcs(template.FuncMap{
+		"trimSuffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+		"replace":    func(old, new, s string) string { return strings.ReplaceAll(s, old, new) },
+	}).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse outpath template: %w", err)
+	}
+	return &OutpathTemplate{tmpl: tmpl, static: !strings.Contains(text, "{{")}, nil
+}
+
+// Static reports whether the outpath is the same for all inputs.
+func (t *OutpathTemplate) Static() bool {
+	return t.static
+}
+
+// Execute returns the output path of the input path.
+func (t *OutpathTemplate) Execute(inputPath string) (string, error) {
+	base := filepath.Base(inputPath)
+	ext := filepath.Ext(base)
+	data := outpathData{Path: inputPath, Dir: filepath.Dir(inputPath), Base: base, Stem: strings.TrimSuffix(base, ext), Ext: ext}
+	var buf bytes.Buffer
+	if err := t.tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to make outpath of %s: %w", inputPath, err)
+	}
+	return filepath.Clean(buf.String()), nil
+}
@@ -2,19 +2,11 @@ package steps
 
 import (
 	"fmt"
+	"io"
 
 	"github.com/sergi/go-diff/diffmatchpatch"
 )
 
-// diff returns a formatted string showing the differences between leftText and rightText.
-func diff(leftText, rightText string) string {
-	dmp := diffmatchpatch.New()
-	a, b, c := dmp.DiffLinesToChars(leftText, rightText)
-	diffs := dmp.DiffMain(a, b, false)
-	diffs = dmp.DiffCharsToLines(diffs, c)
-	return dmp.DiffPrettyText(diffs)
-}
-
 // GetDiffSize returns a boolean indicating if there are any differences and the number of characters added and removed.
 func GetDiffSize(leftText, rightText string) (bool, int, int) {
 	dmp := diffmatchpatch.New()
@@ -36,17 +28,14 @@ func GetDiffSize(leftText, rightText string) (bool, int, int) {
 	return added > 0 || removed > 0, added, removed
 }
 
-// Print outputs the provided outputText to the console. If useDiff is true, it also prints the differences between inputText and outputText.
-func Print(outputText, inputText string, useDiff bool) {
+// Print outputs the provided outputText to the console.
+func Print(outputText string) {
 	fmt.Print(outputText)
+}
 
-	if useDiff {
-		fmt.Printf(
-			"\n====begin of diff==== in size: %d, out size: %d\n",
-			len(inputText),
-			len(outputText),
-		)
-		fmt.Print(diff(inputText, outputText))
-		fmt.Println("====end of diff====")
+// PrintDiff writes the differences between inputText and outputText to w. Nothing is written when there are no differences.
+func PrintDiff(w io.Writer, name, inputText, outputText string, opt DiffOption) {
+	if d := Diff(name, inputText, outputText, opt); d != "" {
+		_, _ = fmt.Fprint(w, d)
 	}
 }
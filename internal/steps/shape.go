@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/ytka/textforge/internal/openai"
 )
@@ -19,8 +20,17 @@ var (
 
 	// ErrNoChoices is an error when there are no choices in chat completion.
 	ErrNoChoices = errors.New("no choices in chat completion")
+
+	// ErrToolCallBudgetExceeded is an error when the model keeps calling the tools after the budget of the calls ran out.
+	ErrToolCallBudgetExceeded = errors.New("tool call budget exceeded")
 )
 
+// ToolHandler offers tools to the model and runs the calls of them.
+type ToolHandler interface {
+	Definitions() []openai.Tool
+	Call(ctx context.Context, call openai.ToolCall) string
+}
+
 type ShapePrompt string
 
 // ShapeResult represents the result of a text shaping operation.
@@ -29,6 +39,8 @@ type ShapeResult struct {
 	ChatCompletion *openai.ChatCompletion
 	RawResult      string
 	Result         string
+	Files          []OutputFile
+	Duration       time.Duration
 }
 
 // NewShapeResult creates a new ShapeResult.
@@ -50,8 +62,18 @@ type Shaper struct {
 	maxCompletionRepeatCount int
 	useFirstCodeBlock        bool
 	promptOptimize           bool
+	contextFiles             []ContextFile
+	multiOutput              bool
+	jsonSchema               *JSONSchema
+	tools                    ToolHandler
+	maxToolCalls             int
+	turnCheck                TurnCheckFunc
 }
 
+// TurnCheckFunc is called before each follow-up turn of the tool calls with the usage of the earlier turns and the next request.
+// Its error stops the shaping, such as when the turn would go over the budget.
+type TurnCheckFunc func(used openai.Usage, next *openai.CreateChatCompletion) error
+
 // NewShaper creates a new Shaper.
 func NewShaper(gai openai.GenerativeAIClient, maxCompletionRepeatCount int, useFirstCodeBlock, promptOptimize bool) *Shaper {
 	return &Shaper{
@@ -62,29 +84,155 @@ func NewShaper(gai openai.GenerativeAIClient, maxCompletionRepeatCount int, useF
 	}
 }
 
+// WithContext attaches the read-only context files to the prompts of the shaper.
+func (s *Shaper) WithContext(files []ContextFile) *Shaper {
+	s.contextFiles = files
+	return s
+}
+
+// WithMultiOutput lets one response create or modify several files, each in an output tag with its path.
+func (s *Shaper) WithMultiOutput(multiOutput bool) *Shaper {
+	s.multiOutput = multiOutput
+	return s
+}
+
+// WithJSONSchema makes the shaper return JSON validated against the schema. nil returns text.
+func (s *Shaper) WithJSONSchema(schema *JSONSchema) *Shaper {
+	s.jsonSchema = schema
+	return s
+}
+
+// WithTools offers the tools to the model, up to maxToolCalls calls for each shaping.
+func (s *Shaper) WithTools(tools ToolHandler, maxToolCalls int) *Shaper {
+	s.tools = tools
+	s.maxToolCalls = maxToolCalls
+	return s
+}
+
+// WithTurnCheck returns a copy of the shaper checking each follow-up turn of the tool calls, leaving a shaper shared by concurrent requests unchanged.
+func (s *Shaper) WithTurnCheck(check TurnCheckFunc) *Shaper {
+	c := *s
+	c.turnCheck = check
+	return &c
+}
+
 // MakeShapePrompt generates a ShapePrompt based on input parameters.
 func (s *Shaper) MakeShapePrompt(inputFilePath, promptOrg, inputOrg string) ShapePrompt {
-	if inputOrg == "" && !s.promptOptimize {
+	if inputOrg == "" && !s.promptOptimize && len(s.contextFiles) == 0 && !s.multiOutput && s.jsonSchema == nil {
 		return ShapePrompt(promptOrg)
 	}
-	return ShapePrompt(optimizePrompt(inputFilePath, promptOrg, inputOrg))
+	return ShapePrompt(optimizePrompt(inputFilePath, promptOrg, inputOrg, formatContextFiles(s.contextFiles, inputFilePath), s.outputInstruction()))
+}
+
+// outputInstruction returns the instruction of the output format, empty for the default output tag.
+func (s *Shaper) outputInstruction() string {
+	switch {
+	case s.jsonSchema != nil:
+		return s.jsonSchema.instruction()
+	case s.multiOutput:
+		return multiOutputSupplement
+	}
+	return ""
 }
 
 // Shape shapes the text based on the given prompts.
 func (s *Shaper) Shape(ctx context.Context, prompt ShapePrompt) (*ShapeResult, error) {
-	comp, rawResult, err := s.requestCreateChatCompletion(ctx, string(prompt))
+	start := time.Now()
+	cr := s.gai.MakeCreateChatCompletion(string(prompt))
+	if s.jsonSchema != nil {
+		cr.WithResponseFormat(s.jsonSchema.responseFormat())
+	}
+	comp, rawResult, err := s.requestWithTools(ctx, cr)
 	if err != nil {
 		return nil, err
 	}
 
-	return NewShapeResult(string(prompt), comp, rawResult, optimizeResponseResult(rawResult, s.useFirstCodeBlock)), nil
+	var resultText string
+	if s.jsonSchema != nil {
+		if comp, rawResult, resultText, err = s.validateJSON(ctx, cr, comp, rawResult); err != nil {
+			return nil, err
+		}
+	} else {
+		resultText = optimizeResponseResult(rawResult, s.useFirstCodeBlock)
+	}
+	result := NewShapeResult(string(prompt), comp, rawResult, resultText)
+	if s.multiOutput {
+		if result.Files, err = ParseOutputFiles(rawResult, s.useFirstCodeBlock); err != nil {
+			return nil, err
+		}
+	}
+	result.Duration = time.Since(start)
+	return result, nil
+}
+
+// validateJSON validates the JSON response against the schema, asking the model to repair it once on failure.
+// The usage of the repair turn is added to the returned completion.
+func (s *Shaper) validateJSON(ctx context.Context, cr *openai.CreateChatCompletion, comp *openai.ChatCompletion, rawResult string) (*openai.ChatCompletion, string, string, error) {
+	text, verr := s.jsonSchema.validate(rawResult)
+	if verr == nil {
+		return comp, rawResult, text, nil
+	}
+	cr.Messages = append(cr.Messages,
+		openai.ChatMessage{Role: "assistant", Content: rawResult},
+		openai.ChatMessage{Role: "user", Content: fmt.Sprintf(jsonRepairPrompt, verr)},
+	)
+	repaired, repairedRaw, err := s.requestWithTools(ctx, cr)
+	if err != nil {
+		return nil, "", "", err
+	}
+	repaired.Usage.Add(comp.Usage)
+	if text, verr = s.jsonSchema.validate(repairedRaw); verr != nil {
+		return nil, "", "", fmt.Errorf("%w: %w", ErrJSONSchemaValidation, verr)
+	}
+	return repaired, repairedRaw, text, nil
 }
 
-// requestCreateChatCompletion requests the AI to create chat completion based on the given prompt.
-func (s *Shaper) requestCreateChatCompletion(ctx context.Context, prompt string) (*openai.ChatCompletion, string, error) {
-	var result string
-	cr := s.gai.MakeCreateChatCompletion(prompt)
+// requestWithTools requests the completion, running the tool calls of the model and sending the results back until it answers.
+// When the budget of the tool calls runs out, the model is told to answer without them. The usage of all the turns is added to the returned completion.
+func (s *Shaper) requestWithTools(ctx context.Context, cr *openai.CreateChatCompletion) (*openai.ChatCompletion, string, error) {
+	if s.tools == nil {
+		return s.requestCreateChatCompletion(ctx, cr)
+	}
+	cr.Tools = s.tools.Definitions()
+	var usage openai.Usage
+	calls := 0
+	for {
+		comp, rawResult, err := s.requestCreateChatCompletion(ctx, cr)
+		if err != nil {
+			return nil, "", err
+		}
+		usage.Add(comp.Usage)
+		message := comp.Choices[0].Message
+		if len(message.ToolCalls) == 0 {
+			comp.Usage = usage
+			return comp, rawResult, nil
+		}
+		if cr.ToolChoice == "none" {
+			return nil, "", ErrToolCallBudgetExceeded
+		}
+		cr.Messages = append(cr.Messages, message)
+		for _, call := range message.ToolCalls {
+			result := "error: " + ErrToolCallBudgetExceeded.Error() + ", answer with the information so far"
+			if calls < s.maxToolCalls {
+				result = s.tools.Call(ctx, call)
+				calls++
+			}
+			cr.Messages = append(cr.Messages, openai.NewToolMessage(call.ID, result))
+		}
+		if calls >= s.maxToolCalls {
+			cr.ToolChoice = "none"
+		}
+		if s.turnCheck != nil {
+			if err := s.turnCheck(usage, cr); err != nil {
+				return nil, "", err
+			}
+		}
+	}
+}
 
+// requestCreateChatCompletion requests the AI to create chat completion based on the given request.
+func (s *Shaper) requestCreateChatCompletion(ctx context.Context, cr *openai.CreateChatCompletion) (*openai.ChatCompletion, string, error) {
+	var result string
 	comp, err := s.gai.RequestCreateChatCompletion(ctx, cr)
 	if err != nil {
 		return nil, "", fmt.Errorf("failed to send chat message: %w", err)
@@ -100,18 +248,25 @@ func (s *Shaper) requestCreateChatCompletion(ctx context.Context, prompt string)
 }
 
 // optimizePrompt refines the prompt by incorporating additional information.
-func optimizePrompt(inputFilePath, prompt, input string) string {
+// The outputInstruction replaces the default instruction to wrap the result in the output tag.
+func optimizePrompt(inputFilePath, prompt, input, contextBlocks, outputInstruction string) string {
 	supplements := []string{
 		"The subject of the Instruction is the area enclosed by the textforge-input tag.",
 		"The result should be returned in the language of the Instruction, but if the Instruction has a language specification, that language should be given priority.",
 		"Wrap the result in a <textforge-output> tag and return it. Only results should be returned and no explanation or supplementary information is required, but additional explanation or details should be provided if explicitly requested in the instructions.",
 	}
+	if outputInstruction != "" {
+		supplements[2] = outputInstruction
+	}
+	if contextBlocks != "" {
+		supplements = append(supplements, "The textforge-context tags are read-only reference files with their paths. Follow their types and conventions, but do not return them.")
+	}
 	supplementation := strings.Join(supplements, " ")
 	header := ""
 	if inputFilePath != "" && inputFilePath != "-" {
 		header = fmt.Sprintf("filepath=\"%s\"\n", inputFilePath)
 	}
-	return fmt.Sprintf("<Instruction>%s. (%s)</Instruction>\n%s<textforge-input>\n%s\n</textforge-input>", prompt, supplementation, header, input)
+	return fmt.Sprintf("<Instruction>%s. (%s)</Instruction>\n%s%s<textforge-input>\n%s\n</textforge-input>", prompt, supplementation, contextBlocks, header, input)
 }
 
 // optimizeResponseResult refines the AI's response, potentially extracting code blocks.
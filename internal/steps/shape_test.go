@@ -0,0 +1,63 @@
+package steps
+
+import (
+	"context"
+	"flag"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/ytka/textforge/internal/httpreplay"
+	"github.com/ytka/textforge/internal/mockserver"
+	"github.com/ytka/textforge/internal/openai"
+)
+
+var update = flag.Bool("update", false, "record the replay fixtures with the mock server")
+
+// newReplayClient returns a client replaying the fixtures in testdata/replay.
+// With -update, they are recorded with the mock server scripted by testdata/mock, upper-casing the other inputs.
+func newReplayClient(t *testing.T) *openai.ChatClient {
+	t.Helper()
+	mode, next := httpreplay.ModeReplay, http.RoundTripper(nil)
+	if *update {
+		rules, err := mockserver.LoadRules("testdata/mock")
+		if err != nil {
+			t.Fatal(err)
+		}
+		mode, next = httpreplay.ModeRecord, mockserver.NewTransport(mockserver.New(rules, mockserver.TransformUpper, false))
+	}
+	client := openai.New("", "gpt-4o", "", nil)
+	client.SetBaseURL("http://textforge.test/v1")
+	client.SetTransport(httpreplay.New("testdata/replay", mode, next))
+	return client
+}
+
+func TestShaperShapeReplay(t *testing.T) {
+	shaper := NewShaper(newReplayClient(t), 1, false, true)
+	prompt := shaper.MakeShapePrompt("testdata/input.txt", "Convert to upper case", "hello, world")
+
+	result, err := shaper.Shape(context.Background(), prompt)
+	if err != nil {
+		t.Fatalf("Shape() error = %v", err)
+	}
+	if want := "HELLO, WORLD\n"; result.Result != want {
+		t.Errorf("Result = %q, want %q", result.Result, want)
+	}
+	if result.ChatCompletion.Usage.TotalTokens == 0 {
+		t.Errorf("Usage = %+v, want the recorded usage", result.ChatCompletion.Usage)
+	}
+}
+
+func TestShaperShapeReplayMultiOutput(t *testing.T) {
+	shaper := NewShaper(newReplayClient(t), 1, false, true).WithMultiOutput(true)
+	prompt := shaper.MakeShapePrompt("testdata/input.txt", "Split into files", "alpha\nbeta")
+
+	result, err := shaper.Shape(context.Background(), prompt)
+	if err != nil {
+		t.Fatalf("Shape() error = %v", err)
+	}
+	want := []OutputFile{{Path: "a.txt", Text: "alpha\n"}, {Path: "b.txt", Text: "beta\n"}}
+	if !reflect.DeepEqual(result.Files, want) {
+		t.Errorf("Files = %+v, want %+v", result.Files, want)
+	}
+}
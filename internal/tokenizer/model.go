@@ -0,0 +1,62 @@
+package tokenizer
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrContextWindowExceeded is an error when a request does not fit in the context window of the model.
+var ErrContextWindowExceeded = errors.New("context window exceeded")
+
+// defaultContextWindow is the context window assumed for unknown models.
+const defaultContextWindow = 8192
+
+// modelContextWindows maps model name prefixes to the context window sizes. The longest matching prefix wins.
+var modelContextWindows = map[string]int{
+	"gpt-4o":                 128_000,
+	"chatgpt-4o":             128_000,
+	"gpt-4.1":                1_047_576,
+	"gpt-4.5":                128_000,
+	"gpt-4-turbo":            128_000,
+	"gpt-4-1106":             128_000,
+	"gpt-4-0125":             128_000,
+	"gpt-4-32k":              32_768,
+	"gpt-4":                  8_192,
+	"gpt-3.5-turbo":          16_385,
+	"gpt-3.5-turbo-instruct": 4_096,
+	"o1":                     200_000,
+	"o1-mini":                128_000,
+	"o1-preview":             128_000,
+	"o3":                     200_000,
+	"o4-mini":                200_000,
+}
+
+// ModelInfo holds the tokenization properties of a model.
+type ModelInfo struct {
+	Name          string
+	Encoding      Encoding
+	ContextWindow int
+}
+
+// LookupModel returns the encoding and the context window of the model.
+// Dated snapshots such as "gpt-4o-2024-08-06" are matched by prefix.
+func LookupModel(model string) ModelInfo {
+	contextWindow, matched := defaultContextWindow, ""
+	for prefix, size := range modelContextWindows {
+		if strings.HasPrefix(model, prefix) && len(prefix) > len(matched) {
+			contextWindow, matched = size, prefix
+		}
+	}
+	return ModelInfo{Name: model, Encoding: EncodingForModel(model), ContextWindow: contextWindow}
+}
+
+// CheckContextWindow returns ErrContextWindowExceeded when the prompt tokens plus the max tokens to generate
+// do not fit in the context window of the model.
+func (m ModelInfo) CheckContextWindow(promptTokens, maxTokens int) error {
+	if promptTokens+maxTokens > m.ContextWindow {
+		return fmt.Errorf("%w: %d prompt tokens + %d max tokens > %d tokens of %s",
+			ErrContextWindowExceeded, promptTokens, maxTokens, m.ContextWindow, m.Name)
+	}
+	return nil
+}
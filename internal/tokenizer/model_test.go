@@ -0,0 +1,51 @@
+package tokenizer
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLookupModel(t *testing.T) {
+	tests := []struct {
+		model             string
+		wantEncoding      Encoding
+		wantContextWindow int
+	}{
+		{model: "gpt-4o", wantEncoding: O200kBase, wantContextWindow: 128_000},
+		{model: "gpt-4o-2024-08-06", wantEncoding: O200kBase, wantContextWindow: 128_000},
+		{model: "gpt-4-32k-0613", wantEncoding: CL100kBase, wantContextWindow: 32_768},
+		{model: "gpt-4-0613", wantEncoding: CL100kBase, wantContextWindow: 8_192},
+		{model: "gpt-3.5-turbo-instruct", wantEncoding: CL100kBase, wantContextWindow: 4_096},
+		{model: "o1-mini", wantEncoding: O200kBase, wantContextWindow: 128_000},
+		{model: "unknown-model", wantEncoding: CL100kBase, wantContextWindow: defaultContextWindow},
+	}
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			got := LookupModel(tt.model)
+			if got.Name != tt.model || got.Encoding != tt.wantEncoding || got.ContextWindow != tt.wantContextWindow {
+				t.Errorf("LookupModel(%q) = %+v, want encoding %s and context window %d", tt.model, got, tt.wantEncoding, tt.wantContextWindow)
+			}
+		})
+	}
+}
+
+func TestModelInfoCheckContextWindow(t *testing.T) {
+	m := ModelInfo{Name: "test", ContextWindow: 100}
+	tests := []struct {
+		name         string
+		promptTokens int
+		maxTokens    int
+		wantErr      error
+	}{
+		{name: "fits", promptTokens: 60, maxTokens: 40},
+		{name: "prompt exceeds", promptTokens: 101, wantErr: ErrContextWindowExceeded},
+		{name: "max tokens exceed", promptTokens: 60, maxTokens: 41, wantErr: ErrContextWindowExceeded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := m.CheckContextWindow(tt.promptTokens, tt.maxTokens); !errors.Is(err, tt.wantErr) {
+				t.Errorf("CheckContextWindow(%d, %d) error = %v, want %v", tt.promptTokens, tt.maxTokens, err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package tokenizer
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/pkoukk/tiktoken-go"
+	tiktokenloader "github.com/pkoukk/tiktoken-go-loader"
+)
+
+// Encoding is the name of a BPE encoding used by OpenAI models.
+type Encoding string
+
+const (
+	CL100kBase Encoding = "cl100k_base"
+	O200kBase  Encoding = "o200k_base"
+)
+
+const (
+	// messageOverheadTokens is the number of tokens added to each chat message for the role and the separators.
+	messageOverheadTokens = 4
+	// replyPrimingTokens is the number of tokens added to prime the assistant reply.
+	replyPrimingTokens = 3
+)
+
+// o200kModelPrefixes are the prefixes of the model names using o200k_base. The others use cl100k_base.
+var o200kModelPrefixes = []string{"gpt-4o", "chatgpt-4o", "gpt-4.1", "gpt-4.5", "o1", "o3", "o4"}
+
+var (
+	tokenizers   = map[Encoding]*Tokenizer{}
+	tokenizersMu sync.Mutex
+)
+
+func init() {
+	// The vocabularies are embedded in the binary so that no network access is needed.
+	tiktoken.SetBpeLoader(tiktokenloader.NewOfflineLoader())
+}
+
+// EncodingForModel returns the encoding used by the model.
+func EncodingForModel(model string) Encoding {
+	for _, prefix := range o200kModelPrefixes {
+		if strings.HasPrefix(model, prefix) {
+			return O200kBase
+		}
+	}
+	return CL100kBase
+}
+
+// Tokenizer counts the tokens of text with an encoding.
+type Tokenizer struct {
+	encoding Encoding
+	tiktoken *tiktoken.Tiktoken
+}
+
+// New returns the tokenizer of the encoding. Tokenizers are cached because loading a vocabulary is slow.
+func New(encoding Encoding) (*Tokenizer, error) {
+	tokenizersMu.Lock()
+	defer tokenizersMu.Unlock()
+	if t, ok := tokenizers[encoding]; ok {
+		return t, nil
+	}
+	tt, err := tiktoken.GetEncoding(string(encoding))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load encoding %s: %w", encoding, err)
+	}
+	t := &Tokenizer{encoding: encoding, tiktoken: tt}
+	tokenizers[encoding] = t
+	return t, nil
+}
+
+// ForModel returns the tokenizer of the encoding used by the model.
+func ForModel(model string) (*Tokenizer, error) {
+	return New(EncodingForModel(model))
+}
+
+// Encoding returns the encoding of the tokenizer.
+func (t *Tokenizer) Encoding() Encoding {
+	return t.encoding
+}
+
+// Count returns the number of tokens of text. Special tokens are counted as ordinary text.
+func (t *Tokenizer) Count(text string) int {
+	return len(t.tiktoken.EncodeOrdinary(text))
+}
+
+// CountChatPrompt returns the number of prompt tokens of a chat request with text as the only user message.
+func (t *Tokenizer) CountChatPrompt(text string) int {
+	return t.Count(text) + messageOverheadTokens + replyPrimingTokens
+}
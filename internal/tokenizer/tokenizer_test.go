@@ -0,0 +1,69 @@
+package tokenizer
+
+import "testing"
+
+func TestForModel(t *testing.T) {
+	tests := []struct {
+		model string
+		want  Encoding
+	}{
+		{model: "gpt-4o", want: O200kBase},
+		{model: "gpt-4o-mini-2024-07-18", want: O200kBase},
+		{model: "o3-mini", want: O200kBase},
+		{model: "gpt-4", want: CL100kBase},
+		{model: "gpt-3.5-turbo", want: CL100kBase},
+		{model: "unknown-model", want: CL100kBase},
+	}
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			tok, err := ForModel(tt.model)
+			if err != nil {
+				t.Fatalf("ForModel(%q) error = %v", tt.model, err)
+			}
+			if got := tok.Encoding(); got != tt.want {
+				t.Errorf("ForModel(%q).Encoding() = %s, want %s", tt.model, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTokenizerCount(t *testing.T) {
+	tests := []struct {
+		encoding Encoding
+		text     string
+		want     int
+	}{
+		{encoding: CL100kBase, text: "", want: 0},
+		{encoding: CL100kBase, text: "Hello, world!", want: 4},
+		{encoding: O200kBase, text: "Hello, world!", want: 4},
+		{encoding: CL100kBase, text: "<|endoftext|>", want: 7},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.encoding)+"/"+tt.text, func(t *testing.T) {
+			tok, err := New(tt.encoding)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := tok.Count(tt.text); got != tt.want {
+				t.Errorf("Count(%q) = %d, want %d", tt.text, got, tt.want)
+			}
+			if got, want := tok.CountChatPrompt(tt.text), tt.want+messageOverheadTokens+replyPrimingTokens; got != want {
+				t.Errorf("CountChatPrompt(%q) = %d, want %d", tt.text, got, want)
+			}
+		})
+	}
+}
+
+func TestNewCachesTokenizers(t *testing.T) {
+	a, err := New(CL100kBase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := New(CL100kBase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a != b {
+		t.Error("New() loaded the encoding twice")
+	}
+}
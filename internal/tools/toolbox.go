@@ -0,0 +1,231 @@
+package tools
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/ytka/textforge/internal/openai"
+)
+
+const (
+	// maxReadBytes limits the size of a file returned by read_file.
+	maxReadBytes = 100 << 10
+	// maxListEntries limits the entries returned by list_directory.
+	maxListEntries = 500
+	// maxGrepMatches limits the lines returned by grep.
+	maxGrepMatches = 200
+)
+
+var (
+	// ErrOutsideRoot is an error when a tool is called with a path outside the project root.
+	ErrOutsideRoot = errors.New("path is outside the project root")
+	// ErrHiddenPath is an error when a tool is called with a hidden path, such as .env or .git/config, which may hold secrets.
+	ErrHiddenPath = errors.New("hidden files are not readable")
+	// ErrUnknownTool is an error when the model calls a tool which is not offered.
+	ErrUnknownTool = errors.New("unknown tool")
+)
+
+// Toolbox is the set of the built-in read-only tools, sandboxed to the project root.
+type Toolbox struct {
+	root string
+}
+
+// New creates a toolbox of the project root.
+func New(root string) (*Toolbox, error) {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get absolute path: %w", err)
+	}
+	if abs, err = filepath.EvalSymlinks(abs); err != nil {
+		return nil, fmt.Errorf("failed to resolve project root: %w", err)
+	}
+	return &Toolbox{root: abs}, nil
+}
+
+// Definitions returns the tools offered to the model.
+func (t *Toolbox) Definitions() []openai.Tool {
+	return []openai.Tool{
+		function("read_file", "Read a text file in the project. Paths are relative to the current directory.",
+			`{"type":"object","properties":{"path":{"type":"string","description":"Path of the file"}},"required":["path"],"additionalProperties":false}`),
+		function("list_directory", "List the files and directories in a directory of the project. Directories end with a slash.",
+			`{"type":"object","properties":{"path":{"type":"string","description":"Path of the directory, \".\" for the current directory"}},"required":["path"],"additionalProperties":false}`),
+		function("grep", "Search the text files under a path of the project for lines matching a regular expression. Returns path:line: text.",
+			`{"type":"object","properties":{"pattern":{"type":"string","description":"Regular expression (RE2 syntax)"},"path":{"type":"string","description":"File or directory to search, \".\" for the current directory"}},"required":["pattern","path"],"additionalProperties":false}`),
+	}
+}
+
+func function(name, description, parameters string) openai.Tool {
+	return openai.Tool{Type: "function", Function: openai.FunctionDefinition{Name: name, Description: description, Parameters: json.RawMessage(parameters)}}
+}
+
+// Call runs the tool call and returns its result. Errors are returned as the result so that the model can correct the call.
+func (t *Toolbox) Call(ctx context.Context, call openai.ToolCall) string {
+	result, err := t.call(ctx, call)
+	if err != nil {
+		return "error: " + err.Error()
+	}
+	return result
+}
+
+func (t *Toolbox) call(ctx context.Context, call openai.ToolCall) (string, error) {
+	var args struct {
+		Path    string `json:"path"`
+		Pattern string `json:"pattern"`
+	}
+	if err := json.Unmarshal([]byte(call.Function.Arguments), &args); err != nil {
+		return "", fmt.Errorf("invalid arguments: %w", err)
+	}
+	path, err := t.resolve(args.Path)
+	if err != nil {
+		return "", err
+	}
+	switch call.Function.Name {
+	case "read_file":
+		return t.readFile(path)
+	case "list_directory":
+		return t.listDirectory(path)
+	case "grep":
+		return t.grep(ctx, args.Pattern, path)
+	}
+	return "", fmt.Errorf("%w: %s", ErrUnknownTool, call.Function.Name)
+}
+
+// resolve returns the absolute path, which must stay inside the root after following the symbolic links and must not be hidden.
+func (t *Toolbox) resolve(path string) (string, error) {
+	if path == "" {
+		path = "."
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to get absolute path: %w", err)
+	}
+	if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+		abs = resolved
+	}
+	rel, err := filepath.Rel(t.root, abs)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%w: %s", ErrOutsideRoot, path)
+	}
+	for _, name := range strings.Split(filepath.ToSlash(rel), "/") {
+		if isHidden(name) {
+			return "", fmt.Errorf("%w: %s", ErrHiddenPath, path)
+		}
+	}
+	return abs, nil
+}
+
+// isHidden reports whether the file name is a dotfile or a dot directory.
+func isHidden(name string) bool {
+	return strings.HasPrefix(name, ".") && name != "." && name != ".."
+}
+
+// display returns the path relative to the current directory as the model sees it.
+func display(path string) string {
+	if wd, err := os.Getwd(); err == nil {
+		if rel, err := filepath.Rel(wd, path); err == nil {
+			return filepath.ToSlash(rel)
+		}
+	}
+	return path
+}
+
+func (t *Toolbox) readFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	if bytes.IndexByte(data, 0) >= 0 {
+		return "", fmt.Errorf("binary file: %s", display(path))
+	}
+	if len(data) > maxReadBytes {
+		return string(data[:maxReadBytes]) + "\n... (truncated)", nil
+	}
+	return string(data), nil
+}
+
+func (t *Toolbox) listDirectory(path string) (string, error) {
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return "", err
+	}
+	entries = slices.DeleteFunc(entries, func(e fs.DirEntry) bool { return isHidden(e.Name()) })
+	var sb strings.Builder
+	for i, e := range entries {
+		if i == maxListEntries {
+			_, _ = fmt.Fprintf(&sb, "... (%d more)\n", len(entries)-i)
+			break
+		}
+		name := e.Name()
+		if e.IsDir() {
+			name += "/"
+		}
+		sb.WriteString(name + "\n")
+	}
+	return sb.String(), nil
+}
+
+func (t *Toolbox) grep(ctx context.Context, pattern, path string) (string, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return "", fmt.Errorf("invalid pattern: %w", err)
+	}
+	var sb strings.Builder
+	matches := 0
+	errLimit := errors.New("limit")
+	err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if p != path && isHidden(d.Name()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if d.Type()&fs.ModeSymlink != 0 {
+			// A symbolic link may point outside the root.
+			return nil
+		}
+		data, err := os.ReadFile(p)
+		if err != nil || bytes.IndexByte(data, 0) >= 0 {
+			return nil
+		}
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		scanner.Buffer(make([]byte, 0, 64<<10), 1<<20)
+		for line := 1; scanner.Scan(); line++ {
+			if !re.MatchString(scanner.Text()) {
+				continue
+			}
+			if matches == maxGrepMatches {
+				sb.WriteString("... (more matches)\n")
+				return errLimit
+			}
+			_, _ = fmt.Fprintf(&sb, "%s:%d: %s\n", display(p), line, scanner.Text())
+			matches++
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errLimit) {
+		return "", err
+	}
+	if matches == 0 {
+		return "no matches", nil
+	}
+	return sb.String(), nil
+}
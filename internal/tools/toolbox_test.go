@@ -0,0 +1,151 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ytka/textforge/internal/openai"
+)
+
+// setupRoot creates a project root with hidden files and symbolic links, next to a file outside of it, and changes into the root.
+func setupRoot(t *testing.T) (string, string) {
+	t.Helper()
+	tmp, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := filepath.Join(tmp, "root")
+	outside := filepath.Join(tmp, "outside.txt")
+	files := map[string]string{
+		filepath.Join(root, "a.txt"):          "alpha secret\n",
+		filepath.Join(root, "sub", "b.txt"):   "beta\n",
+		filepath.Join(root, ".env"):           "API_KEY=secret\n",
+		filepath.Join(root, ".git", "config"): "[core]\n\tsecret = true\n",
+		filepath.Join(root, "sub", ".hidden"): "secret\n",
+		outside:                               "outside secret\n",
+	}
+	for path, text := range files {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for link, target := range map[string]string{
+		"link-outside.txt": outside,
+		"link-env.txt":     filepath.Join(root, ".env"),
+		"link-a.txt":       filepath.Join(root, "a.txt"),
+	} {
+		if err := os.Symlink(target, filepath.Join(root, link)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(root); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.Chdir(wd) })
+	return root, outside
+}
+
+func TestToolboxResolve(t *testing.T) {
+	root, outside := setupRoot(t)
+	tb, err := New(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path    string
+		want    string
+		wantErr error
+	}{
+		{path: "", want: root},
+		{path: ".", want: root},
+		{path: "a.txt", want: filepath.Join(root, "a.txt")},
+		{path: "sub/../a.txt", want: filepath.Join(root, "a.txt")},
+		{path: filepath.Join(root, "sub", "b.txt"), want: filepath.Join(root, "sub", "b.txt")},
+		{path: "link-a.txt", want: filepath.Join(root, "a.txt")},
+		{path: "..", wantErr: ErrOutsideRoot},
+		{path: "../outside.txt", wantErr: ErrOutsideRoot},
+		{path: "sub/../../outside.txt", wantErr: ErrOutsideRoot},
+		{path: outside, wantErr: ErrOutsideRoot},
+		{path: "/etc/passwd", wantErr: ErrOutsideRoot},
+		{path: "link-outside.txt", wantErr: ErrOutsideRoot},
+		{path: ".env", wantErr: ErrHiddenPath},
+		{path: ".git", wantErr: ErrHiddenPath},
+		{path: ".git/config", wantErr: ErrHiddenPath},
+		{path: "sub/../.git/config", wantErr: ErrHiddenPath},
+		{path: "sub/.hidden", wantErr: ErrHiddenPath},
+		{path: "link-env.txt", wantErr: ErrHiddenPath},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, err := tb.resolve(tt.path)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("resolve(%q) = %q, %v, want %v", tt.path, got, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("resolve(%q) = %q, %v, want %q", tt.path, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestToolboxCall(t *testing.T) {
+	root, _ := setupRoot(t)
+	tb, err := New(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	call := func(name string, args map[string]string) string {
+		data, err := json.Marshal(args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tb.Call(context.Background(), openai.ToolCall{Function: openai.FunctionCall{Name: name, Arguments: string(data)}})
+	}
+
+	tests := []struct {
+		name        string
+		tool        string
+		args        map[string]string
+		contains    []string
+		notContains []string
+	}{
+		{name: "read", tool: "read_file", args: map[string]string{"path": "a.txt"}, contains: []string{"alpha"}},
+		{name: "read hidden", tool: "read_file", args: map[string]string{"path": ".env"}, contains: []string{"error: " + ErrHiddenPath.Error()}, notContains: []string{"API_KEY"}},
+		{name: "read outside", tool: "read_file", args: map[string]string{"path": "../outside.txt"}, contains: []string{"error: " + ErrOutsideRoot.Error()}},
+		{name: "list hides dotfiles", tool: "list_directory", args: map[string]string{"path": "."}, contains: []string{"a.txt\n", "sub/\n"}, notContains: []string{".env", ".git"}},
+		{name: "grep skips hidden and links", tool: "grep", args: map[string]string{"pattern": "secret", "path": "."}, contains: []string{"a.txt:1: alpha secret"}, notContains: []string{".env", ".git", ".hidden", "outside", "link-"}},
+		{name: "unknown", tool: "write_file", args: map[string]string{"path": "a.txt"}, contains: []string{"error: " + ErrUnknownTool.Error()}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := call(tt.tool, tt.args)
+			for _, s := range tt.contains {
+				if !strings.Contains(got, s) {
+					t.Errorf("%s(%v) = %q, want to contain %q", tt.tool, tt.args, got, s)
+				}
+			}
+			for _, s := range tt.notContains {
+				if strings.Contains(got, s) {
+					t.Errorf("%s(%v) = %q, want not to contain %q", tt.tool, tt.args, got, s)
+				}
+			}
+		})
+	}
+}
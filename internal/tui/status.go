@@ -42,6 +42,11 @@ func (s *StatusUI) UpdateStatusText(statusText string) {
 	s.program.Send(updateStatusMsg(statusText))
 }
 
+// Println prints the text above the status line.
+func (s *StatusUI) Println(text string) {
+	s.program.Println(text)
+}
+
 type statusModel struct {
 	spinner    spinner.Model
 	statusText string
@@ -0,0 +1,157 @@
+package watch
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ytka/textforge/internal/openai"
+	"github.com/ytka/textforge/internal/runner"
+	"github.com/ytka/textforge/internal/state"
+	"github.com/ytka/textforge/internal/steps"
+)
+
+// Result is the result of a cycle of an input file.
+type Result struct {
+	InputPath string
+	Outpath   string
+	// Skipped is true when the changed file is an output of the session.
+	Skipped   bool
+	UsageCost *openai.UsageCost
+	Duration  time.Duration
+}
+
+// Session re-shapes the input files on their changes with the prompt and tracks the cumulative cost.
+type Session struct {
+	config     *runner.Config
+	promptText string
+	outpath    *steps.OutpathTemplate
+	shaper     *steps.Shaper
+
+	mu      sync.Mutex
+	written map[string]string
+	outputs map[string]bool
+	runs    int
+	cost    float64
+	unknown int
+}
+
+// NewSession creates a session of the configuration, writing the results to the outpath template.
+func NewSession(config *runner.Config, promptText string, outpath *steps.OutpathTemplate, gaiFactory runner.GenerativeAIHandlerFactoryFunc) (*Session, error) {
+	shaper, err := runner.NewShaper(config, gaiFactory)
+	if err != nil {
+		return nil, err
+	}
+	return &Session{config: config, promptText: promptText, outpath: outpath, shaper: shaper, written: map[string]string{}, outputs: map[string]bool{}}, nil
+}
+
+// ScanOutputs records the output paths of the files under the watched paths, except the hidden ones,
+// so that the outputs in a watched directory are not taken as inputs even when they are changed by others.
+func (s *Session) ScanOutputs(paths []string) error {
+	for _, root := range paths {
+		err := filepath.WalkDir(filepath.Clean(root), func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if path != filepath.Clean(root) && isHidden(path) {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !d.Type().IsRegular() {
+				return nil
+			}
+			_, err = s.outputOf(path)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to scan outputs: %w", err)
+		}
+	}
+	return nil
+}
+
+// outputOf returns the output path of the input file, recording it as an output unless it is the input itself.
+func (s *Session) outputOf(inputPath string) (string, error) {
+	outpath, err := s.outpath.Execute(inputPath)
+	if err != nil {
+		return "", err
+	}
+	if outpath != filepath.Clean(inputPath) {
+		s.mu.Lock()
+		s.outputs[outpath] = true
+		s.mu.Unlock()
+	}
+	return outpath, nil
+}
+
+// isOutput reports whether the file is the output of another input file.
+func (s *Session) isOutput(path string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.outputs[filepath.Clean(path)]
+}
+
+// IsOwnOutput reports whether the file has the content last written by the session, so that writing the output does not trigger a cycle.
+func (s *Session) IsOwnOutput(path string) bool {
+	s.mu.Lock()
+	hash, ok := s.written[filepath.Clean(path)]
+	s.mu.Unlock()
+	if !ok {
+		return false
+	}
+	data, err := os.ReadFile(path)
+	return err == nil && state.Hash(string(data)) == hash
+}
+
+// Process shapes the input file and writes the result to its outpath.
+func (s *Session) Process(ctx context.Context, inputPath string) (*Result, error) {
+	if s.IsOwnOutput(inputPath) || s.isOutput(inputPath) {
+		return &Result{InputPath: inputPath, Skipped: true}, nil
+	}
+	outpath, err := s.outputOf(inputPath)
+	if err != nil {
+		return nil, err
+	}
+	inputText, err := steps.GetInputText(inputPath)
+	if err != nil {
+		return nil, err
+	}
+	result, err := s.shaper.Shape(ctx, s.shaper.MakeShapePrompt(inputPath, s.promptText, inputText))
+	if err != nil {
+		return nil, fmt.Errorf("failed to shape text: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(outpath), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create output directory: %w", err)
+	}
+	// The hash is recorded before writing, because the write is notified before WriteResult returns.
+	s.mu.Lock()
+	s.written[outpath] = state.Hash(result.Result)
+	s.mu.Unlock()
+	if err := steps.WriteResult(result.Result, outpath); err != nil {
+		return nil, err
+	}
+
+	uc := openai.NewUsageCost(result.ChatCompletion)
+	s.mu.Lock()
+	s.runs++
+	if ok, cost := uc.TotalTokensCost(); ok {
+		s.cost += cost
+	} else {
+		s.unknown++
+	}
+	s.mu.Unlock()
+	return &Result{InputPath: inputPath, Outpath: outpath, UsageCost: uc, Duration: result.Duration}, nil
+}
+
+// Summary returns the number of the runs and the cumulative cost of the session, with the number of the runs of unknown cost.
+func (s *Session) Summary() (runs int, cost float64, unknown int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.runs, s.cost, s.unknown
+}
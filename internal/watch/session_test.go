@@ -0,0 +1,75 @@
+package watch
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ytka/textforge/internal/mockserver"
+	"github.com/ytka/textforge/internal/openai"
+	"github.com/ytka/textforge/internal/runner"
+	"github.com/ytka/textforge/internal/steps"
+)
+
+// mockFactory makes the clients of the upper-casing mock server.
+func mockFactory(model string, _ int) (openai.GenerativeAIClient, error) {
+	client := openai.New("", model, "", nil)
+	client.SetBaseURL("http://textforge.test/v1")
+	client.SetTransport(mockserver.NewTransport(mockserver.New(nil, mockserver.TransformUpper, false)))
+	return client, nil
+}
+
+func TestSessionSkipsOutputs(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_DATA_HOME", filepath.Join(dir, ".data"))
+	write := func(name, text string) string {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	a := write("a.ja.md", "a")
+	aOut := write("a.md", "old")
+
+	outpath, err := steps.ParseOutpathTemplate(`{{.Dir}}/{{trimSuffix ".ja" .Stem}}{{.Ext}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &runner.Config{Model: "gpt-4o", MaxCompletionRepeatCount: 1, NoCache: true, Silent: true}
+	s, err := NewSession(config, "Convert to upper case", outpath, mockFactory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.ScanOutputs([]string{dir}); err != nil {
+		t.Fatalf("ScanOutputs() error = %v", err)
+	}
+
+	ctx := context.Background()
+	tests := []struct {
+		name    string
+		path    func() string
+		skipped bool
+	}{
+		{name: "existing output edited", path: func() string { return write("a.md", "edited") }, skipped: true},
+		{name: "input", path: func() string { return a }, skipped: false},
+		{name: "own write", path: func() string { return aOut }, skipped: true},
+		{name: "new input", path: func() string { return write("b.ja.md", "b") }, skipped: false},
+		{name: "output of the new input edited", path: func() string { return write("b.md", "edited") }, skipped: true},
+		{name: "input mapped to itself", path: func() string { return write("c.md", "c") }, skipped: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := tt.path()
+			res, err := s.Process(ctx, path)
+			if err != nil {
+				t.Fatalf("Process(%s) error = %v", path, err)
+			}
+			if res.Skipped != tt.skipped {
+				t.Errorf("Process(%s) skipped = %t, want %t", path, res.Skipped, tt.skipped)
+			}
+		})
+	}
+}
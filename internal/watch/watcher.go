@@ -0,0 +1,154 @@
+package watch
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Watcher notifies the changes of the input files, debounced so that a save of several writes is one change.
+type Watcher struct {
+	fsw      *fsnotify.Watcher
+	debounce time.Duration
+	files    map[string]bool
+	dirs     []string
+}
+
+// NewWatcher watches the files and the directories recursively. Files are watched through their parent directories,
+// so that the saves of editors which replace the file by renaming are also notified.
+func NewWatcher(paths []string, debounce time.Duration) (*Watcher, error) {
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create watcher: %w", err)
+	}
+	w := &Watcher{fsw: fsw, debounce: debounce, files: map[string]bool{}}
+	for _, p := range paths {
+		if err := w.add(filepath.Clean(p)); err != nil {
+			_ = fsw.Close()
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+func (w *Watcher) add(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("failed to watch: %w", err)
+	}
+	if !info.IsDir() {
+		w.files[path] = true
+		if err := w.fsw.Add(filepath.Dir(path)); err != nil {
+			return fmt.Errorf("failed to watch %s: %w", path, err)
+		}
+		return nil
+	}
+	w.dirs = append(w.dirs, path)
+	return w.addDir(path)
+}
+
+// addDir watches the directory and its subdirectories, except the hidden ones such as .git.
+func (w *Watcher) addDir(dir string) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if path != dir && isHidden(path) {
+			return filepath.SkipDir
+		}
+		if err := w.fsw.Add(path); err != nil {
+			return fmt.Errorf("failed to watch %s: %w", path, err)
+		}
+		return nil
+	})
+}
+
+// Close stops watching.
+func (w *Watcher) Close() error {
+	return w.fsw.Close()
+}
+
+// Watch calls onChange with the path of each changed input file until ctx is done.
+// onChange is called one at a time, and the changes during a call are notified after it.
+func (w *Watcher) Watch(ctx context.Context, onChange func(path string)) error {
+	timers := map[string]*time.Timer{}
+	defer func() {
+		for _, t := range timers {
+			t.Stop()
+		}
+	}()
+	fire := make(chan string)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err, ok := <-w.fsw.Errors:
+			if !ok {
+				return nil
+			}
+			return fmt.Errorf("failed to watch: %w", err)
+		case ev, ok := <-w.fsw.Events:
+			if !ok {
+				return nil
+			}
+			path := filepath.Clean(ev.Name)
+			if ev.Has(fsnotify.Create) && w.inDirs(path) {
+				if info, err := os.Stat(path); err == nil && info.IsDir() && !isHidden(path) {
+					_ = w.addDir(path)
+					continue
+				}
+			}
+			if !ev.Has(fsnotify.Write) && !ev.Has(fsnotify.Create) || !w.matches(path) {
+				continue
+			}
+			if t, ok := timers[path]; ok {
+				t.Reset(w.debounce)
+				continue
+			}
+			timers[path] = time.AfterFunc(w.debounce, func() {
+				select {
+				case fire <- path:
+				case <-ctx.Done():
+				}
+			})
+		case path := <-fire:
+			delete(timers, path)
+			onChange(path)
+		}
+	}
+}
+
+// matches reports whether the path is an input file, given or in the directories.
+func (w *Watcher) matches(path string) bool {
+	if w.files[path] {
+		return true
+	}
+	if !w.inDirs(path) || isHidden(path) {
+		return false
+	}
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular()
+}
+
+func (w *Watcher) inDirs(path string) bool {
+	for _, dir := range w.dirs {
+		if rel, err := filepath.Rel(dir, path); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// isHidden reports whether the base name starts with a dot, such as .git and the temporary files of editors.
+func isHidden(path string) bool {
+	return strings.HasPrefix(filepath.Base(path), ".")
+}